@@ -0,0 +1,354 @@
+// cmd/keys/main.go
+//
+// Gestión de las claves de firma JWT en JWT_KEYS_DIR. La rotación va en dos
+// pasos: una clave se publica (entra en el JWKS y todas las réplicas la
+// aceptan) y solo después se activa para firmar. Las réplicas releen el
+// directorio cada minuto y el JWKS se cachea 5 minutos, así que activar antes
+// de jwtutil.ActivationDelay (6 min) haría que otras réplicas o verificadores
+// externos rechazaran los tokens nuevos.
+//
+//	keys init [-alg EdDSA|RS256] [-bits 2048]     crea y activa una clave solo si el directorio no tiene ninguna
+//	keys publish [-alg EdDSA|RS256] [-bits 2048]  genera una clave y la publica sin activarla
+//	keys activate [-kid <kid>] [-force]           activa la publicada (falla si no ha pasado la espera)
+//	keys rotate [-alg ...] [-bits ...]            publish, espera ActivationDelay y activate
+//	keys list                                     lista las claves, la activa y la pendiente
+//	keys retire -kid <kid>                        deja la clave solo para verificación
+//	keys remove -kid <kid>                        la elimina (tokens firmados con ella dejan de validar)
+//
+// La primera clave del directorio se activa al publicarla (nadie firma aún).
+// Tras activar, conservar la clave anterior al menos ACCESS_TOKEN_TTL_MIN
+// antes de retirarla o eliminarla.
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/auth/jwtutil"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `uso: keys <init|publish|activate|rotate|list|retire|remove> [flags]
+
+  init      primera clave (activa) si no hay ninguna; si ya hay, no hace nada
+  publish   genera una clave y la publica; todavía no firma
+  activate  la activa; exige %s desde publish (recarga %s + caché del JWKS %s)
+  rotate    publish + espera + activate en un solo paso (bloquea %s)
+`, jwtutil.ActivationDelay, jwtutil.ReloadPeriod, jwtutil.JWKSMaxAge, jwtutil.ActivationDelay)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	dir := jwtutil.KeysDir()
+
+	var err error
+	switch os.Args[1] {
+	case "init", "publish", "rotate":
+		fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+		alg := fs.String("alg", jwtutil.AlgEdDSA, "algoritmo: EdDSA | RS256")
+		bits := fs.Int("bits", 2048, "tamaño de clave RSA")
+		_ = fs.Parse(os.Args[2:])
+		// init es idempotente: lo corre docker compose en cada arranque
+		if os.Args[1] == "init" {
+			if kid := newestPrivate(dir); kid != "" {
+				log.Printf("✅ %s ya tiene claves (la más reciente, %s); no se crea ninguna", dir, kid)
+				break
+			}
+		}
+		var kid string
+		var activated bool
+		kid, activated, err = publish(dir, *alg, *bits)
+		if err == nil && !activated && os.Args[1] == "rotate" {
+			log.Printf("⏳ Esperando %s para activar %s (Ctrl-C: queda publicada; luego keys activate)", jwtutil.ActivationDelay, kid)
+			time.Sleep(jwtutil.ActivationDelay)
+			err = activate(dir, kid, false)
+		}
+	case "activate":
+		fs := flag.NewFlagSet("activate", flag.ExitOnError)
+		kid := fs.String("kid", "", "kid a activar (por defecto la publicada pendiente)")
+		force := fs.Bool("force", false, "activar sin esperar (solo si no hay otras réplicas ni verificadores externos)")
+		_ = fs.Parse(os.Args[2:])
+		err = activate(dir, *kid, *force)
+	case "list":
+		err = list(dir)
+	case "retire", "remove":
+		fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+		kid := fs.String("kid", "", "kid de la clave")
+		_ = fs.Parse(os.Args[2:])
+		if *kid == "" {
+			usage()
+		}
+		if os.Args[1] == "retire" {
+			err = retire(dir, *kid)
+		} else {
+			err = remove(dir, *kid)
+		}
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+func newKid() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102") + "-" + hex.EncodeToString(b), nil
+}
+
+// publish genera la clave y la deja en el directorio sin activarla. Si no
+// había ninguna se activa directamente.
+func publish(dir, alg string, bits int) (kid string, activated bool, err error) {
+	var priv crypto.Signer
+	switch alg {
+	case jwtutil.AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case jwtutil.AlgRS256:
+		if bits < 2048 {
+			return "", false, fmt.Errorf("RSA requiere al menos 2048 bits")
+		}
+		priv, err = rsa.GenerateKey(rand.Reader, bits)
+	default:
+		return "", false, fmt.Errorf("alg inválido %q (EdDSA, RS256)", alg)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", false, err
+	}
+	if kid, err = newKid(); err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", false, err
+	}
+	if p, _, ok := jwtutil.ReadPending(dir); ok {
+		return "", false, fmt.Errorf("ya hay una clave publicada sin activar (%s); actívala o elimínala antes", p)
+	}
+
+	// Sin archivo "active" las réplicas firman con la privada más reciente:
+	// se fija la actual antes de escribir la nueva
+	current := jwtutil.ActiveKid(dir)
+	if current == "" {
+		current = newestPrivate(dir)
+		if current != "" {
+			if err := jwtutil.WriteActive(dir, current); err != nil {
+				return "", false, err
+			}
+		}
+	}
+	// Se marca pendiente antes de escribir la clave: ninguna réplica la
+	// tomará como "la más reciente" entre ambos pasos
+	first := current == ""
+	if !first {
+		if err := jwtutil.WritePending(dir, kid, time.Now()); err != nil {
+			return "", false, err
+		}
+	}
+	path := filepath.Join(dir, kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return "", false, err
+	}
+	if first {
+		if err := jwtutil.WriteActive(dir, kid); err != nil {
+			return "", false, err
+		}
+		log.Printf("✅ Primera clave %s (%s) activa en %s", kid, alg, path)
+		return kid, true, nil
+	}
+	log.Printf("✅ Clave %s (%s) publicada en %s; actívala desde %s con: keys activate",
+		kid, alg, path, time.Now().Add(jwtutil.ActivationDelay).Format("15:04:05"))
+	return kid, false, nil
+}
+
+// activate hace de kid la clave de firma si ya pasó ActivationDelay desde
+// que se publicó (o con force).
+func activate(dir, kid string, force bool) error {
+	pending, since, ok := jwtutil.ReadPending(dir)
+	if kid == "" {
+		if !ok {
+			return fmt.Errorf("no hay ninguna clave publicada pendiente; usa -kid")
+		}
+		kid = pending
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, kid+".pem"))
+	if err != nil {
+		return fmt.Errorf("clave privada %s: %w", kid, err)
+	}
+	if _, err := jwtutil.ParsePrivateKeyPEM(kid, raw); err != nil {
+		return err
+	}
+	if ok && kid == pending && !force {
+		if wait := time.Until(since.Add(jwtutil.ActivationDelay)); wait > 0 {
+			return fmt.Errorf("%s se publicó hace %s; faltan %s para que todas las réplicas y cachés del JWKS la conozcan (o -force)",
+				kid, time.Since(since).Round(time.Second), wait.Round(time.Second))
+		}
+	}
+	if os.Getenv("JWT_ACTIVE_KID") != "" {
+		log.Printf("warn: JWT_ACTIVE_KID está definido y tiene prioridad sobre el archivo active")
+	}
+	if err := jwtutil.WriteActive(dir, kid); err != nil {
+		return err
+	}
+	if ok && kid == pending {
+		if err := jwtutil.WritePending(dir, "", time.Time{}); err != nil {
+			return err
+		}
+	}
+	log.Printf("✅ Clave %s activa; las réplicas firmarán con ella en menos de %s", kid, jwtutil.ReloadPeriod)
+	return nil
+}
+
+// newestPrivate: la privada más reciente, la que las réplicas usan sin "active".
+func newestPrivate(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var kid string
+	var newest time.Time
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".pem") || strings.HasSuffix(name, ".pub.pem") {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().After(newest) {
+			kid, newest = strings.TrimSuffix(name, ".pem"), info.ModTime()
+		}
+	}
+	return kid
+}
+
+func list(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	active := jwtutil.ActiveKid(dir)
+	pending, since, _ := jwtutil.ReadPending(dir)
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".pem") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		kind, kid := "firma", strings.TrimSuffix(name, ".pem")
+		var k *jwtutil.Key
+		if strings.HasSuffix(name, ".pub.pem") {
+			kind, kid = "verificación", strings.TrimSuffix(name, ".pub.pem")
+			k, err = jwtutil.ParsePublicKeyPEM(kid, raw)
+		} else {
+			k, err = jwtutil.ParsePrivateKeyPEM(kid, raw)
+		}
+		if err != nil {
+			fmt.Printf("%-24s inválida: %v\n", kid, err)
+			continue
+		}
+		mark := ""
+		switch kid {
+		case active:
+			mark = " (activa)"
+		case pending:
+			mark = fmt.Sprintf(" (publicada, activable desde %s)", since.Add(jwtutil.ActivationDelay).Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("%-24s %-6s %s%s\n", kid, k.Alg, kind, mark)
+	}
+	return nil
+}
+
+// retire reemplaza la privada por su pública: sigue validando tokens emitidos, no firma.
+func retire(dir, kid string) error {
+	if err := ensureNotActive(dir, kid); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, kid+".pem")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	k, err := jwtutil.ParsePrivateKeyPEM(kid, raw)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(k.Public)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pub.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := clearPending(dir, kid); err != nil {
+		return err
+	}
+	log.Printf("✅ Clave %s retirada (solo verificación)", kid)
+	return nil
+}
+
+func remove(dir, kid string) error {
+	if err := ensureNotActive(dir, kid); err != nil {
+		return err
+	}
+	removed := 0
+	for _, name := range []string{kid + ".pem", kid + ".pub.pem"} {
+		err := os.Remove(filepath.Join(dir, name))
+		if err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if removed == 0 {
+		return fmt.Errorf("clave %s no encontrada", kid)
+	}
+	if err := clearPending(dir, kid); err != nil {
+		return err
+	}
+	log.Printf("✅ Clave %s eliminada", kid)
+	return nil
+}
+
+// clearPending desmarca kid si era la publicada pendiente de activar.
+func clearPending(dir, kid string) error {
+	if p, _, ok := jwtutil.ReadPending(dir); ok && p == kid {
+		return jwtutil.WritePending(dir, "", time.Time{})
+	}
+	return nil
+}
+
+func ensureNotActive(dir, kid string) error {
+	if jwtutil.ActiveKid(dir) == kid {
+		return fmt.Errorf("%s es la clave activa; rota antes de retirarla", kid)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+// cmd/mockidp/main.go
+//
+// Proveedor OpenID Connect de pruebas para el login SSO en local. NO usar en
+// producción: no hay contraseñas, se elige el usuario en una lista.
+//
+//	MOCKIDP_ADDR           dirección de escucha (":9000")
+//	MOCKIDP_ISSUER         issuer que ve el backend ("http://localhost:9000")
+//	MOCKIDP_PUBLIC_URL     base que ve el navegador para /authorize (por defecto el issuer)
+//	MOCKIDP_CLIENT_ID      client_id aceptado ("amestris")
+//	MOCKIDP_CLIENT_SECRET  si se define, el token endpoint lo exige
+//
+// /authorize?...&login_hint=<email> aprueba sin mostrar la lista (útil en scripts).
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type user struct {
+	Sub           string   `json:"sub"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	Groups        []string `json:"groups"`
+}
+
+var users = []user{
+	{Sub: "mock-roy", Email: "roy@amestris.gov", EmailVerified: true, Name: "Roy Mustang", Groups: []string{"amestris-supervisors"}},
+	{Sub: "mock-riza", Email: "riza@amestris.gov", EmailVerified: true, Name: "Riza Hawkeye", Groups: []string{"amestris-alchemists"}},
+	{Sub: "mock-maes", Email: "maes@amestris.gov", EmailVerified: true, Name: "Maes Hughes (nuevo)", Groups: []string{"amestris-alchemists"}},
+	{Sub: "mock-kain", Email: "kain@amestris.gov", EmailVerified: true, Name: "Kain Fuery (sin grupos)"},
+}
+
+// code emitido en /authorize y pendiente de canjear en /token
+type grant struct {
+	user      user
+	clientID  string
+	redirect  string
+	nonce     string
+	challenge string
+	expires   time.Time
+}
+
+type idp struct {
+	issuer, publicURL string
+	clientID, secret  string
+	key               *rsa.PrivateKey
+	kid               string
+
+	mu     sync.Mutex
+	grants map[string]grant
+	tokens map[string]user // access_token → usuario (userinfo)
+}
+
+func env(k, def string) string {
+	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+		return v
+	}
+	return def
+}
+
+func main() {
+	addr := env("MOCKIDP_ADDR", ":9000")
+	issuer := strings.TrimRight(env("MOCKIDP_ISSUER", "http://localhost:9000"), "/")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("❌ clave: %v", err)
+	}
+	p := &idp{
+		issuer:    issuer,
+		publicURL: strings.TrimRight(env("MOCKIDP_PUBLIC_URL", issuer), "/"),
+		clientID:  env("MOCKIDP_CLIENT_ID", "amestris"),
+		secret:    os.Getenv("MOCKIDP_CLIENT_SECRET"),
+		key:       key,
+		kid:       "mock-" + randHex(4),
+		grants:    map[string]grant{},
+		tokens:    map[string]user{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /userinfo", p.userinfo)
+
+	log.Printf("mock IdP en %s (issuer %s, client_id %s)", addr, p.issuer, p.clientID)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+func (p *idp) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.publicURL + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"userinfo_endpoint":                     p.issuer + "/userinfo",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"claims_supported":                      []string{"sub", "email", "email_verified", "name", "groups", "nonce"},
+	})
+}
+
+var pickTpl = template.Must(template.New("pick").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Mock IdP</title></head>
+<body style="font-family:sans-serif;max-width:32rem;margin:3rem auto">
+<h2>Mock IdP — elige un usuario</h2>
+<form method="post" action="/authorize?{{.Query}}">
+{{range .Users}}<p><button name="login_hint" value="{{.Email}}">{{.Name}}</button>
+<small>{{.Email}} · grupos: {{range .Groups}}{{.}} {{else}}—{{end}}</small></p>
+{{end}}</form></body></html>`))
+
+func (p *idp) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect := q.Get("redirect_uri")
+	switch {
+	case q.Get("response_type") != "code":
+		http.Error(w, "response_type debe ser code", http.StatusBadRequest)
+		return
+	case q.Get("client_id") != p.clientID:
+		http.Error(w, "client_id desconocido", http.StatusBadRequest)
+		return
+	case redirect == "":
+		http.Error(w, "falta redirect_uri", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE S256 obligatorio", http.StatusBadRequest)
+		return
+	}
+
+	hint := r.FormValue("login_hint")
+	if hint == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = pickTpl.Execute(w, map[string]any{"Query": template.URL(q.Encode()), "Users": users})
+		return
+	}
+	var u *user
+	for i := range users {
+		if strings.EqualFold(users[i].Email, hint) {
+			u = &users[i]
+		}
+	}
+	if u == nil {
+		http.Error(w, "usuario desconocido", http.StatusBadRequest)
+		return
+	}
+
+	code := randHex(16)
+	p.mu.Lock()
+	p.grants[code] = grant{
+		user:      *u,
+		clientID:  p.clientID,
+		redirect:  redirect,
+		nonce:     q.Get("nonce"),
+		challenge: q.Get("code_challenge"),
+		expires:   time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	back, err := url.Parse(redirect)
+	if err != nil {
+		http.Error(w, "redirect_uri inválido", http.StatusBadRequest)
+		return
+	}
+	bq := back.Query()
+	bq.Set("code", code)
+	bq.Set("state", q.Get("state"))
+	back.RawQuery = bq.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (p *idp) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID || (p.secret != "" && secret != p.secret) {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(g.expires) || g.redirect != r.PostForm.Get("redirect_uri") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            g.user.Sub,
+		"aud":            g.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"name":           g.user.Name,
+		"groups":         g.user.Groups,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = p.kid
+	idToken, err := t.SignedString(p.key)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	access := randHex(16)
+	p.mu.Lock()
+	p.tokens[access] = g.user
+	p.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *idp) jwks(w http.ResponseWriter, _ *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": p.kid,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (p *idp) userinfo(w http.ResponseWriter, r *http.Request) {
+	access, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	u, ok := p.tokens[access]
+	p.mu.Unlock()
+	if !ok {
+		tokenError(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,31 @@
+package async
+
+import "time"
+
+/* ====================== Reintentos + Backoff ====================== */
+
+type RetryConfig struct {
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	Factor      float64
+}
+
+// Backoff: espera antes del intento attempt+1 (exponencial, con tope).
+func (c RetryConfig) Backoff(attempt int) time.Duration {
+	factor := c.Factor
+	if factor <= 1 {
+		factor = 2
+	}
+	d := c.BackoffBase
+	for i := 1; i < attempt; i++ {
+		d = time.Duration(float64(d) * factor)
+		if c.BackoffMax > 0 && d > c.BackoffMax {
+			break
+		}
+	}
+	if c.BackoffMax > 0 && d > c.BackoffMax {
+		d = c.BackoffMax
+	}
+	return d
+}
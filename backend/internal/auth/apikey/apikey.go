@@ -0,0 +1,57 @@
+// Package apikey genera y valida las API keys para scripts e instrumentos.
+//
+// Formato: amk_<prefix>_<secret>. El prefijo (8 hex) se guarda en claro para
+// localizar la key y mostrarla en listados; del secreto solo se guarda su
+// SHA-256, que basta porque es aleatorio de 256 bits.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	Scheme = "amk"
+
+	KindPersonal = "PERSONAL" // de un usuario, creada por él mismo
+	KindService  = "SERVICE"  // de integraciones, gestionada por administradores
+)
+
+// Generate devuelve la key completa (se muestra una sola vez), su prefijo y
+// el hash del secreto.
+func Generate() (full, prefix, secretHash string, err error) {
+	p := make([]byte, 4)
+	if _, err = rand.Read(p); err != nil {
+		return "", "", "", err
+	}
+	s := make([]byte, 32)
+	if _, err = rand.Read(s); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(p)
+	secret := base64.RawURLEncoding.EncodeToString(s)
+	return Scheme + "_" + prefix + "_" + secret, prefix, Hash(secret), nil
+}
+
+// Split separa prefijo y secreto; ok=false si no tiene el formato esperado.
+func Split(raw string) (prefix, secret string, ok bool) {
+	parts := strings.SplitN(strings.TrimSpace(raw), "_", 3)
+	if len(parts) != 3 || parts[0] != Scheme || len(parts[1]) != 8 || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches compara en tiempo constante el secreto con el hash guardado.
+func Matches(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(hash)) == 1
+}
@@ -1,79 +1,219 @@
 package jwtutil
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"os"
-	"strconv"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"amestris/backend/internal/db"
 )
 
 type Claims struct {
-	UserID uint   `json:"uid"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"uid"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"` // AuthSession que emitió el token
+	// Permisos del rol al emitir el token; informativo para otros servicios
+	// (este API los resuelve de la BD en cada request)
+	Perms []string `json:"perms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// lee secreto de JWT
-func secret() []byte {
-	s := os.Getenv("JWT_SECRET")
-	if s == "" {
-		// valor por defecto (solo dev)
-		s = "change_me_dev_secret"
+// TTL: duración del access token (ACCESS_TOKEN_TTL_MIN, default 30 min)
+func TTL() time.Duration {
+	n := db.AccessTokenTTLMin()
+	if n <= 0 {
+		n = 30
 	}
-	return []byte(s)
+	return time.Duration(n) * time.Minute
 }
 
-// duración del token en horas
-func ttl() time.Duration {
-	h := os.Getenv("JWT_EXPIRES_HOURS")
-	if h == "" {
-		return 12 * time.Hour
-	}
-	n, err := strconv.Atoi(h)
-	if err != nil || n <= 0 {
-		return 12 * time.Hour
+// id aleatorio para el claim jti
+func newJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return time.Duration(n) * time.Hour
+	return hex.EncodeToString(b), nil
 }
 
-// GenerateToken crea un JWT con uid y role, y devuelve el token y su expiración
-func GenerateToken(userID uint, role string) (string, time.Time, error) {
+// GenerateToken crea un JWT con uid, role, sid y perms, y devuelve el token y su expiración
+func GenerateToken(userID uint, role, sessionID string, perms []string) (string, time.Time, error) {
 	now := time.Now()
-	exp := now.Add(ttl())
+	exp := now.Add(TTL())
+	jti, err := newJTI()
+	if err != nil {
+		return "", time.Time{}, err
+	}
 
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		Perms:     perms,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(exp),
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(secret())
+	signed, err := sign(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
 	return signed, exp, nil
 }
 
-// ParseToken valida el JWT y retorna las Claims
+// ParseToken valida el access token contra la clave de su header kid y retorna las Claims
 func ParseToken(tokenStr string) (*Claims, error) {
-	if tokenStr == "" {
-		return nil, errors.New("token vacío")
+	claims := &Claims{}
+	if err := parse(tokenStr, claims); err != nil {
+		return nil, err
+	}
+	// Un token de desafío MFA o un ticket de stream no sirven como access token
+	for _, aud := range claims.Audience {
+		if aud == MFAAudience || aud == StreamAudience {
+			return nil, errors.New("token inválido")
+		}
+	}
+	return claims, nil
+}
+
+/* ===================== Desafío MFA ===================== */
+
+const MFAAudience = "amestris-mfa"
+
+// Propósitos del token de desafío
+const (
+	MFAPurposeLogin  = "login"  // falta el segundo factor
+	MFAPurposeEnroll = "enroll" // el rol exige MFA y aún no está configurado
+)
+
+// MFAClaims: token corto emitido tras validar la contraseña; solo sirve para
+// completar el segundo paso del login.
+type MFAClaims struct {
+	UserID  uint   `json:"uid"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+func GenerateMFAToken(userID uint, purpose string, ttl time.Duration) (string, *MFAClaims, error) {
+	now := time.Now()
+	jti, err := newJTI()
+	if err != nil {
+		return "", nil, err
+	}
+	claims := &MFAClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{MFAAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
 	}
-	tkn, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secret(), nil
-	})
+	signed, err := sign(claims)
 	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+func ParseMFAToken(tokenStr string) (*MFAClaims, error) {
+	claims := &MFAClaims{}
+	if err := parse(tokenStr, claims, jwt.WithAudience(MFAAudience)); err != nil {
 		return nil, err
 	}
-	claims, ok := tkn.Claims.(*Claims)
-	if !ok || !tkn.Valid {
-		return nil, errors.New("token inválido")
+	return claims, nil
+}
+
+/* ===================== Ticket de stream ===================== */
+
+const StreamAudience = "amestris-stream"
+
+// StreamClaims: ticket de un solo uso para abrir /realtime/sse sin cabeceras
+// (EventSource no puede enviar Authorization). Hereda la sesión o la API key
+// con la que se pidió.
+type StreamClaims struct {
+	UserID    uint   `json:"uid"`
+	SessionID string `json:"sid,omitempty"`
+	APIKeyID  uint   `json:"kid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func GenerateStreamTicket(userID uint, sessionID string, apiKeyID uint, ttl time.Duration) (string, *StreamClaims, error) {
+	now := time.Now()
+	jti, err := newJTI()
+	if err != nil {
+		return "", nil, err
+	}
+	claims := &StreamClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		APIKeyID:  apiKeyID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{StreamAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	signed, err := sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+func ParseStreamTicket(tokenStr string) (*StreamClaims, error) {
+	claims := &StreamClaims{}
+	if err := parse(tokenStr, claims, jwt.WithAudience(StreamAudience)); err != nil {
+		return nil, err
 	}
 	return claims, nil
 }
+
+/* ===================== firma / verificación ===================== */
+
+func sign(claims jwt.Claims) (string, error) {
+	ks, err := keys()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(ks.active.method(), claims)
+	token.Header["kid"] = ks.active.Kid
+	return token.SignedString(ks.active.Private)
+}
+
+func parse(tokenStr string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	if tokenStr == "" {
+		return errors.New("token vacío")
+	}
+	ks, err := keys()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}))
+	tkn, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := ks.byKid[kid]
+		if !ok {
+			return nil, fmt.Errorf("kid desconocido %q", kid)
+		}
+		if token.Method.Alg() != k.Alg {
+			return nil, fmt.Errorf("alg %s no corresponde al kid %q", token.Method.Alg(), kid)
+		}
+		return k.Public, nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	if !tkn.Valid {
+		return errors.New("token inválido")
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package jwtutil
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	privSuffix  = ".pem"
+	pubSuffix   = ".pub.pem"
+	activeFile  = "active"
+	pendingFile = "pending" // "<kid> <unix>": publicada y aún sin activar
+
+	// ReloadPeriod: cada cuánto relee cada réplica JWT_KEYS_DIR.
+	ReloadPeriod = time.Minute
+	// JWKSMaxAge: caché de /.well-known/jwks.json en los verificadores.
+	JWKSMaxAge = 5 * time.Minute
+	// ActivationDelay: espera mínima entre publicar una clave y firmar con
+	// ella, para que todas las réplicas y cachés del JWKS ya la conozcan.
+	ActivationDelay = ReloadPeriod + JWKSMaxAge
+)
+
+// Key: clave de firma (Private != nil) o solo de verificación.
+type Key struct {
+	Kid     string
+	Alg     string
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.Alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+type keySet struct {
+	active *Key
+	byKid  map[string]*Key
+}
+
+var (
+	keysMu  sync.RWMutex
+	current *keySet
+	loadErr error
+	once    sync.Once
+)
+
+// KeysDir: directorio de claves (JWT_KEYS_DIR, default ./keys).
+func KeysDir() string {
+	if v := os.Getenv("JWT_KEYS_DIR"); v != "" {
+		return v
+	}
+	return "./keys"
+}
+
+// devMode: APP_ENV=dev|development permite una clave efímera.
+func devMode() bool {
+	switch strings.ToLower(os.Getenv("APP_ENV")) {
+	case "dev", "development":
+		return true
+	}
+	return false
+}
+
+// Init carga las claves de KeysDir y arranca la recarga periódica (para ver
+// las rotaciones sin reiniciar). Fuera de dev falla si no hay clave activa.
+func Init() error {
+	once.Do(func() {
+		ks, err := loadKeySet(KeysDir())
+		if err != nil {
+			if !devMode() {
+				loadErr = fmt.Errorf("sin clave JWT utilizable en %s: %w", KeysDir(), err)
+				return
+			}
+			log.Printf("⚠️  JWT: %v; APP_ENV=dev, se usa una clave Ed25519 efímera", err)
+			ks, loadErr = ephemeralKeySet()
+			if loadErr != nil {
+				return
+			}
+		} else {
+			go reloadLoop(KeysDir())
+		}
+		setKeySet(ks)
+		log.Printf("🔑 JWT: kid activo %s (%s), %d claves de verificación", ks.active.Kid, ks.active.Alg, len(ks.byKid))
+	})
+	return loadErr
+}
+
+func setKeySet(ks *keySet) {
+	keysMu.Lock()
+	current = ks
+	keysMu.Unlock()
+}
+
+func keys() (*keySet, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return current, nil
+}
+
+func reloadLoop(dir string) {
+	t := time.NewTicker(ReloadPeriod)
+	defer t.Stop()
+	for range t.C {
+		ks, err := loadKeySet(dir)
+		if err != nil {
+			log.Printf("warn: recarga de claves JWT: %v", err)
+			continue
+		}
+		// Siempre se reemplaza: retirar una clave y añadir otra en el mismo
+		// periodo deja igual el número de claves, y la retirada (quizá
+		// comprometida) no debe seguir verificando
+		keysMu.RLock()
+		prev := current
+		keysMu.RUnlock()
+		setKeySet(ks)
+		if prev == nil || prev.active.Kid != ks.active.Kid || !slices.Equal(prev.kids(), ks.kids()) {
+			log.Printf("🔑 JWT: claves recargadas, kid activo %s, verificación %v", ks.active.Kid, ks.kids())
+		}
+	}
+}
+
+// kids: kids de verificación ordenados.
+func (ks *keySet) kids() []string {
+	return slices.Sorted(maps.Keys(ks.byKid))
+}
+
+// loadKeySet lee <kid>.pem (privadas) y <kid>.pub.pem (solo verificación).
+// La activa sale de JWT_ACTIVE_KID o del archivo "active"; si no, la privada
+// más reciente que no esté pendiente de activar.
+func loadKeySet(dir string) (*keySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pending, _, _ := ReadPending(dir)
+
+	ks := &keySet{byKid: map[string]*Key{}}
+	var newest string
+	var newestMod time.Time
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, privSuffix) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(name, pubSuffix) {
+			kid := strings.TrimSuffix(name, pubSuffix)
+			if _, ok := ks.byKid[kid]; ok {
+				continue // ya cargada desde la privada
+			}
+			k, err := ParsePublicKeyPEM(kid, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			ks.byKid[kid] = k
+			continue
+		}
+		kid := strings.TrimSuffix(name, privSuffix)
+		k, err := ParsePrivateKeyPEM(kid, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		ks.byKid[kid] = k
+		if kid == pending {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().After(newestMod) {
+			newest, newestMod = kid, info.ModTime()
+		}
+	}
+
+	activeKid := ActiveKid(dir)
+	if activeKid == "" {
+		activeKid = newest
+	}
+	k, ok := ks.byKid[activeKid]
+	if !ok || k.Private == nil {
+		return nil, errors.New("no hay clave privada activa")
+	}
+	ks.active = k
+	return ks, nil
+}
+
+// ReadPending devuelve la clave publicada pendiente de activar y desde cuándo.
+func ReadPending(dir string) (kid string, since time.Time, ok bool) {
+	b, err := os.ReadFile(filepath.Join(dir, pendingFile))
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	f := strings.Fields(string(b))
+	if len(f) != 2 {
+		return "", time.Time{}, false
+	}
+	ts, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return f[0], time.Unix(ts, 0), true
+}
+
+// WritePending marca kid como publicada en since ("" la desmarca).
+func WritePending(dir, kid string, since time.Time) error {
+	path := filepath.Join(dir, pendingFile)
+	if kid == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeAtomic(dir, pendingFile, fmt.Sprintf("%s %d\n", kid, since.Unix()))
+}
+
+// WriteActive fija la clave de firma en el archivo "active".
+func WriteActive(dir, kid string) error {
+	return writeAtomic(dir, activeFile, kid+"\n")
+}
+
+// ActiveKid: kid de JWT_ACTIVE_KID o del archivo "active" ("" si no hay).
+func ActiveKid(dir string) string {
+	if v := strings.TrimSpace(os.Getenv("JWT_ACTIVE_KID")); v != "" {
+		return v
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, activeFile)); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	return ""
+}
+
+func writeAtomic(dir, name, content string) error {
+	tmp := filepath.Join(dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, name))
+}
+
+func ephemeralKeySet() (*keySet, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{Kid: "dev-ephemeral", Alg: AlgEdDSA, Private: priv, Public: priv.Public()}
+	return &keySet{active: k, byKid: map[string]*Key{k.Kid: k}}, nil
+}
+
+/* ===================== PEM ===================== */
+
+// ParsePrivateKeyPEM acepta PKCS#8 (RSA o Ed25519) y PKCS#1 RSA.
+func ParsePrivateKeyPEM(kid string, raw []byte) (*Key, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("PEM inválido")
+	}
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch p := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{Kid: kid, Alg: AlgRS256, Private: p, Public: p.Public()}, nil
+	case ed25519.PrivateKey:
+		return &Key{Kid: kid, Alg: AlgEdDSA, Private: p, Public: p.Public()}, nil
+	}
+	return nil, fmt.Errorf("tipo de clave no soportado %T", parsed)
+}
+
+func ParsePublicKeyPEM(kid string, raw []byte) (*Key, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("PEM inválido")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch p := parsed.(type) {
+	case *rsa.PublicKey:
+		return &Key{Kid: kid, Alg: AlgRS256, Public: p}, nil
+	case ed25519.PublicKey:
+		return &Key{Kid: kid, Alg: AlgEdDSA, Public: p}, nil
+	}
+	return nil, fmt.Errorf("tipo de clave no soportado %T", parsed)
+}
+
+/* ===================== JWKS ===================== */
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS publica todas las claves de verificación (RFC 7517).
+func JWKS() ([]byte, error) {
+	ks, err := keys()
+	if err != nil {
+		return nil, err
+	}
+	kids := make([]string, 0, len(ks.byKid))
+	for kid := range ks.byKid {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	out := struct {
+		Keys []JWK `json:"keys"`
+	}{Keys: []JWK{}}
+	b64 := base64.RawURLEncoding
+	for _, kid := range kids {
+		k := ks.byKid[kid]
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			out.Keys = append(out.Keys, JWK{
+				Kty: "RSA", Kid: kid, Use: "sig", Alg: AlgRS256,
+				N: b64.EncodeToString(pub.N.Bytes()),
+				E: b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			out.Keys = append(out.Keys, JWK{
+				Kty: "OKP", Kid: kid, Use: "sig", Alg: AlgEdDSA,
+				Crv: "Ed25519", X: b64.EncodeToString(pub),
+			})
+		}
+	}
+	return json.Marshal(out)
+}
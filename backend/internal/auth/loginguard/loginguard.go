@@ -0,0 +1,332 @@
+// Package loginguard limita los intentos de login fallidos por cuenta y por IP:
+// retraso progresivo entre intentos y bloqueo temporal al superar un umbral.
+// El estado vive en la tabla login_throttles para compartirse entre réplicas.
+//
+// Cada intento se reserva antes de comprobar la contraseña (Reserve, con las
+// filas bloqueadas) y se liquida al final (Fail, Succeed o Release). Los
+// intentos en curso cuentan como fallos posibles, así que muchas peticiones
+// simultáneas no obtienen más intentos que si llegaran de una en una.
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+// AccountKey / IPKey: claves de login_throttles.
+func AccountKey(email string) string { return "acct:" + strings.ToLower(strings.TrimSpace(email)) }
+func IPKey(ip string) string         { return "ip:" + ip }
+
+// Policy: umbrales leídos de LOGIN_* (ver .env.example).
+type Policy struct {
+	Window     time.Duration // sin fallos durante Window, el contador vuelve a 0
+	DelayAfter int           // fallos de cuenta tolerados antes de exigir espera
+	DelayBase  time.Duration // espera tras el primer fallo extra; se duplica con cada uno
+	DelayMax   time.Duration
+	AcctLockAt int // fallos de cuenta que provocan bloqueo
+	IPLockAt   int // fallos desde una IP que provocan bloqueo
+	LockFor    time.Duration
+	LockForMax time.Duration // los bloqueos repetidos duplican LockFor hasta este tope
+}
+
+func CurrentPolicy() Policy {
+	return Policy{
+		Window:     time.Duration(db.MustGetInt("LOGIN_FAILURE_WINDOW_MIN", 15)) * time.Minute,
+		DelayAfter: db.MustGetInt("LOGIN_DELAY_AFTER", 3),
+		DelayBase:  time.Duration(db.MustGetInt("LOGIN_DELAY_BASE_SEC", 1)) * time.Second,
+		DelayMax:   time.Duration(db.MustGetInt("LOGIN_DELAY_MAX_SEC", 30)) * time.Second,
+		AcctLockAt: db.MustGetInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		IPLockAt:   db.MustGetInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50),
+		LockFor:    time.Duration(db.MustGetInt("LOGIN_LOCKOUT_MIN", 15)) * time.Minute,
+		LockForMax: time.Duration(db.MustGetInt("LOGIN_LOCKOUT_MAX_MIN", 1440)) * time.Minute,
+	}
+}
+
+// Decision: resultado de Reserve. Si !Allowed, RetryAfter indica cuánto esperar.
+type Decision struct {
+	Allowed    bool
+	Locked     bool
+	Key        string
+	RetryAfter time.Duration
+}
+
+// Lockout: bloqueo recién aplicado por Attempt.Fail (para auditar).
+type Lockout struct {
+	Key      string
+	Until    time.Time
+	Failures int
+	Count    int // bloqueos acumulados de la clave
+}
+
+// reservationTTL: una reserva sin liquidar (proceso caído a mitad de un
+// login) deja de contar pasado este tiempo.
+const reservationTTL = time.Minute
+
+// Attempt: intento reservado por Reserve. Se liquida una sola vez; las
+// siguientes llamadas no hacen nada, así que se puede diferir Release.
+type Attempt struct {
+	email, ip string
+	once      sync.Once
+}
+
+type guardKey struct {
+	key    string
+	lockAt int
+	delay  bool
+}
+
+func keysFor(p Policy, email, ip string) []guardKey {
+	// Siempre en este orden (cuenta, IP): los FOR UPDATE no se cruzan
+	return []guardKey{
+		{AccountKey(email), p.AcctLockAt, true},
+		// Sin retraso por IP: castigaría a todos los usuarios detrás de un NAT
+		{IPKey(ip), p.IPLockAt, false},
+	}
+}
+
+// Reserve decide si se puede intentar un login para email desde ip y, si se
+// puede, reserva el intento en la misma transacción. Con Decision.Allowed el
+// Attempt no es nil y hay que liquidarlo.
+func Reserve(ctx context.Context, email, ip string) (Decision, *Attempt, error) {
+	p := CurrentPolicy()
+	now := time.Now()
+	d := Decision{Allowed: true}
+	err := db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows := make([]models.LoginThrottle, 0, 2)
+		for _, k := range keysFor(p, email, ip) {
+			t, err := lockRow(tx, k.key, now)
+			if err != nil {
+				return err
+			}
+			if t.Pending > 0 && (t.ReservedAt == nil || now.Sub(*t.ReservedAt) > reservationTTL) {
+				t.Pending = 0
+			}
+			failures := t.Failures
+			if now.Sub(t.LastFailedAt) > p.Window {
+				failures = 0
+			}
+			d = worst(d, decide(p, k, t, failures, now))
+			rows = append(rows, t)
+		}
+		if !d.Allowed {
+			return nil
+		}
+		for _, t := range rows {
+			if err := tx.Model(&models.LoginThrottle{}).Where("key = ?", t.Key).
+				Updates(map[string]any{"pending": t.Pending + 1, "reserved_at": now}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !d.Allowed {
+		return d, nil, err
+	}
+	return d, &Attempt{email: email, ip: ip}, nil
+}
+
+// decide aplica a una clave el bloqueo, el retraso y los intentos en curso.
+func decide(p Policy, k guardKey, t models.LoginThrottle, failures int, now time.Time) Decision {
+	switch {
+	case t.LockedUntil != nil && now.Before(*t.LockedUntil):
+		return Decision{Locked: true, Key: t.Key, RetryAfter: t.LockedUntil.Sub(now)}
+	case k.delay && t.NextAttemptAt != nil && now.Before(*t.NextAttemptAt):
+		return Decision{Key: t.Key, RetryAfter: t.NextAttemptAt.Sub(now)}
+	// Los intentos en curso podrían llegar al bloqueo si todos fallan
+	case k.lockAt > 0 && failures+t.Pending >= k.lockAt:
+		return Decision{Key: t.Key, RetryAfter: time.Second}
+	// Pasado el margen sin retraso, de uno en uno: el retraso del siguiente
+	// depende del resultado del que está en curso
+	case k.delay && t.Pending > 0 && failures+t.Pending > p.DelayAfter:
+		return Decision{Key: t.Key, RetryAfter: time.Second}
+	}
+	return Decision{Allowed: true}
+}
+
+// worst combina decisiones: gana el bloqueo y, a igualdad, la espera mayor.
+func worst(a, b Decision) Decision {
+	switch {
+	case b.Allowed:
+		return a
+	case a.Allowed:
+		return b
+	case b.Locked != a.Locked:
+		if b.Locked {
+			return b
+		}
+		return a
+	case b.RetryAfter > a.RetryAfter:
+		return b
+	}
+	return a
+}
+
+// lockRow crea la fila si no existe y la bloquea hasta el fin de tx.
+func lockRow(tx *gorm.DB, key string, now time.Time) (models.LoginThrottle, error) {
+	var t models.LoginThrottle
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoginThrottle{Key: key, FirstFailedAt: now, LastFailedAt: now}).Error; err != nil {
+		return t, err
+	}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&t, "key = ?", key).Error
+	return t, err
+}
+
+// Fail liquida el intento como fallido: suma un fallo a la cuenta y a la IP
+// y devuelve los bloqueos que se acaban de aplicar. Se registra aunque el
+// email no exista, para no revelar qué cuentas existen por su comportamiento.
+func (a *Attempt) Fail(ctx context.Context) ([]Lockout, error) {
+	var out []Lockout
+	var err error
+	a.settle(ctx, func(ctx context.Context) {
+		p := CurrentPolicy()
+		err = db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, k := range keysFor(p, a.email, a.ip) {
+				lo, err := fail(tx, p, k.key, k.lockAt, k.delay)
+				if err != nil {
+					return err
+				}
+				if lo != nil {
+					out = append(out, *lo)
+				}
+			}
+			return nil
+		})
+	})
+	return out, err
+}
+
+// Succeed liquida el intento como correcto y limpia el contador de la cuenta.
+// El de la IP se mantiene: si no, bastaría con entrar en una cuenta propia
+// para seguir probando otras.
+func (a *Attempt) Succeed(ctx context.Context) error {
+	var err error
+	a.settle(ctx, func(ctx context.Context) {
+		err = db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("key = ?", AccountKey(a.email)).Delete(&models.LoginThrottle{}).Error; err != nil {
+				return err
+			}
+			return release(tx, IPKey(a.ip))
+		})
+	})
+	return err
+}
+
+// Release libera la reserva sin contar fallo ni acierto (cuenta
+// deshabilitada, desafío MFA pendiente, error interno...).
+func (a *Attempt) Release(ctx context.Context) error {
+	var err error
+	a.settle(ctx, func(ctx context.Context) {
+		err = release(db.Get().WithContext(ctx), AccountKey(a.email), IPKey(a.ip))
+	})
+	return err
+}
+
+// settle ejecuta f una sola vez; sin cancelación, para no dejar la reserva
+// colgada si el cliente corta la conexión.
+func (a *Attempt) settle(ctx context.Context, f func(ctx context.Context)) {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() { f(context.WithoutCancel(ctx)) })
+}
+
+func release(tx *gorm.DB, keys ...string) error {
+	return tx.Model(&models.LoginThrottle{}).Where("key IN ? AND pending > 0", keys).
+		UpdateColumn("pending", gorm.Expr("pending - 1")).Error
+}
+
+func fail(tx *gorm.DB, p Policy, key string, lockAt int, delay bool) (*Lockout, error) {
+	now := time.Now()
+	t, err := lockRow(tx, key, now)
+	if err != nil {
+		return nil, err
+	}
+	if t.Pending > 0 {
+		t.Pending--
+	}
+
+	locked := t.LockedUntil != nil && now.Before(*t.LockedUntil)
+	if !locked && (t.Failures == 0 || now.Sub(t.LastFailedAt) > p.Window) {
+		t.Failures = 0
+		t.FirstFailedAt = now
+	}
+	t.Failures++
+	t.LastFailedAt = now
+	t.NextAttemptAt = nil
+
+	var lo *Lockout
+	switch {
+	case locked:
+		// ya bloqueada: solo se cuenta
+	case lockAt > 0 && t.Failures >= lockAt:
+		t.Lockouts++
+		d := p.LockFor
+		for i := 1; i < t.Lockouts && d < p.LockForMax; i++ {
+			d *= 2
+		}
+		if p.LockForMax > 0 && d > p.LockForMax {
+			d = p.LockForMax
+		}
+		until := now.Add(d)
+		t.LockedUntil = &until
+		lo = &Lockout{Key: key, Until: until, Failures: t.Failures, Count: t.Lockouts}
+		t.Failures = 0
+	case delay && t.Failures > p.DelayAfter:
+		d := p.DelayBase
+		for i := p.DelayAfter + 1; i < t.Failures && d < p.DelayMax; i++ {
+			d *= 2
+		}
+		if d > p.DelayMax {
+			d = p.DelayMax
+		}
+		next := now.Add(d)
+		t.NextAttemptAt = &next
+	}
+
+	return lo, tx.Save(&t).Error
+}
+
+var ErrNotLocked = errors.New("no hay bloqueo para esa clave")
+
+// Unlock elimina el contador y el bloqueo de una clave.
+func Unlock(ctx context.Context, key string) error {
+	res := db.Get().WithContext(ctx).Where("key = ?", key).Delete(&models.LoginThrottle{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotLocked
+	}
+	return nil
+}
+
+// ActiveLockouts lista las claves bloqueadas en este momento.
+func ActiveLockouts(ctx context.Context) ([]models.LoginThrottle, error) {
+	var list []models.LoginThrottle
+	err := db.Get().WithContext(ctx).
+		Where("locked_until > ?", time.Now()).
+		Order("locked_until DESC").
+		Find(&list).Error
+	return list, err
+}
+
+// Purge borra contadores inactivos, sin bloqueo vigente ni intentos en
+// curso; lo usa el worker.
+func Purge(ctx context.Context) (int64, error) {
+	now := time.Now()
+	res := db.Get().WithContext(ctx).
+		Where("last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-CurrentPolicy().Window), now).
+		Where("pending = 0 OR reserved_at IS NULL OR reserved_at < ?", now.Add(-reservationTTL)).
+		Delete(&models.LoginThrottle{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,129 @@
+package loginguard
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+func TestDecideCuentaIntentosEnCurso(t *testing.T) {
+	p := Policy{DelayAfter: 3, AcctLockAt: 10}
+	acct := guardKey{key: "acct:x", lockAt: p.AcctLockAt, delay: true}
+	ip := guardKey{key: "ip:x", lockAt: 50}
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	cases := []struct {
+		name     string
+		k        guardKey
+		t        models.LoginThrottle
+		failures int
+		allowed  bool
+		locked   bool
+	}{
+		{"limpia", acct, models.LoginThrottle{}, 0, true, false},
+		{"bloqueada", acct, models.LoginThrottle{LockedUntil: &later}, 0, false, true},
+		{"en espera", acct, models.LoginThrottle{NextAttemptAt: &later}, 4, false, false},
+		{"la IP no espera", ip, models.LoginThrottle{NextAttemptAt: &later}, 4, true, false},
+		{"último intento libre", acct, models.LoginThrottle{}, 9, true, false},
+		{"el bloqueo ya está reservado", acct, models.LoginThrottle{Pending: 1}, 9, false, false},
+		{"margen sin retraso", acct, models.LoginThrottle{Pending: 3}, 0, true, false},
+		{"pasado el margen, de uno en uno", acct, models.LoginThrottle{Pending: 1}, 3, false, false},
+		{"pasado el margen, sin nadie en curso", acct, models.LoginThrottle{}, 5, true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.t.Key = c.k.key
+			d := decide(p, c.k, c.t, c.failures, now)
+			if d.Allowed != c.allowed || d.Locked != c.locked {
+				t.Fatalf("decide = %+v, quería allowed=%v locked=%v", d, c.allowed, c.locked)
+			}
+			if !d.Allowed && d.RetryAfter <= 0 {
+				t.Fatalf("denegado sin RetryAfter: %+v", d)
+			}
+		})
+	}
+}
+
+func TestWorstPrefiereBloqueo(t *testing.T) {
+	wait := Decision{Key: "acct:x", RetryAfter: time.Hour}
+	lock := Decision{Locked: true, Key: "ip:x", RetryAfter: time.Minute}
+	if got := worst(worst(Decision{Allowed: true}, wait), lock); got != lock {
+		t.Fatalf("worst = %+v, quería el bloqueo", got)
+	}
+	if got := worst(lock, Decision{Allowed: true}); got != lock {
+		t.Fatalf("worst = %+v", got)
+	}
+}
+
+// Contra la base (TEST_DB_DSN): muchas peticiones simultáneas no consiguen
+// más intentos que el umbral de bloqueo.
+func TestReserveConcurrente(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN no definido")
+	}
+	t.Setenv("DB_DSN", dsn)
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "5")
+	t.Setenv("LOGIN_DELAY_AFTER", "100")
+	if err := db.Connect(); err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	ctx := context.Background()
+	email, ip := "carrera@amestris.test", "198.51.100.77"
+	cleanup := func() {
+		db.Get().Where("key IN ?", []string{AccountKey(email), IPKey(ip)}).Delete(&models.LoginThrottle{})
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		attempts []*Attempt
+	)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, att, err := Reserve(ctx, email, ip)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if d.Allowed {
+				mu.Lock()
+				attempts = append(attempts, att)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(attempts) != 5 {
+		t.Fatalf("reservas concedidas = %d, quería 5", len(attempts))
+	}
+
+	var lockouts int
+	for _, att := range attempts {
+		lo, err := att.Fail(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lockouts += len(lo)
+		// Liquidar dos veces no cuenta dos fallos
+		if _, err := att.Fail(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lockouts != 1 {
+		t.Fatalf("bloqueos = %d, quería 1", lockouts)
+	}
+	if d, _, err := Reserve(ctx, email, ip); err != nil || d.Allowed || !d.Locked {
+		t.Fatalf("tras el bloqueo: %+v %v", d, err)
+	}
+}
@@ -0,0 +1,316 @@
+// Package oidc es un cliente mínimo de OpenID Connect (authorization code +
+// PKCE S256) para el login SSO: discovery, intercambio del código y
+// verificación del id_token contra el JWKS del proveedor.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDisabled = errors.New("SSO no configurado")
+	ErrIDToken  = errors.New("id_token inválido")
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // vacío = cliente público (solo PKCE)
+	RedirectURL  string
+	Scopes       []string
+}
+
+// ConfigFromEnv lee OIDC_*; ok=false si falta OIDC_ISSUER u OIDC_CLIENT_ID.
+func ConfigFromEnv(defaultRedirect string) (Config, bool) {
+	c := Config{
+		Issuer:       strings.TrimRight(strings.TrimSpace(os.Getenv("OIDC_ISSUER")), "/"),
+		ClientID:     strings.TrimSpace(os.Getenv("OIDC_CLIENT_ID")),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  strings.TrimSpace(os.Getenv("OIDC_REDIRECT_URL")),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}
+	if c.RedirectURL == "" {
+		c.RedirectURL = defaultRedirect
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "email", "profile"}
+	}
+	return c, c.Issuer != "" && c.ClientID != ""
+}
+
+// metadata: campos usados de /.well-known/openid-configuration
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	cfg    Config
+	meta   metadata
+	client *http.Client
+
+	mu     sync.Mutex
+	keys   map[string]any
+	keysAt time.Time
+}
+
+var (
+	provMu sync.Mutex
+	prov   *Provider
+)
+
+// Get devuelve el proveedor configurado; el discovery se hace en el primer
+// uso y se reintenta en la siguiente llamada si falla.
+func Get(ctx context.Context, cfg Config) (*Provider, error) {
+	provMu.Lock()
+	defer provMu.Unlock()
+	if prov != nil && prov.cfg.Issuer == cfg.Issuer && prov.cfg.ClientID == cfg.ClientID {
+		return prov, nil
+	}
+	p, err := Discover(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	prov = p
+	return p, nil
+}
+
+func Discover(ctx context.Context, cfg Config) (*Provider, error) {
+	p := &Provider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+	if err := p.getJSON(ctx, cfg.Issuer+"/.well-known/openid-configuration", &p.meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(p.meta.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q no coincide con %q", p.meta.Issuer, cfg.Issuer)
+	}
+	if p.meta.AuthorizationEndpoint == "" || p.meta.TokenEndpoint == "" || p.meta.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: faltan endpoints")
+	}
+	return p, nil
+}
+
+/* ===================== PKCE ===================== */
+
+// PKCE genera code_verifier y su code_challenge S256 (RFC 7636).
+func PKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	return verifier, Challenge(verifier), nil
+}
+
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+/* ===================== Flujo ===================== */
+
+// AuthURL: URL del proveedor a la que se envía el navegador.
+func (p *Provider) AuthURL(state, nonce, challenge string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.meta.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// IDToken: claims del id_token ya verificado.
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Nonce         string
+	Claims        jwt.MapClaims
+}
+
+// Strings devuelve un claim de lista (p. ej. groups); acepta también un string suelto.
+func (t *IDToken) Strings(claim string) []string {
+	switch v := t.Claims[claim].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Exchange canjea el código en el token endpoint y verifica el id_token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*IDToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token: %w", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+
+	var tok struct {
+		IDToken   string `json:"id_token"`
+		Error     string `json:"error"`
+		ErrorDesc string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &tok)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token: %d %s %s", res.StatusCode, tok.Error, tok.ErrorDesc)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("oidc token: respuesta sin id_token")
+	}
+	return p.Verify(ctx, tok.IDToken)
+}
+
+// Verify comprueba firma (JWKS), iss, aud y exp del id_token.
+func (p *Provider) Verify(ctx context.Context, raw string) (*IDToken, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDToken, err)
+	}
+
+	t := &IDToken{Claims: claims}
+	t.Subject, _ = claims["sub"].(string)
+	t.Email, _ = claims["email"].(string)
+	t.Name, _ = claims["name"].(string)
+	t.Nonce, _ = claims["nonce"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		t.EmailVerified = v
+	case string:
+		t.EmailVerified = v == "true"
+	}
+	if t.Subject == "" {
+		return nil, fmt.Errorf("%w: sin sub", ErrIDToken)
+	}
+	return t, nil
+}
+
+/* ===================== JWKS ===================== */
+
+// key busca kid en el JWKS cacheado; ante un kid desconocido (rotación en el
+// proveedor) recarga el JWKS, como mucho una vez por minuto.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	k, ok := p.lookup(kid)
+	stale := time.Since(p.keysAt) > time.Minute
+	p.mu.Unlock()
+	if ok {
+		return k, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("kid %q desconocido", kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]any{}
+	for _, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		pub, err := j.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[j.Kid] = pub
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.keysAt = keys, time.Now()
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("kid %q desconocido", kid)
+}
+
+// lookup: sin kid solo vale si el JWKS tiene una única clave.
+func (p *Provider) lookup(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(out)
+}
@@ -0,0 +1,157 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"amestris/backend/internal/auth/oidc"
+	"amestris/backend/internal/auth/oidc/oidctest"
+)
+
+var roy = oidctest.User{
+	Sub:           "sub-roy",
+	Email:         "roy@amestris.gov",
+	EmailVerified: true,
+	Name:          "Roy Mustang",
+	Groups:        []string{"amestris-supervisors"},
+}
+
+func discover(t *testing.T, idp *oidctest.Server) *oidc.Provider {
+	t.Helper()
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      idp.Issuer,
+		ClientID:    oidctest.ClientID,
+		RedirectURL: "http://frontend.test/login/sso",
+		Scopes:      []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	return p
+}
+
+// authorize recorre /authorize como el navegador y devuelve code y verifier.
+func authorize(t *testing.T, idp *oidctest.Server, p *oidc.Provider, state, nonce string) (string, string) {
+	t.Helper()
+	verifier, challenge, err := oidc.PKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, gotState, err := idp.Authorize(p.AuthURL(state, nonce, challenge), roy.Email)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if gotState != state {
+		t.Fatalf("state = %q, quería %q", gotState, state)
+	}
+	return code, verifier
+}
+
+func TestFlujoCompleto(t *testing.T) {
+	idp := oidctest.New(t, roy)
+	p := discover(t, idp)
+
+	authURL, err := url.Parse(p.AuthURL("st", "nonce-1", oidc.Challenge("v")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authURL.Query()
+	for k, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             oidctest.ClientID,
+		"redirect_uri":          "http://frontend.test/login/sso",
+		"scope":                 "openid email",
+		"state":                 "st",
+		"nonce":                 "nonce-1",
+		"code_challenge":        oidc.Challenge("v"),
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(k); got != want {
+			t.Errorf("AuthURL %s = %q, quería %q", k, got, want)
+		}
+	}
+
+	code, verifier := authorize(t, idp, p, "state-1", "nonce-1")
+	idt, err := p.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if idt.Subject != roy.Sub || idt.Email != roy.Email || !idt.EmailVerified || idt.Nonce != "nonce-1" {
+		t.Fatalf("id_token inesperado: %+v", idt)
+	}
+	if g := idt.Strings("groups"); len(g) != 1 || g[0] != "amestris-supervisors" {
+		t.Fatalf("groups = %v", g)
+	}
+
+	// El code es de un solo uso
+	if _, err := p.Exchange(context.Background(), code, verifier); err == nil {
+		t.Fatal("el mismo code se canjeó dos veces")
+	}
+}
+
+func TestExchangeVerifierIncorrecto(t *testing.T) {
+	idp := oidctest.New(t, roy)
+	p := discover(t, idp)
+	code, _ := authorize(t, idp, p, "s", "n")
+	other, _, _ := oidc.PKCE()
+	if _, err := p.Exchange(context.Background(), code, other); err == nil {
+		t.Fatal("el proveedor aceptó un code_verifier que no corresponde al challenge")
+	}
+}
+
+func TestExchangeIDTokenInvalido(t *testing.T) {
+	cases := map[string]func(jwt.MapClaims){
+		"aud ajena": func(c jwt.MapClaims) { c["aud"] = "otro-cliente" },
+		"iss ajeno": func(c jwt.MapClaims) { c["iss"] = "https://evil.test" },
+		"expirado":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"sin exp":   func(c jwt.MapClaims) { delete(c, "exp") },
+		"sin sub":   func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+	for name, tamper := range cases {
+		t.Run(name, func(t *testing.T) {
+			idp := oidctest.New(t, roy)
+			idp.Tamper = tamper
+			p := discover(t, idp)
+			code, verifier := authorize(t, idp, p, "s", "n")
+			if _, err := p.Exchange(context.Background(), code, verifier); !errors.Is(err, oidc.ErrIDToken) {
+				t.Fatalf("err = %v, quería ErrIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyFirmaAjena(t *testing.T) {
+	idp := oidctest.New(t, roy)
+	p := discover(t, idp)
+
+	// Mismo kid e issuer, pero firmado con la clave de otro proveedor
+	other := oidctest.New(t)
+	other.Kid = idp.Kid
+	raw, err := other.Sign(jwt.MapClaims{
+		"iss": idp.Issuer,
+		"aud": oidctest.ClientID,
+		"sub": roy.Sub,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(context.Background(), raw); !errors.Is(err, oidc.ErrIDToken) {
+		t.Fatalf("err = %v, quería ErrIDToken", err)
+	}
+}
+
+func TestDiscoveryIssuerDistinto(t *testing.T) {
+	idp := oidctest.New(t, roy)
+	// El discovery anuncia un issuer distinto del configurado
+	idp.Issuer = "https://otro-issuer.test"
+	_, err := oidc.Discover(context.Background(), oidc.Config{Issuer: idp.URL, ClientID: oidctest.ClientID})
+	if err == nil {
+		t.Fatal("discovery aceptó un issuer distinto del configurado")
+	}
+}
@@ -0,0 +1,227 @@
+// Package oidctest levanta un proveedor OpenID Connect en memoria
+// (httptest) para los tests del login SSO: discovery, /authorize con PKCE
+// S256, /token y JWKS, con los mismos chequeos que cmd/mockidp.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const ClientID = "amestris-test"
+
+// ErrNoCode: el proveedor volvió sin code.
+var ErrNoCode = errors.New("oidctest: respuesta sin code")
+
+type User struct {
+	Sub           string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+type grant struct {
+	user      User
+	redirect  string
+	nonce     string
+	challenge string
+}
+
+type Server struct {
+	*httptest.Server
+	Issuer string
+	Kid    string
+	Key    *rsa.PrivateKey
+
+	// Tamper, si se define, modifica los claims del id_token antes de firmarlo.
+	Tamper func(jwt.MapClaims)
+
+	mu     sync.Mutex
+	users  map[string]User
+	grants map[string]grant
+}
+
+// New arranca el proveedor con los usuarios dados; se cierra al acabar el test.
+func New(t testing.TB, users ...User) *Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("clave RSA: %v", err)
+	}
+	s := &Server{Kid: "test-" + randHex(4), Key: key, users: map[string]User{}, grants: map[string]grant{}}
+	for _, u := range users {
+		s.users[strings.ToLower(u.Email)] = u
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+	s.Issuer = s.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Authorize simula al navegador en el proveedor: sigue authURL como
+// login_hint y devuelve el code y el state con los que vuelve al redirect_uri.
+func (s *Server) Authorize(authURL, loginHint string) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	q.Set("login_hint", loginHint)
+	u.RawQuery = q.Encode()
+
+	c := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := c.Get(u.String())
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		return "", "", fmt.Errorf("authorize: %s", res.Status)
+	}
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+	if back.Query().Get("code") == "" {
+		return "", "", ErrNoCode
+	}
+	return back.Query().Get("code"), back.Query().Get("state"), nil
+}
+
+// Sign firma claims arbitrarios con la clave del proveedor (id_token a medida).
+func (s *Server) Sign(claims jwt.MapClaims) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = s.Kid
+	return t.SignedString(s.Key)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 s.Issuer,
+		"authorization_endpoint": s.Issuer + "/authorize",
+		"token_endpoint":         s.Issuer + "/token",
+		"jwks_uri":               s.Issuer + "/jwks",
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("response_type") != "code", q.Get("client_id") != ClientID, q.Get("redirect_uri") == "":
+		http.Error(w, "petición de autorización inválida", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE S256 obligatorio", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	u, ok := s.users[strings.ToLower(q.Get("login_hint"))]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "usuario desconocido", http.StatusBadRequest)
+		return
+	}
+
+	code := randHex(16)
+	s.mu.Lock()
+	s.grants[code] = grant{user: u, redirect: q.Get("redirect_uri"), nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	s.mu.Unlock()
+
+	back, _ := url.Parse(q.Get("redirect_uri"))
+	bq := back.Query()
+	bq.Set("code", code)
+	bq.Set("state", q.Get("state"))
+	back.RawQuery = bq.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	if r.PostForm.Get("client_id") != ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || g.redirect != r.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.Issuer,
+		"sub":            g.user.Sub,
+		"aud":            ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"name":           g.user.Name,
+		"groups":         g.user.Groups,
+		"nonce":          g.nonce,
+	}
+	if s.Tamper != nil {
+		s.Tamper(claims)
+	}
+	idToken, err := s.Sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"access_token": randHex(16), "token_type": "Bearer", "id_token": idToken})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, _ *http.Request) {
+	pub := s.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": s.Kid,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,38 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// Postgres guarda las revocaciones en la tabla revoked_tokens.
+type Postgres struct{}
+
+func NewPostgres() Postgres { return Postgres{} }
+
+func (Postgres) Revoke(ctx context.Context, key string, until time.Time) error {
+	row := models.RevokedToken{Key: key, ExpiresAt: until}
+	return db.Get().WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]any{"expires_at": until}),
+	}).Create(&row).Error
+}
+
+func (Postgres) IsRevoked(ctx context.Context, key string) (bool, error) {
+	var n int64
+	err := db.Get().WithContext(ctx).Model(&models.RevokedToken{}).
+		Where("key = ? AND expires_at > ?", key, time.Now()).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// PurgeExpired borra las revocaciones vencidas; lo usa el scheduler del worker.
+func PurgeExpired(ctx context.Context) (int64, error) {
+	res := db.Get().WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.RevokedToken{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,34 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"amestris/backend/internal/queue"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisPrefix = "revoked:"
+
+// Redis guarda cada revocación como clave con TTL: expira sola.
+type Redis struct {
+	rdb *redis.Client
+}
+
+func NewRedis() *Redis {
+	return &Redis{rdb: redis.NewClient(&redis.Options{Addr: queue.RedisAddr()})}
+}
+
+func (r *Redis) Revoke(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.rdb.Set(ctx, redisPrefix+key, 1, ttl).Err()
+}
+
+func (r *Redis) IsRevoked(ctx context.Context, key string) (bool, error) {
+	n, err := r.rdb.Exists(ctx, redisPrefix+key).Result()
+	return n > 0, err
+}
@@ -0,0 +1,148 @@
+package revocation
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"amestris/backend/internal/db"
+)
+
+// Store: lista de revocación de access tokens. Las claves expiran solas
+// cuando ya no hay tokens vivos que puedan usarlas.
+type Store interface {
+	Revoke(ctx context.Context, key string, until time.Time) error
+	IsRevoked(ctx context.Context, key string) (bool, error)
+}
+
+// JTIKey / SessionKey: claves para un token concreto o una sesión entera.
+func JTIKey(jti string) string     { return "jti:" + jti }
+func SessionKey(sid string) string { return "sid:" + sid }
+
+var (
+	mu    sync.RWMutex
+	store Store
+)
+
+// Setup elige el backend con TOKEN_REVOCATION_BACKEND=postgres (default) | redis.
+func Setup() {
+	var s Store
+	switch strings.ToLower(os.Getenv("TOKEN_REVOCATION_BACKEND")) {
+	case "redis":
+		s = NewRedis()
+		log.Println("🔒 Revocación de tokens en Redis")
+	default:
+		s = NewPostgres()
+		log.Println("🔒 Revocación de tokens en PostgreSQL")
+	}
+	SetStore(NewCached(s, time.Duration(db.MustGetInt("TOKEN_REVOCATION_CACHE_SEC", 5))*time.Second))
+}
+
+func SetStore(s Store) {
+	mu.Lock()
+	store = s
+	mu.Unlock()
+}
+
+// Default devuelve el store global (Postgres con caché si no se llamó Setup).
+func Default() Store {
+	mu.RLock()
+	s := store
+	mu.RUnlock()
+	if s != nil {
+		return s
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if store == nil {
+		store = NewCached(NewPostgres(), 5*time.Second)
+	}
+	return store
+}
+
+// Revoke / IsRevoked sobre el store global.
+func Revoke(ctx context.Context, key string, until time.Time) error {
+	return Default().Revoke(ctx, key, until)
+}
+
+func IsRevoked(ctx context.Context, key string) (bool, error) {
+	return Default().IsRevoked(ctx, key)
+}
+
+/* ===================== Caché en memoria ===================== */
+
+const revokedCacheTTL = 10 * time.Minute
+
+type cacheEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+// Cached guarda en memoria las consultas: las revocaciones hasta que expiran
+// y los "no revocado" durante ttl. Con varias réplicas, una revocación hecha
+// en otra puede tardar hasta ttl en verse aquí.
+type Cached struct {
+	inner Store
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	lastGC  time.Time
+}
+
+func NewCached(inner Store, ttl time.Duration) *Cached {
+	return &Cached{inner: inner, ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+func (c *Cached) Revoke(ctx context.Context, key string, until time.Time) error {
+	if err := c.inner.Revoke(ctx, key, until); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{revoked: true, until: until}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Cached) IsRevoked(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.until) {
+		c.mu.Unlock()
+		return e.revoked, nil
+	}
+	c.gc(now)
+	c.mu.Unlock()
+
+	revoked, err := c.inner.IsRevoked(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	// Una revocación no se deshace: se puede recordar más tiempo
+	until := now.Add(c.ttl)
+	if revoked {
+		until = now.Add(revokedCacheTTL)
+	}
+	if c.ttl > 0 || revoked {
+		c.mu.Lock()
+		c.entries[key] = cacheEntry{revoked: revoked, until: until}
+		c.mu.Unlock()
+	}
+	return revoked, nil
+}
+
+// gc limpia entradas vencidas como mucho una vez por minuto (requiere c.mu).
+func (c *Cached) gc(now time.Time) {
+	if now.Sub(c.lastGC) < time.Minute {
+		return
+	}
+	c.lastGC = now
+	for k, e := range c.entries {
+		if !now.Before(e.until) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package totp implementa códigos de un solo uso RFC 6238 (HMAC-SHA1, 6
+// dígitos, pasos de 30 s), compatibles con Google Authenticator, Authy, etc.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 // segundos
+	// Skew: pasos aceptados antes/después del actual (desfase de reloj)
+	Skew = 1
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret devuelve un secreto aleatorio de 160 bits en base32.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// Step: contador de pasos para el instante t.
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// CodeAt calcula el código del paso indicado.
+func CodeAt(secret string, step int64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", bin%1000000), nil
+}
+
+// Validate comprueba code en la ventana ±Skew alrededor de now y devuelve el
+// paso que coincidió, para que el llamador rechace reusar ese mismo paso.
+func Validate(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+	cur := Step(now)
+	for d := int64(-Skew); d <= Skew; d++ {
+		want, err := CodeAt(secret, cur+d)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return cur + d, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI: otpauth:// para el QR de la app autenticadora.
+func ProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(Period))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
@@ -0,0 +1,97 @@
+// Package authz resuelve los permisos de cada rol. Los roles y su lista de
+// permisos viven en la base de datos (editables por API); el catálogo de
+// permisos es fijo porque cada uno se corresponde con rutas del código.
+package authz
+
+// Permisos conocidos (recurso:acción).
+const (
+	MaterialsRead  = "materials:read"
+	MaterialsWrite = "materials:write"
+
+	MissionsRead    = "missions:read"
+	MissionsWrite   = "missions:write"
+	MissionsApprove = "missions:approve" // pasar a APPROVED / REJECTED
+
+	TransmutationsRead  = "transmutations:read"
+	TransmutationsWrite = "transmutations:write"
+	TransmutationsAny   = "transmutations:any" // actuar como cualquier alquimista, sin límite de rareza
+
+	AlchemistsRead  = "alchemists:read"
+	AlchemistsWrite = "alchemists:write"
+	AlchemistsRank  = "alchemists:rank"
+
+	AuditsRead = "audits:read"
+
+	UsersRead   = "users:read"
+	UsersWrite  = "users:write"
+	Invitations = "invitations:manage"
+	Security    = "security:manage" // bloqueos de login, reset de MFA
+	Scheduler   = "scheduler:manage"
+	RolesManage = "roles:manage"
+	APIKeys     = "apikeys:manage" // keys de servicio y de otros usuarios
+	Webhooks    = "webhooks:manage"
+)
+
+type PermissionDef struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// Catalog: todos los permisos asignables, en el orden en que se listan.
+var Catalog = []PermissionDef{
+	{MaterialsRead, "Ver materiales"},
+	{MaterialsWrite, "Crear, editar y eliminar materiales"},
+	{MissionsRead, "Ver misiones, calendario y misiones estancadas"},
+	{MissionsWrite, "Crear, editar, eliminar y autoasignar misiones"},
+	{MissionsApprove, "Aprobar o rechazar misiones"},
+	{TransmutationsRead, "Ver transmutaciones"},
+	{TransmutationsWrite, "Registrar, editar y encolar transmutaciones"},
+	{TransmutationsAny, "Transmutar en nombre de cualquier alquimista y sin límite de rareza"},
+	{AlchemistsRead, "Ver alquimistas, carga de trabajo e historial de rango"},
+	{AlchemistsWrite, "Crear, editar y eliminar alquimistas; tokens de calendario"},
+	{AlchemistsRank, "Cambiar el rango de un alquimista"},
+	{AuditsRead, "Ver la auditoría"},
+	{UsersRead, "Ver usuarios"},
+	{UsersWrite, "Cambiar rol, deshabilitar, habilitar y eliminar usuarios"},
+	{Invitations, "Gestionar invitaciones"},
+	{Security, "Gestionar bloqueos de login y restablecer MFA"},
+	{Scheduler, "Gestionar los jobs programados"},
+	{RolesManage, "Crear y editar roles y sus permisos"},
+	{APIKeys, "Crear y revocar API keys de servicio y de cualquier usuario"},
+	{Webhooks, "Gestionar webhooks salientes y reenviar entregas"},
+}
+
+func Known(key string) bool {
+	for _, p := range Catalog {
+		if p.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles de sistema: se crean si no existen y no se pueden eliminar.
+const (
+	RoleSupervisor = "SUPERVISOR"
+	RoleAlchemist  = "ALCHEMIST"
+)
+
+// DefaultRoles: permisos iniciales de los roles de sistema; equivalen a lo que
+// antes daba RequireRoleMW("SUPERVISOR") y a las rutas comunes.
+var DefaultRoles = map[string][]string{
+	RoleSupervisor: allKeys(),
+	RoleAlchemist: {
+		MaterialsRead,
+		MissionsRead,
+		TransmutationsRead,
+		TransmutationsWrite,
+	},
+}
+
+func allKeys() []string {
+	out := make([]string, len(Catalog))
+	for i, p := range Catalog {
+		out[i] = p.Key
+	}
+	return out
+}
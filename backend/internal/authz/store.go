@@ -0,0 +1,194 @@
+package authz
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+// Set: permisos efectivos de un rol.
+type Set map[string]struct{}
+
+func (s Set) Has(perm string) bool {
+	_, ok := s[perm]
+	return ok
+}
+
+func (s Set) Keys() []string {
+	out := make([]string, 0, len(s))
+	for k := range s {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Intersect: permisos de s que además están en keys (scopes de una API key).
+func (s Set) Intersect(keys []string) Set {
+	out := make(Set, len(keys))
+	for _, k := range keys {
+		if s.Has(k) {
+			out[k] = struct{}{}
+		}
+	}
+	return out
+}
+
+// NormalizeRole: los nombres de rol se guardan en mayúsculas.
+func NormalizeRole(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+/* ===================== Caché ===================== */
+
+type cachedRole struct {
+	perms    Set
+	loadedAt time.Time
+}
+
+var (
+	cacheMu sync.RWMutex
+	cache   = map[string]cachedRole{}
+)
+
+// cacheTTL: con varias réplicas, un cambio hecho en otra tarda hasta esto en verse (AUTHZ_CACHE_SEC).
+func cacheTTL() time.Duration {
+	return time.Duration(db.MustGetInt("AUTHZ_CACHE_SEC", 30)) * time.Second
+}
+
+// Invalidate vacía la caché local; se llama tras editar roles.
+func Invalidate() {
+	cacheMu.Lock()
+	cache = map[string]cachedRole{}
+	cacheMu.Unlock()
+}
+
+// ForRole devuelve los permisos del rol (vacío si el rol no existe).
+func ForRole(ctx context.Context, role string) (Set, error) {
+	role = NormalizeRole(role)
+	cacheMu.RLock()
+	c, ok := cache[role]
+	cacheMu.RUnlock()
+	if ok && time.Since(c.loadedAt) < cacheTTL() {
+		return c.perms, nil
+	}
+
+	var keys []string
+	if err := db.Get().WithContext(ctx).
+		Table("role_permissions").
+		Where("role_name = ?", role).
+		Pluck("permission_key", &keys).Error; err != nil {
+		return nil, err
+	}
+	perms := make(Set, len(keys))
+	for _, k := range keys {
+		perms[k] = struct{}{}
+	}
+
+	cacheMu.Lock()
+	cache[role] = cachedRole{perms: perms, loadedAt: time.Now()}
+	cacheMu.Unlock()
+	return perms, nil
+}
+
+// RoleHas: atajo para comprobaciones dentro de handlers; un error cuenta como "no".
+func RoleHas(ctx context.Context, role, perm string) bool {
+	perms, err := ForRole(ctx, role)
+	if err != nil {
+		log.Printf("❌ authz: permisos de %s: %v", role, err)
+		return false
+	}
+	return perms.Has(perm)
+}
+
+// RoleExists indica si el rol está definido y devuelve su nombre normalizado.
+func RoleExists(ctx context.Context, name string) (string, bool, error) {
+	name = NormalizeRole(name)
+	if name == "" {
+		return "", false, nil
+	}
+	var n int64
+	err := db.Get().WithContext(ctx).Model(&models.Role{}).Where("name = ?", name).Count(&n).Error
+	return name, n > 0, err
+}
+
+// RolesWith: roles que incluyen el permiso (para no dejar el sistema sin administradores).
+func RolesWith(tx *gorm.DB, perm string) ([]string, error) {
+	var roles []string
+	err := tx.Table("role_permissions").Where("permission_key = ?", perm).Pluck("role_name", &roles).Error
+	return roles, err
+}
+
+/* ===================== Seed ===================== */
+
+// Seed sincroniza el catálogo de permisos y crea los roles de sistema que
+// falten con sus permisos por defecto. A los roles de sistema ya existentes
+// solo se les añaden los permisos nuevos del catálogo que les correspondan.
+func Seed(ctx context.Context) error {
+	return db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []string
+		if err := tx.Model(&models.Permission{}).Pluck("key", &existing).Error; err != nil {
+			return err
+		}
+		known := make(Set, len(existing))
+		for _, k := range existing {
+			known[k] = struct{}{}
+		}
+
+		for _, p := range Catalog {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"description"}),
+			}).Create(&models.Permission{Key: p.Key, Description: p.Description}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, name := range []string{RoleSupervisor, RoleAlchemist} {
+			var n int64
+			if err := tx.Model(&models.Role{}).Where("name = ?", name).Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 0 {
+				if err := grantNew(tx, name, known); err != nil {
+					return err
+				}
+				continue
+			}
+			role := models.Role{Name: name, Builtin: true, Description: "Rol de sistema"}
+			for _, k := range DefaultRoles[name] {
+				role.Permissions = append(role.Permissions, models.Permission{Key: k})
+			}
+			if err := tx.Omit("Permissions.*").Create(&role).Error; err != nil {
+				return err
+			}
+			log.Printf("🔐 Rol %s creado con %d permisos", name, len(role.Permissions))
+		}
+		return nil
+	})
+}
+
+// grantNew añade al rol de sistema los permisos por defecto que no existían
+// en el catálogo antes de este arranque.
+func grantNew(tx *gorm.DB, role string, known Set) error {
+	for _, k := range DefaultRoles[role] {
+		if known.Has(k) {
+			continue
+		}
+		if err := tx.Table("role_permissions").Clauses(clause.OnConflict{DoNothing: true}).
+			Create(map[string]any{"role_name": role, "permission_key": k}).Error; err != nil {
+			return err
+		}
+		log.Printf("🔐 Permiso %s añadido al rol %s", k, role)
+	}
+	return nil
+}
@@ -58,6 +58,24 @@ func Connect() error {
 		&models.Transmutation{},
 		&models.Audit{},
 		&models.RefreshToken{},
+		&models.ScheduledJob{},
+		&models.RankChange{},
+		&models.Invitation{},
+		&models.PasswordReset{},
+		&models.AuthSession{},
+		&models.RevokedToken{},
+		&models.LoginThrottle{},
+		&models.UserMFA{},
+		&models.MFARecoveryCode{},
+		&models.Permission{},
+		&models.Role{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.OIDCState{},
+		&models.OutboxMessage{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.IdempotencyKey{},
 	); err != nil {
 		log.Printf("❌ Error en migraciones: %v\n", err)
 		return err
@@ -2,15 +2,46 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"amestris/backend/internal/async"
 	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+/* ===== DTOs de entrada ===== */
+type alchemistCreateReq struct {
+	Name      string  `json:"name"`
+	Rank      *string `json:"rank"`
+	Specialty string  `json:"specialty"`
+	Capacity  int     `json:"capacity"`
+	UserID    *uint   `json:"userId"`
+}
+
+// El rango no se edita aquí: usar POST /alchemists/{id}/rank
+type alchemistUpdateReq struct {
+	Name      *string `json:"name"`
+	Rank      *string `json:"rank"`
+	Specialty *string `json:"specialty"`
+	Capacity  *int    `json:"capacity"`
+	UserID    *uint   `json:"userId"`
+}
+
+type rankChangeReq struct {
+	Rank   string `json:"rank"`
+	Reason string `json:"reason"`
+}
+
 func ListAlchemists(w http.ResponseWriter, r *http.Request) {
 	var list []models.Alchemist
 	if err := db.DB.Find(&list).Error; err != nil {
@@ -31,20 +62,47 @@ func GetAlchemist(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateAlchemist(w http.ResponseWriter, r *http.Request) {
-	var in models.Alchemist
+	var in alchemistCreateReq
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		WriteError(w, http.StatusBadRequest, "json inválido")
 		return
 	}
+	in.Name = strings.TrimSpace(in.Name)
 	if in.Name == "" {
 		WriteError(w, http.StatusBadRequest, "name es requerido")
 		return
 	}
-	if err := db.DB.Create(&in).Error; err != nil {
+	rank := models.RankApprentice
+	if in.Rank != nil && strings.TrimSpace(*in.Rank) != "" {
+		rk, ok := models.ParseRank(*in.Rank)
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "rank inválido")
+			return
+		}
+		rank = rk
+	}
+	if in.Capacity <= 0 {
+		in.Capacity = defaultCapacity()
+	}
+
+	a := models.Alchemist{
+		Name:      in.Name,
+		Rank:      rank,
+		Specialty: strings.TrimSpace(in.Specialty),
+		Capacity:  in.Capacity,
+		UserID:    in.UserID,
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&a).Error; err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.AlchemistCreated, a.ID, a, &a.ID)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo crear el alchemist")
 		return
 	}
-	WriteJSON(w, http.StatusCreated, in)
+	WriteJSON(w, http.StatusCreated, a)
 }
 
 func UpdateAlchemist(w http.ResponseWriter, r *http.Request) {
@@ -54,15 +112,47 @@ func UpdateAlchemist(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, http.StatusNotFound, "alchemist no encontrado")
 		return
 	}
-	var in models.Alchemist
+	var in alchemistUpdateReq
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		WriteError(w, http.StatusBadRequest, "json inválido")
 		return
 	}
-	a.Name = in.Name
-	a.Rank = in.Rank
-	a.Specialty = in.Specialty
-	if err := db.DB.Save(&a).Error; err != nil {
+
+	if in.Rank != nil {
+		if rk, ok := models.ParseRank(*in.Rank); !ok || rk != a.Rank {
+			WriteError(w, http.StatusBadRequest, "el rango se cambia con POST /alchemists/{id}/rank")
+			return
+		}
+	}
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			WriteError(w, http.StatusBadRequest, "name vacío")
+			return
+		}
+		a.Name = name
+	}
+	if in.Specialty != nil {
+		a.Specialty = strings.TrimSpace(*in.Specialty)
+	}
+	if in.Capacity != nil {
+		if *in.Capacity <= 0 {
+			WriteError(w, http.StatusBadRequest, "capacity debe ser mayor a 0")
+			return
+		}
+		a.Capacity = *in.Capacity
+	}
+	if in.UserID != nil {
+		a.UserID = in.UserID
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&a).Error; err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.AlchemistUpdated, a.ID, a, &a.ID)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar")
 		return
 	}
@@ -71,9 +161,111 @@ func UpdateAlchemist(w http.ResponseWriter, r *http.Request) {
 
 func DeleteAlchemist(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	if err := db.DB.Delete(&models.Alchemist{}, id).Error; err != nil {
+	aid := uint(id)
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Alchemist{}, id).Error; err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.AlchemistDeleted, aid, realtime.DeletedPayload{ID: aid, AlchemistID: &aid}, &aid)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo eliminar")
 		return
 	}
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
+
+/* ===================== RANGO / CERTIFICACIÓN ===================== */
+
+// POST /alchemists/{id}/rank — promoción o degradación (solo SUPERVISOR)
+func ChangeAlchemistRank(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	u := middleware.UserFromContext(r.Context())
+	if u == nil {
+		WriteError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+
+	var in rankChangeReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	to, ok := models.ParseRank(in.Rank)
+	if !ok {
+		WriteError(w, http.StatusBadRequest, "rank inválido")
+		return
+	}
+	in.Reason = strings.TrimSpace(in.Reason)
+	if in.Reason == "" {
+		WriteError(w, http.StatusBadRequest, "reason es requerido")
+		return
+	}
+
+	var a models.Alchemist
+	var change models.RankChange
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&a, id).Error; err != nil {
+			return err
+		}
+		if a.Rank == to {
+			return errSameRank
+		}
+		change = models.RankChange{
+			AlchemistID: a.ID,
+			FromRank:    a.Rank,
+			ToRank:      to,
+			Direction:   "PROMOTION",
+			Reason:      in.Reason,
+			ChangedByID: u.ID,
+		}
+		if to.Level() < a.Rank.Level() {
+			change.Direction = "DEMOTION"
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return err
+		}
+		a.Rank = to
+		if err := tx.Model(&a).Update("rank", to).Error; err != nil {
+			return err
+		}
+
+		meta, _ := json.Marshal(change)
+		if err := outbox.Audit(tx, async.AuditPayload{
+			Action:   "RANK_" + change.Direction,
+			Entity:   "alchemist",
+			EntityID: a.ID,
+			Meta:     meta,
+		}); err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.AlchemistRankChanged, a.ID, change, &a.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			WriteError(w, http.StatusNotFound, "alchemist no encontrado")
+		case errors.Is(err, errSameRank):
+			WriteError(w, http.StatusConflict, err.Error())
+		default:
+			WriteError(w, http.StatusInternalServerError, "no se pudo cambiar el rango")
+		}
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{"alchemist": a, "change": change})
+}
+
+var errSameRank = errors.New("el alquimista ya tiene ese rango")
+
+// GET /alchemists/{id}/rank-history
+func AlchemistRankHistory(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var list []models.RankChange
+	if err := db.DB.Preload("ChangedBy").Where("alchemist_id = ?", id).
+		Order("created_at DESC").Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo obtener el historial")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/auth/apikey"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var errAPIKeyNotFound = errors.New("API key no encontrada")
+
+type apiKeyCreateReq struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expiresInDays"`
+	UserID        *uint    `json:"userId"` // solo POST /api-keys; por defecto quien la crea
+}
+
+type apiKeyCreatedResp struct {
+	APIKey models.APIKey `json:"apiKey"`
+	Key    string        `json:"key"` // solo se muestra en esta respuesta
+}
+
+// apiKeyTTL: vigencia por defecto y máxima (API_KEY_DEFAULT_TTL_DAYS / API_KEY_MAX_TTL_DAYS).
+func apiKeyTTL() (def, max int) {
+	return db.MustGetInt("API_KEY_DEFAULT_TTL_DAYS", 90), db.MustGetInt("API_KEY_MAX_TTL_DAYS", 365)
+}
+
+/* ===================== Keys propias ===================== */
+
+// GET /auth/api-keys — API keys personales del usuario autenticado
+func MyAPIKeysList(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	var list []models.APIKey
+	if err := db.Get().
+		Where("user_id = ? AND kind = ?", me.ID, apikey.KindPersonal).
+		Order("id DESC").Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar las API keys")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// POST /auth/api-keys — crea una key personal con un subconjunto de tus permisos
+func MyAPIKeysCreate(w http.ResponseWriter, r *http.Request) {
+	var in apiKeyCreateReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	if in.UserID != nil {
+		WriteError(w, http.StatusBadRequest, "userId solo se admite en /api-keys")
+		return
+	}
+	createAPIKey(w, r, apikey.KindPersonal, *middleware.UserFromContext(r.Context()), in)
+}
+
+// DELETE /auth/api-keys/{id}
+func MyAPIKeysRevoke(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	revokeAPIKey(w, r, func(q *gorm.DB) *gorm.DB {
+		return q.Where("user_id = ? AND kind = ?", me.ID, apikey.KindPersonal)
+	})
+}
+
+/* ===================== Administración ===================== */
+
+// GET /api-keys?userId=&kind=&active=true
+func APIKeysList(w http.ResponseWriter, r *http.Request) {
+	qp := r.URL.Query()
+	q := db.Get().Model(&models.APIKey{})
+	if v := qp.Get("userId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "userId inválido")
+			return
+		}
+		q = q.Where("user_id = ?", id)
+	}
+	if v := strings.ToUpper(qp.Get("kind")); v != "" {
+		if v != apikey.KindPersonal && v != apikey.KindService {
+			WriteError(w, http.StatusBadRequest, "kind inválido (PERSONAL, SERVICE)")
+			return
+		}
+		q = q.Where("kind = ?", v)
+	}
+	if qp.Get("active") == "true" {
+		q = q.Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+
+	var list []models.APIKey
+	if err := q.Order("id DESC").Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar las API keys")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// POST /api-keys — key de servicio; actúa como userId (p. ej. una cuenta del
+// instrumento con su alquimista vinculado) con los scopes indicados
+func APIKeysCreate(w http.ResponseWriter, r *http.Request) {
+	var in apiKeyCreateReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	owner := *middleware.UserFromContext(r.Context())
+	if in.UserID != nil && *in.UserID != owner.ID {
+		if err := db.Get().First(&owner, *in.UserID).Error; err != nil {
+			WriteError(w, http.StatusBadRequest, "userId inexistente")
+			return
+		}
+		if owner.IsDisabled() {
+			WriteError(w, http.StatusBadRequest, "el usuario está deshabilitado")
+			return
+		}
+	}
+	createAPIKey(w, r, apikey.KindService, owner, in)
+}
+
+// DELETE /api-keys/{id} — revoca cualquier key
+func APIKeysRevoke(w http.ResponseWriter, r *http.Request) {
+	revokeAPIKey(w, r, func(q *gorm.DB) *gorm.DB { return q })
+}
+
+/* ===================== helpers ===================== */
+
+// createAPIKey valida nombre, scopes y vigencia. Los scopes no pueden exceder
+// los permisos de quien crea la key ni los del rol del usuario dueño.
+func createAPIKey(w http.ResponseWriter, r *http.Request, kind string, owner models.User, in apiKeyCreateReq) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" || len(name) > 100 {
+		WriteError(w, http.StatusBadRequest, "name es obligatorio (máx. 100 caracteres)")
+		return
+	}
+	if len(in.Scopes) == 0 {
+		WriteError(w, http.StatusBadRequest, "scopes es obligatorio")
+		return
+	}
+	scopes, ok := validPermissions(w, in.Scopes)
+	if !ok {
+		return
+	}
+
+	defDays, maxDays := apiKeyTTL()
+	days := defDays
+	if in.ExpiresInDays != nil {
+		days = *in.ExpiresInDays
+	}
+	if days < 1 || days > maxDays {
+		WriteError(w, http.StatusBadRequest, "expiresInDays debe estar entre 1 y "+strconv.Itoa(maxDays))
+		return
+	}
+
+	mine, err := middleware.Permissions(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, "no se pudieron resolver los permisos")
+		return
+	}
+	ownerPerms, err := authz.ForRole(r.Context(), string(owner.Role))
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, "no se pudieron resolver los permisos")
+		return
+	}
+	for _, s := range scopes {
+		if !mine.Has(s) {
+			WriteError(w, http.StatusForbidden, "no puedes delegar un permiso que no tienes: "+s)
+			return
+		}
+		if !ownerPerms.Has(s) {
+			WriteError(w, http.StatusBadRequest, "el rol "+string(owner.Role)+" no tiene el permiso "+s)
+			return
+		}
+	}
+
+	full, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo generar la API key")
+		return
+	}
+	me := middleware.UserFromContext(r.Context())
+	k := models.APIKey{
+		Name:        name,
+		Kind:        kind,
+		UserID:      owner.ID,
+		Prefix:      prefix,
+		SecretHash:  hash,
+		Scopes:      scopes,
+		CreatedByID: me.ID,
+		ExpiresAt:   time.Now().AddDate(0, 0, days),
+	}
+	if err := db.Get().Create(&k).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo crear la API key")
+		return
+	}
+
+	auditAPIKey(r, "API_KEY_CREATE", k)
+	WriteJSON(w, http.StatusCreated, apiKeyCreatedResp{APIKey: k, Key: full})
+}
+
+func revokeAPIKey(w http.ResponseWriter, r *http.Request, scope func(*gorm.DB) *gorm.DB) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var k models.APIKey
+	revoked := false
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := scope(tx.Where("id = ?", id)).First(&k).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errAPIKeyNotFound
+			}
+			return err
+		}
+		if k.RevokedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		k.RevokedAt, revoked = &now, true
+		return tx.Model(&k).Update("revoked_at", now).Error
+	})
+	if err != nil {
+		if errors.Is(err, errAPIKeyNotFound) {
+			WriteError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "no se pudo revocar la API key")
+		return
+	}
+
+	if revoked {
+		auditAPIKey(r, "API_KEY_REVOKE", k)
+	}
+	WriteJSON(w, http.StatusOK, k)
+}
+
+func auditAPIKey(r *http.Request, action string, k models.APIKey) {
+	meta := map[string]any{
+		"name":      k.Name,
+		"kind":      k.Kind,
+		"prefix":    k.Prefix,
+		"userId":    k.UserID,
+		"scopes":    k.Scopes,
+		"expiresAt": k.ExpiresAt,
+	}
+	if me := middleware.UserFromContext(r.Context()); me != nil {
+		meta["by"] = me.ID
+	}
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   action,
+		Entity:   "api_key",
+		EntityID: k.ID,
+		Meta:     b,
+	})
+}
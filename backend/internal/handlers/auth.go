@@ -1,18 +1,24 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
-	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/authz"
 	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
 )
 
 /* ---------- Error helper local ---------- */
@@ -35,18 +41,22 @@ func writeJSONError(w http.ResponseWriter, status int, msg string, fields ...map
 /* ---------- DTOs ---------- */
 
 type authUserDTO struct {
-	ID    uint            `json:"id"`
-	Name  string          `json:"name"`
-	Email string          `json:"email"`
-	Role  models.UserRole `json:"role"`
+	ID         uint            `json:"id"`
+	Name       string          `json:"name"`
+	Email      string          `json:"email"`
+	Role       models.UserRole `json:"role"`
+	MFAEnabled bool            `json:"mfaEnabled"`
+	// Permisos efectivos del rol; solo en /auth/me
+	Permissions []string `json:"permissions,omitempty"`
 }
 
 func toAuthUserDTO(u models.User) authUserDTO {
 	return authUserDTO{
-		ID:    u.ID,
-		Name:  u.Name,
-		Email: u.Email,
-		Role:  u.Role,
+		ID:         u.ID,
+		Name:       u.Name,
+		Email:      u.Email,
+		Role:       u.Role,
+		MFAEnabled: u.MFAEnabled(),
 	}
 }
 
@@ -55,19 +65,51 @@ var emailRe = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
 /* POST /api/auth/register */
 
 type registerReq struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	Role       string `json:"role"` // ignorado salvo para rechazar SUPERVISOR
+	InviteCode string `json:"inviteCode"`
+	// Token recibido por correo (POST /invitations); define el rol
+	InvitationToken string `json:"invitationToken"`
+}
+
+// registrationInviteCode: si está definido, el registro público lo exige.
+func registrationInviteCode() string {
+	return strings.TrimSpace(os.Getenv("REGISTRATION_INVITE_CODE"))
+}
+
+// validInviteCode compara en tiempo constante; sin código configurado todo pasa.
+func validInviteCode(got string) bool {
+	want := registrationInviteCode()
+	if want == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(want)) == 1
 }
 
 type authResp struct {
-	Token   string      `json:"token"`
-	User    authUserDTO `json:"user"`
-	Access  string      `json:"access"`
-	Refresh string      `json:"refresh"`
-	JTI     string      `json:"jti"`
-	Exp     int64       `json:"exp"`
+	Token     string      `json:"token"`
+	User      authUserDTO `json:"user"`
+	Access    string      `json:"access"`
+	Refresh   string      `json:"refresh"`
+	JTI       string      `json:"jti"`
+	Exp       int64       `json:"exp"`
+	SessionID string      `json:"sessionId"`
+}
+
+func writeAuthResp(w http.ResponseWriter, status int, u models.User, tok tokensOut) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(authResp{
+		Token:     tok.Access,
+		User:      toAuthUserDTO(u),
+		Access:    tok.Access,
+		Refresh:   tok.Refresh,
+		JTI:       tok.JTI,
+		Exp:       tok.Exp,
+		SessionID: tok.SessionID,
+	})
 }
 
 func Register(w http.ResponseWriter, r *http.Request) {
@@ -79,6 +121,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	in.Name = strings.TrimSpace(in.Name)
 	in.Email = strings.ToLower(strings.TrimSpace(in.Email))
 	in.Role = strings.ToUpper(strings.TrimSpace(in.Role))
+	in.InvitationToken = strings.TrimSpace(in.InvitationToken)
 
 	// Validación campos
 	fields := map[string]string{}
@@ -96,9 +139,21 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	role := models.RoleAlchemist
-	if in.Role == string(models.RoleSupervisor) {
-		role = models.RoleSupervisor
+	// Sin invitación el registro público solo crea alquimistas; el rol lo
+	// cambia un supervisor con PUT /users/{id}/role
+	if in.InvitationToken == "" {
+		if registrationRequiresInvitation() {
+			writeJSONError(w, http.StatusForbidden, "el registro requiere una invitación")
+			return
+		}
+		if in.Role != "" && in.Role != string(models.RoleAlchemist) {
+			writeJSONError(w, http.StatusForbidden, "el registro público solo crea cuentas ALCHEMIST")
+			return
+		}
+		if !validInviteCode(in.InviteCode) {
+			writeJSONError(w, http.StatusForbidden, "código de invitación inválido", map[string]string{"inviteCode": "inválido"})
+			return
+		}
 	}
 
 	// ¿Email ya existe?
@@ -121,31 +176,60 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	u := models.User{
 		Name:         in.Name,
 		Email:        in.Email,
-		Role:         role,
+		Role:         models.RoleAlchemist,
 		PasswordHash: string(hash),
 	}
-	if err := db.Get().Create(&u).Error; err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "no se pudo crear usuario")
+	var inv models.Invitation
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		if in.InvitationToken != "" {
+			var err error
+			if inv, err = claimInvitation(tx, in.InvitationToken, in.Email); err != nil {
+				return err
+			}
+			u.Role = inv.Role
+		}
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		if inv.ID == 0 {
+			return nil
+		}
+		return tx.Model(&inv).Updates(map[string]any{"accepted_at": time.Now(), "accepted_user_id": u.ID}).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvitationInvalid):
+			writeJSONError(w, http.StatusForbidden, err.Error(), map[string]string{"invitationToken": "inválido"})
+		case errors.Is(err, errInvitationMismatch):
+			writeJSONError(w, http.StatusForbidden, err.Error(), map[string]string{"email": "no coincide con la invitación"})
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "no se pudo crear usuario")
+		}
 		return
 	}
+	if inv.ID != 0 {
+		meta, _ := json.Marshal(map[string]any{"userId": u.ID, "role": u.Role})
+		_ = outbox.Audit(db.Get(), async.AuditPayload{
+			Action:   "INVITATION_ACCEPT",
+			Entity:   "invitation",
+			EntityID: inv.ID,
+			Meta:     meta,
+		})
+	}
 
-	tok, err := issueTokens(r.Context(), u)
+	// Mismo segundo paso que Login: una invitación a un rol con MFA
+	// obligatorio no abre sesión hasta configurar el TOTP
+	if u.MFAEnabled() || mfaRequiredFor(u.Role) {
+		writeMFAChallenge(w, u)
+		return
+	}
+	tok, err := startSession(r, u)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "no se pudo generar tokens")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(authResp{
-		Token:   tok.Access,
-		User:    toAuthUserDTO(u),
-		Access:  tok.Access,
-		Refresh: tok.Refresh,
-		JTI:     tok.JTI,
-		Exp:     tok.Exp,
-	})
-
+	writeAuthResp(w, http.StatusCreated, u, tok)
 }
 
 /* POST /api/auth/login  */
@@ -176,58 +260,69 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Retraso progresivo / bloqueo por cuenta e IP
+	ip := middleware.ClientIP(r)
+	att, ok := checkLoginGuard(w, r, in.Email, ip)
+	if !ok {
+		return
+	}
+	defer releaseLoginGuard(r, att)
+
 	var u models.User
 	if err := db.Get().Where("email = ?", in.Email).First(&u).Error; err != nil {
-
+		// mismo coste que un password incorrecto para no revelar si existe
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(in.Password))
+		loginFailed(r, att, in.Email, ip, 0)
 		writeJSONError(w, http.StatusUnauthorized, "credenciales inválidas")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(in.Password)); err != nil {
+		loginFailed(r, att, in.Email, ip, u.ID)
 		writeJSONError(w, http.StatusUnauthorized, "credenciales inválidas")
 		return
 	}
+	if u.IsDisabled() {
+		writeJSONError(w, http.StatusForbidden, "cuenta deshabilitada")
+		return
+	}
 
-	tok, err := issueTokens(r.Context(), u)
+	// Segundo paso: TOTP (o su configuración si el rol lo exige). El contador
+	// de fallos no se limpia hasta superarlo, para no regalar intentos de código.
+	if u.MFAEnabled() || mfaRequiredFor(u.Role) {
+		writeMFAChallenge(w, u)
+		return
+	}
+	loginSucceeded(r, att)
+
+	tok, err := startSession(r, u)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "no se pudo generar tokens")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(authResp{
-		Token:   tok.Access,
-		User:    toAuthUserDTO(u),
-		Access:  tok.Access,
-		Refresh: tok.Refresh,
-		JTI:     tok.JTI,
-		Exp:     tok.Exp,
-	})
-
+	writeAuthResp(w, http.StatusOK, u, tok)
 }
 
 /* GET /api/auth/me */
 
 func Me(w http.ResponseWriter, r *http.Request) {
-	authz := r.Header.Get("Authorization")
-	if !strings.HasPrefix(strings.ToLower(authz), "bearer ") {
+	raw := middleware.BearerToken(r)
+	if raw == "" {
 		writeJSONError(w, http.StatusUnauthorized, "token requerido")
 		return
 	}
-	raw := strings.TrimSpace(authz[len("Bearer "):])
 
-	claims, err := jwtutil.ParseToken(raw)
+	_, u, err := middleware.Authenticate(r.Context(), raw)
 	if err != nil {
-		writeJSONError(w, http.StatusUnauthorized, "token inválido")
+		writeJSONError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	var u models.User
-	if err := db.Get().First(&u, claims.UserID).Error; err != nil {
-		writeJSONError(w, http.StatusUnauthorized, "usuario no encontrado")
-		return
+	dto := toAuthUserDTO(*u)
+	if perms, err := authz.ForRole(r.Context(), string(u.Role)); err == nil {
+		dto.Permissions = perms.Keys()
 	}
-
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(toAuthUserDTO(u))
+	_ = json.NewEncoder(w).Encode(dto)
 }
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/auth/loginguard"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+// dummyHash: se compara cuando el email no existe para igualar tiempos.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("amestris-dummy-password"), bcrypt.DefaultCost)
+
+// checkLoginGuard reserva el intento o responde 429 con Retry-After si la
+// cuenta o la IP deben esperar. El llamador liquida la reserva con
+// loginFailed/loginSucceeded y difiere releaseLoginGuard para el resto de
+// salidas; todas aceptan un Attempt nil.
+func checkLoginGuard(w http.ResponseWriter, r *http.Request, email, ip string) (*loginguard.Attempt, bool) {
+	d, att, err := loginguard.Reserve(r.Context(), email, ip)
+	if err != nil {
+		// Sin DB el login tampoco funcionaría; no se bloquea por esto
+		log.Printf("warn: loginguard: %v", err)
+		return nil, true
+	}
+	if d.Allowed {
+		return att, true
+	}
+
+	secs := int(math.Ceil(d.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	msg := fmt.Sprintf("demasiados intentos fallidos; reintenta en %d s", secs)
+	if d.Locked {
+		msg = fmt.Sprintf("acceso bloqueado temporalmente por intentos fallidos; reintenta en %d s", secs)
+	}
+	writeJSONError(w, http.StatusTooManyRequests, msg, map[string]string{"retryAfter": strconv.Itoa(secs)})
+	return nil, false
+}
+
+// loginSucceeded liquida el intento como correcto (limpia el contador de la cuenta).
+func loginSucceeded(r *http.Request, att *loginguard.Attempt) {
+	if err := att.Succeed(r.Context()); err != nil {
+		log.Printf("warn: loginguard: %v", err)
+	}
+}
+
+// releaseLoginGuard libera la reserva si no se liquidó antes.
+func releaseLoginGuard(r *http.Request, att *loginguard.Attempt) {
+	if err := att.Release(r.Context()); err != nil {
+		log.Printf("warn: loginguard: %v", err)
+	}
+}
+
+// loginFailed registra el fallo y audita los bloqueos que provoque.
+func loginFailed(r *http.Request, att *loginguard.Attempt, email, ip string, userID uint) {
+	lockouts, err := att.Fail(r.Context())
+	if err != nil {
+		log.Printf("warn: loginguard: %v", err)
+		return
+	}
+	for _, lo := range lockouts {
+		entityID := uint(0)
+		if strings.HasPrefix(lo.Key, "acct:") {
+			entityID = userID
+		}
+		log.Printf("🚨 Login bloqueado: %s hasta %s (%d fallos)", lo.Key, lo.Until.Format("15:04:05"), lo.Failures)
+		meta, _ := json.Marshal(map[string]any{
+			"key":       lo.Key,
+			"email":     email,
+			"ip":        ip,
+			"failures":  lo.Failures,
+			"lockouts":  lo.Count,
+			"until":     lo.Until,
+			"userAgent": r.UserAgent(),
+		})
+		_ = outbox.Audit(db.Get(), async.AuditPayload{
+			Action:   "LOGIN_LOCKOUT",
+			Entity:   "security",
+			EntityID: entityID,
+			Meta:     meta,
+		})
+	}
+}
+
+/* ===================== Administración ===================== */
+
+// GET /security/lockouts — bloqueos de login vigentes (cuentas e IPs)
+func LockoutsList(w http.ResponseWriter, r *http.Request) {
+	list, err := loginguard.ActiveLockouts(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar los bloqueos")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// DELETE /security/lockouts/{key} — p. ej. ip:203.0.113.7 o acct:ana@amestris.io
+func LockoutsDelete(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if !strings.HasPrefix(key, "ip:") && !strings.HasPrefix(key, "acct:") {
+		WriteError(w, http.StatusBadRequest, "key inválida (ip:<ip> o acct:<email>)")
+		return
+	}
+	unlock(w, r, key, 0)
+}
+
+// POST /users/{id}/unlock — levanta el bloqueo de login de la cuenta
+func UsersUnlock(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var u models.User
+	if err := db.Get().First(&u, id).Error; err != nil {
+		WriteError(w, http.StatusNotFound, "usuario no encontrado")
+		return
+	}
+	unlock(w, r, loginguard.AccountKey(u.Email), u.ID)
+}
+
+func unlock(w http.ResponseWriter, r *http.Request, key string, userID uint) {
+	if err := loginguard.Unlock(r.Context(), key); err != nil {
+		if errors.Is(err, loginguard.ErrNotLocked) {
+			WriteError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "no se pudo desbloquear")
+		return
+	}
+
+	meta := map[string]any{"key": key}
+	if me := middleware.UserFromContext(r.Context()); me != nil {
+		meta["by"] = me.ID
+	}
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "LOGIN_UNLOCK",
+		Entity:   "security",
+		EntityID: userID,
+		Meta:     b,
+	})
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "unlocked", "key": key})
+}
@@ -0,0 +1,576 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/auth/loginguard"
+	"amestris/backend/internal/auth/revocation"
+	"amestris/backend/internal/auth/totp"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errMFACode           = errors.New("código inválido")
+	errMFAChallenge      = errors.New("desafío MFA inválido o expirado")
+	errMFAAlreadyEnabled = errors.New("MFA ya está activo")
+	errMFANotPending     = errors.New("no hay configuración MFA pendiente; llama antes a /auth/mfa/setup")
+	errMFARequired       = errors.New("tu rol exige MFA; no se puede desactivar")
+)
+
+// mfaRequiredFor: roles con MFA obligatorio (MFA_REQUIRED_ROLES=SUPERVISOR,...).
+func mfaRequiredFor(role models.UserRole) bool {
+	for _, s := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		if r := authz.NormalizeRole(s); r != "" && r == string(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaIssuer: nombre que muestra la app autenticadora (MFA_ISSUER).
+func mfaIssuer() string {
+	return db.MustGetEnv("MFA_ISSUER", "Amestris")
+}
+
+// mfaChallengeTTL: vigencia del token de desafío (MFA_CHALLENGE_TTL_MIN).
+func mfaChallengeTTL() time.Duration {
+	return time.Duration(db.MustGetInt("MFA_CHALLENGE_TTL_MIN", 5)) * time.Minute
+}
+
+func auditMFA(r *http.Request, action string, userID uint, meta map[string]any) {
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	meta["ip"] = middleware.ClientIP(r)
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   action,
+		Entity:   "user",
+		EntityID: userID,
+		Meta:     b,
+	})
+}
+
+/* ===================== DESAFÍO (login en dos pasos) ===================== */
+
+type mfaChallengeResp struct {
+	MFARequired bool `json:"mfaRequired"`
+	// El rol exige MFA y aún no está configurado: usar /auth/mfa/setup y /activate
+	EnrollmentRequired bool   `json:"enrollmentRequired"`
+	MFAToken           string `json:"mfaToken"`
+	MFATokenExp        int64  `json:"mfaTokenExp"`
+}
+
+// writeMFAChallenge responde al login con un token corto en lugar de los tokens de sesión.
+func writeMFAChallenge(w http.ResponseWriter, u models.User) {
+	purpose := jwtutil.MFAPurposeLogin
+	if !u.MFAEnabled() {
+		purpose = jwtutil.MFAPurposeEnroll
+	}
+	tok, claims, err := jwtutil.GenerateMFAToken(u.ID, purpose, mfaChallengeTTL())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo generar el desafío MFA")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(mfaChallengeResp{
+		MFARequired:        true,
+		EnrollmentRequired: purpose == jwtutil.MFAPurposeEnroll,
+		MFAToken:           tok,
+		MFATokenExp:        claims.ExpiresAt.Unix(),
+	})
+}
+
+// mfaChallengeUser valida el token de desafío (firma, propósito, uso único) y carga al usuario.
+func mfaChallengeUser(ctx context.Context, token, purpose string) (*jwtutil.MFAClaims, models.User, error) {
+	var u models.User
+	c, err := jwtutil.ParseMFAToken(strings.TrimSpace(token))
+	if err != nil || c.Purpose != purpose {
+		return nil, u, errMFAChallenge
+	}
+	revoked, err := revocation.IsRevoked(ctx, revocation.JTIKey(c.ID))
+	if err != nil {
+		return nil, u, err
+	}
+	if revoked {
+		return nil, u, errMFAChallenge
+	}
+	if err := db.Get().WithContext(ctx).First(&u, c.UserID).Error; err != nil || u.IsDisabled() {
+		return nil, u, errMFAChallenge
+	}
+	return c, u, nil
+}
+
+// consumeMFAChallenge impide reutilizar el token de desafío.
+func consumeMFAChallenge(ctx context.Context, c *jwtutil.MFAClaims) {
+	if err := revocation.Revoke(ctx, revocation.JTIKey(c.ID), c.ExpiresAt.Time); err != nil {
+		log.Printf("warn: no se pudo consumir el desafío MFA %s: %v", c.ID, err)
+	}
+}
+
+// verifySecondFactor valida un código TOTP (sin permitir repetir paso) o
+// consume un código de recuperación. Debe llamarse dentro de una transacción.
+func verifySecondFactor(tx *gorm.DB, userID uint, code, recoveryCode string, now time.Time) (usedRecovery bool, err error) {
+	if rc := normalizeRecoveryCode(recoveryCode); rc != "" {
+		res := tx.Model(&models.MFARecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, sha256Hex(rc)).
+			Update("used_at", now)
+		if res.Error != nil {
+			return false, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return false, errMFACode
+		}
+		return true, nil
+	}
+
+	var m models.UserMFA
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, errMFACode
+		}
+		return false, err
+	}
+	step, ok := totp.Validate(m.Secret, code, now)
+	if !ok || step <= m.LastStep {
+		return false, errMFACode
+	}
+	return false, tx.Model(&m).Update("last_step", step).Error
+}
+
+type mfaVerifyReq struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// POST /auth/mfa/verify — segundo paso del login; emite los tokens de sesión
+func MFAVerify(w http.ResponseWriter, r *http.Request) {
+	var in mfaVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	if strings.TrimSpace(in.Code) == "" && strings.TrimSpace(in.RecoveryCode) == "" {
+		writeJSONError(w, http.StatusUnprocessableEntity, "validación", map[string]string{"code": "requerido (o recoveryCode)"})
+		return
+	}
+
+	c, u, err := mfaChallengeUser(r.Context(), in.MFAToken, jwtutil.MFAPurposeLogin)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, errMFAChallenge.Error())
+		return
+	}
+	ip := middleware.ClientIP(r)
+	att, ok := checkLoginGuard(w, r, u.Email, ip)
+	if !ok {
+		return
+	}
+	defer releaseLoginGuard(r, att)
+
+	var usedRecovery bool
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		var err error
+		usedRecovery, err = verifySecondFactor(tx, u.ID, in.Code, in.RecoveryCode, time.Now())
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errMFACode) {
+			loginFailed(r, att, u.Email, ip, u.ID)
+			writeJSONError(w, http.StatusUnauthorized, err.Error(), map[string]string{"code": "inválido"})
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo verificar el código")
+		return
+	}
+
+	consumeMFAChallenge(r.Context(), c)
+	loginSucceeded(r, att)
+	if usedRecovery {
+		auditMFA(r, "MFA_RECOVERY_CODE_USED", u.ID, map[string]any{"remaining": remainingRecoveryCodes(u.ID)})
+	}
+
+	tok, err := startSession(r, u)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo generar tokens")
+		return
+	}
+	writeAuthResp(w, http.StatusOK, u, tok)
+}
+
+/* ===================== ALTA ===================== */
+
+type mfaSetupReq struct {
+	// Desafío "enroll" devuelto por el login; sin él se usa el access token
+	MFAToken string `json:"mfaToken"`
+}
+
+type mfaSetupResp struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauthUrl"`
+}
+
+// mfaActor: usuario del desafío de alta si se envía, o del access token.
+func mfaActor(r *http.Request, mfaToken string) (models.User, *jwtutil.MFAClaims, error) {
+	if strings.TrimSpace(mfaToken) != "" {
+		c, u, err := mfaChallengeUser(r.Context(), mfaToken, jwtutil.MFAPurposeEnroll)
+		return u, c, err
+	}
+	raw := middleware.BearerToken(r)
+	if raw == "" {
+		return models.User{}, nil, errors.New("token requerido")
+	}
+	_, u, err := middleware.Authenticate(r.Context(), raw)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	return *u, nil, nil
+}
+
+// POST /auth/mfa/setup — genera un secreto pendiente de activar
+func MFASetup(w http.ResponseWriter, r *http.Request) {
+	var in mfaSetupReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "json inválido")
+			return
+		}
+	}
+	u, _, err := mfaActor(r, in.MFAToken)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if u.MFAEnabled() {
+		writeJSONError(w, http.StatusConflict, errMFAAlreadyEnabled.Error())
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo generar el secreto")
+		return
+	}
+	m := models.UserMFA{UserID: u.ID, Secret: secret}
+	if err := db.Get().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{"secret": secret, "confirmed_at": nil, "last_step": 0, "updated_at": time.Now()}),
+	}).Create(&m).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo guardar el secreto")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(mfaSetupResp{
+		Secret:     secret,
+		OTPAuthURL: totp.ProvisioningURI(mfaIssuer(), u.Email, secret),
+	})
+}
+
+type mfaActivateReq struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+type mfaActivateResp struct {
+	Status        string   `json:"status"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+	// Alta durante el login: se completa la sesión
+	*authResp
+}
+
+// POST /auth/mfa/activate — confirma el secreto con un código y entrega los códigos de recuperación
+func MFAActivate(w http.ResponseWriter, r *http.Request) {
+	var in mfaActivateReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	u, challenge, err := mfaActor(r, in.MFAToken)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	ip := middleware.ClientIP(r)
+	var att *loginguard.Attempt
+	if challenge != nil {
+		var ok bool
+		if att, ok = checkLoginGuard(w, r, u.Email, ip); !ok {
+			return
+		}
+		defer releaseLoginGuard(r, att)
+	}
+
+	now := time.Now()
+	var codes []string
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		var m models.UserMFA
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND confirmed_at IS NULL", u.ID).First(&m).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errMFANotPending
+			}
+			return err
+		}
+		step, ok := totp.Validate(m.Secret, in.Code, now)
+		if !ok {
+			return errMFACode
+		}
+		if err := tx.Model(&m).Updates(map[string]any{"confirmed_at": now, "last_step": step}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", u.ID).Update("mfa_enabled_at", now).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, u.ID)
+		return err
+	})
+	switch {
+	case errors.Is(err, errMFANotPending):
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, errMFACode):
+		if challenge != nil {
+			loginFailed(r, att, u.Email, ip, u.ID)
+		}
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error(), map[string]string{"code": "inválido"})
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo activar MFA")
+		return
+	}
+	u.MFAEnabledAt = &now
+	auditMFA(r, "MFA_ENABLE", u.ID, nil)
+
+	out := mfaActivateResp{Status: "enabled", RecoveryCodes: codes}
+	if challenge != nil {
+		consumeMFAChallenge(r.Context(), challenge)
+		loginSucceeded(r, att)
+		tok, err := startSession(r, u)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "no se pudo generar tokens")
+			return
+		}
+		out.authResp = &authResp{
+			Token:     tok.Access,
+			User:      toAuthUserDTO(u),
+			Access:    tok.Access,
+			Refresh:   tok.Refresh,
+			JTI:       tok.JTI,
+			Exp:       tok.Exp,
+			SessionID: tok.SessionID,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+/* ===================== CUENTA PROPIA (autenticado) ===================== */
+
+// GET /auth/mfa
+func MFAStatus(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	if me == nil {
+		writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"enabled":                me.MFAEnabled(),
+		"enabledAt":              me.MFAEnabledAt,
+		"required":               mfaRequiredFor(me.Role),
+		"recoveryCodesRemaining": remainingRecoveryCodes(me.ID),
+	})
+}
+
+type mfaDisableReq struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// POST /auth/mfa/disable — exige contraseña y un segundo factor
+func MFADisable(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	if me == nil {
+		writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+	var in mfaDisableReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	if !me.MFAEnabled() {
+		writeJSONError(w, http.StatusConflict, "MFA no está activo")
+		return
+	}
+	if mfaRequiredFor(me.Role) {
+		writeJSONError(w, http.StatusForbidden, errMFARequired.Error())
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(me.PasswordHash), []byte(in.Password)); err != nil {
+		writeJSONError(w, http.StatusForbidden, "contraseña incorrecta", map[string]string{"password": "incorrecta"})
+		return
+	}
+
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if _, err := verifySecondFactor(tx, me.ID, in.Code, in.RecoveryCode, time.Now()); err != nil {
+			return err
+		}
+		return clearMFA(tx, me.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errMFACode) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error(), map[string]string{"code": "inválido"})
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo desactivar MFA")
+		return
+	}
+
+	auditMFA(r, "MFA_DISABLE", me.ID, nil)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "disabled"})
+}
+
+type mfaCodeReq struct {
+	Code string `json:"code"`
+}
+
+// POST /auth/mfa/recovery-codes — invalida los anteriores y genera nuevos
+func MFARegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	if me == nil {
+		writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+	var in mfaCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+
+	var codes []string
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if _, err := verifySecondFactor(tx, me.ID, in.Code, "", time.Now()); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, me.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errMFACode) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error(), map[string]string{"code": "inválido"})
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "no se pudieron generar los códigos")
+		return
+	}
+
+	auditMFA(r, "MFA_RECOVERY_CODES_REGENERATE", me.ID, nil)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"recoveryCodes": codes})
+}
+
+/* ===================== ADMIN ===================== */
+
+// POST /users/{id}/mfa/reset — quita el MFA (p. ej. móvil perdido) y cierra sus sesiones
+func UsersResetMFA(w http.ResponseWriter, r *http.Request) {
+	u, err := mutateUser(r, func(tx *gorm.DB, u *models.User) error {
+		// Quitar el TOTP a quien tiene más permisos sería el primer paso para
+		// quedarse con su cuenta
+		if err := checkRoleGrant(r, string(u.Role)); err != nil {
+			return err
+		}
+		if err := clearMFA(tx, u.ID); err != nil {
+			return err
+		}
+		u.MFAEnabledAt = nil
+		_, err := revokeUserSessions(tx, u.ID, "", models.SessionRevokedMFAReset, time.Now())
+		return err
+	})
+	if errors.Is(err, errRoleEscalation) {
+		writeRoleGrantError(w, r, err, "user", u.ID, string(u.Role))
+		return
+	}
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	auditUser(r, "MFA_RESET", u.ID, nil)
+	WriteJSON(w, http.StatusOK, u)
+}
+
+/* ===================== helpers ===================== */
+
+func clearMFA(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).Update("mfa_enabled_at", nil).Error
+}
+
+var recoveryB32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// replaceRecoveryCodes borra los códigos anteriores y devuelve los nuevos en claro
+// (formato xxxx-xxxx); solo se guarda su hash.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(recoveryB32.EncodeToString(b))
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		rows = append(rows, models.MFARecoveryCode{UserID: userID, CodeHash: sha256Hex(raw)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, "-", "")
+	return strings.ReplaceAll(s, " ", "")
+}
+
+func remainingRecoveryCodes(userID uint) int64 {
+	var n int64
+	db.Get().Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n)
+	return n
+}
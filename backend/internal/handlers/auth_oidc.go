@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/auth/oidc"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+)
+
+var (
+	errSSONoRole         = errors.New("tu cuenta del proveedor no pertenece a ningún grupo con acceso")
+	errSSOEmail          = errors.New("el proveedor no envió un email verificado")
+	errSSONotProvisioned = errors.New("no existe un usuario vinculado a esta cuenta del proveedor")
+	errSSOEmailTaken     = errors.New("ya existe un usuario local con ese email")
+	errSSOState          = errors.New("state inválido o expirado; vuelve a iniciar el login")
+	errSSOStateBrowser   = errors.New("el login no se inició en este navegador; vuelve a iniciarlo")
+)
+
+// oidcStateCookie ata el state al navegador que inició el login: sin ella un
+// atacante podría hacer que la víctima complete el login con su propio code
+// (login CSRF).
+const oidcStateCookie = "amestris_oidc_state"
+
+/* ===================== Configuración ===================== */
+
+func oidcConfig() (oidc.Config, bool) {
+	return oidc.ConfigFromEnv(appPublicURL() + "/login/sso")
+}
+
+// oidcStateTTL: tiempo para completar el login en el proveedor (OIDC_STATE_TTL_MIN).
+func oidcStateTTL() time.Duration {
+	return time.Duration(db.MustGetInt("OIDC_STATE_TTL_MIN", 10)) * time.Minute
+}
+
+// oidcFlag lee un booleano OIDC_* con valor por defecto.
+func oidcFlag(name string, def bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "true", "1":
+		return true
+	case "false", "0":
+		return false
+	}
+	return def
+}
+
+// setOIDCStateCookie escribe (o, con maxAge < 0, borra) la cookie del state.
+// Con APP_PUBLIC_URL en https va Secure y SameSite=None para que el frontend
+// pueda enviarla aunque la API esté en otro sitio; en http basta Lax.
+func setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	c := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if strings.HasPrefix(appPublicURL(), "https://") {
+		c.Secure = true
+		c.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, c)
+}
+
+// checkOIDCStateCookie comprueba que el state del callback es el de la cookie.
+func checkOIDCStateCookie(r *http.Request, state string) error {
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		return errSSOStateBrowser
+	}
+	return nil
+}
+
+// oidcRole elige el rol a partir de los grupos del id_token: el primer par
+// grupo=ROL de OIDC_ROLE_MAP cuyo grupo tenga el usuario (el orden es la
+// prioridad); si ninguno, OIDC_DEFAULT_ROLE. ok=false si no corresponde ninguno.
+func oidcRole(r *http.Request, t *oidc.IDToken) (models.UserRole, bool, error) {
+	claim := db.MustGetEnv("OIDC_GROUPS_CLAIM", "groups")
+	groups := map[string]bool{}
+	for _, g := range t.Strings(claim) {
+		groups[g] = true
+	}
+
+	candidates := []string{}
+	for _, pair := range strings.Split(os.Getenv("OIDC_ROLE_MAP"), ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && groups[strings.TrimSpace(group)] {
+			candidates = append(candidates, role)
+		}
+	}
+	if def := os.Getenv("OIDC_DEFAULT_ROLE"); strings.TrimSpace(def) != "" {
+		candidates = append(candidates, def)
+	}
+
+	for _, c := range candidates {
+		name, ok, err := authz.RoleExists(r.Context(), c)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return models.UserRole(name), true, nil
+		}
+		log.Printf("warn: OIDC: rol %q de OIDC_ROLE_MAP/OIDC_DEFAULT_ROLE no existe", c)
+	}
+	return "", false, nil
+}
+
+/* ===================== Handlers ===================== */
+
+// GET /api/auth/oidc/start — crea state, nonce y PKCE, ata el state al
+// navegador con una cookie y devuelve la URL del proveedor
+func OIDCStart(w http.ResponseWriter, r *http.Request) {
+	cfg, ok := oidcConfig()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, oidc.ErrDisabled.Error())
+		return
+	}
+	p, err := oidc.Get(r.Context(), cfg)
+	if err != nil {
+		log.Printf("❌ OIDC: %v", err)
+		writeJSONError(w, http.StatusBadGateway, "proveedor de identidad no disponible")
+		return
+	}
+
+	state, err1 := randToken(16)
+	nonce, err2 := randToken(16)
+	verifier, challenge, err3 := oidc.PKCE()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo iniciar el login")
+		return
+	}
+	ttl := oidcStateTTL()
+	st := models.OIDCState{
+		StateHash:    sha256Hex(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ttl),
+	}
+	if err := db.Get().Create(&st).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo iniciar el login")
+		return
+	}
+	setOIDCStateCookie(w, state, int(ttl.Seconds()))
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"authorizationUrl": p.AuthURL(state, nonce, challenge),
+		"state":            state,
+	})
+}
+
+type oidcCallbackReq struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// POST /api/auth/oidc/callback — {code, state} que el proveedor devolvió al
+// frontend junto con la cookie del state; canjea el código, vincula o
+// provisiona el usuario y emite tokens (o el desafío MFA si corresponde)
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cfg, ok := oidcConfig()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, oidc.ErrDisabled.Error())
+		return
+	}
+	var in oidcCallbackReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Code == "" || in.State == "" {
+		writeJSONError(w, http.StatusBadRequest, "code y state son obligatorios")
+		return
+	}
+	if err := checkOIDCStateCookie(r, in.State); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setOIDCStateCookie(w, "", -1)
+
+	st, err := consumeOIDCState(in.State)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := oidc.Get(r.Context(), cfg)
+	if err != nil {
+		log.Printf("❌ OIDC: %v", err)
+		writeJSONError(w, http.StatusBadGateway, "proveedor de identidad no disponible")
+		return
+	}
+	idt, err := p.Exchange(r.Context(), in.Code, st.CodeVerifier)
+	if err != nil {
+		log.Printf("warn: OIDC: %v", err)
+		writeJSONError(w, http.StatusUnauthorized, "el proveedor rechazó el login")
+		return
+	}
+	if idt.Nonce != st.Nonce {
+		writeJSONError(w, http.StatusUnauthorized, "nonce inválido")
+		return
+	}
+
+	u, meta, err := oidcResolveUser(r, cfg.Issuer, idt)
+	if err != nil {
+		switch {
+		case errors.Is(err, errSSONoRole), errors.Is(err, errSSONotProvisioned), errors.Is(err, errSSOEmail):
+			writeJSONError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, errSSOEmailTaken):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("❌ OIDC: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "no se pudo completar el login")
+		}
+		return
+	}
+	if u.IsDisabled() {
+		writeJSONError(w, http.StatusForbidden, "cuenta deshabilitada")
+		return
+	}
+
+	// El proveedor no sustituye al segundo factor local: quien tenga TOTP
+	// activo o un rol que lo exija pasa por el mismo desafío que en Login
+	if u.MFAEnabled() || mfaRequiredFor(u.Role) {
+		meta["mfa"] = "pending"
+		auditSSOLogin(u, meta)
+		writeMFAChallenge(w, u)
+		return
+	}
+	tok, err := startSession(r, u)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo generar tokens")
+		return
+	}
+	auditSSOLogin(u, meta)
+	writeAuthResp(w, http.StatusOK, u, tok)
+}
+
+/* ===================== helpers ===================== */
+
+func auditSSOLogin(u models.User, meta map[string]any) {
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "SSO_LOGIN",
+		Entity:   "user",
+		EntityID: u.ID,
+		Meta:     b,
+	})
+}
+
+// consumeOIDCState borra el state y devuelve su nonce/verifier (un solo uso).
+func consumeOIDCState(state string) (models.OIDCState, error) {
+	var st models.OIDCState
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND expires_at > ?", sha256Hex(state), time.Now()).First(&st).Error; err != nil {
+			return err
+		}
+		res := tx.Where("state_hash = ?", st.StateHash).Delete(&models.OIDCState{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return st, errSSOState
+	}
+	return st, nil
+}
+
+// oidcResolveUser busca la identidad (iss, sub); si no existe la vincula a un
+// usuario con el mismo email verificado (OIDC_LINK_BY_EMAIL, desactivado por
+// defecto: el proveedor tomaría una cuenta local existente) o crea uno nuevo
+// (OIDC_JIT). Con OIDC_SYNC_ROLE el rol se actualiza en cada login.
+func oidcResolveUser(r *http.Request, issuer string, t *oidc.IDToken) (models.User, map[string]any, error) {
+	email := strings.ToLower(strings.TrimSpace(t.Email))
+	emailOK := email != "" && emailRe.MatchString(email) &&
+		(t.EmailVerified || !oidcFlag("OIDC_REQUIRE_VERIFIED_EMAIL", true))
+	syncRole := oidcFlag("OIDC_SYNC_ROLE", true)
+	meta := map[string]any{"issuer": issuer, "subject": t.Subject, "email": email}
+
+	var u models.User
+	now := time.Now()
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		var ident models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, t.Subject).First(&ident).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&u, ident.UserID).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !emailOK {
+				return errSSOEmail
+			}
+			if err := oidcLinkOrCreate(r, tx, t, email, &u, meta); err != nil {
+				return err
+			}
+			ident = models.UserIdentity{UserID: u.ID, Issuer: issuer, Subject: t.Subject, Email: email}
+			if err := tx.Create(&ident).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if syncRole {
+			role, ok, err := oidcRole(r, t)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errSSONoRole
+			}
+			if role != u.Role {
+				if err := oidcSyncRole(r, tx, &u, role, meta); err != nil {
+					return err
+				}
+			}
+		}
+		upd := map[string]any{"last_login_at": now}
+		if email != "" {
+			upd["email"] = email
+		}
+		return tx.Model(&ident).Updates(upd).Error
+	})
+	return u, meta, err
+}
+
+func oidcLinkOrCreate(r *http.Request, tx *gorm.DB, t *oidc.IDToken, email string, u *models.User, meta map[string]any) error {
+	err := tx.Where("email = ?", email).First(u).Error
+	if err == nil {
+		if !oidcFlag("OIDC_LINK_BY_EMAIL", false) {
+			return errSSOEmailTaken
+		}
+		meta["linked"] = true
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if !oidcFlag("OIDC_JIT", true) {
+		return errSSONotProvisioned
+	}
+
+	role, ok, err := oidcRole(r, t)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errSSONoRole
+	}
+	// Contraseña local aleatoria: solo se entra por SSO salvo que se restablezca
+	secret, err := randToken(32)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSpace(t.Name)
+	if name == "" {
+		name = email
+	}
+	*u = models.User{Name: name, Email: email, Role: role, PasswordHash: string(hash)}
+	if err := tx.Create(u).Error; err != nil {
+		return err
+	}
+	meta["jit"] = true
+	meta["role"] = role
+	return nil
+}
+
+// oidcSyncRole aplica el rol del proveedor salvo que deje el sistema sin
+// administradores de roles; en ese caso se conserva el actual.
+func oidcSyncRole(r *http.Request, tx *gorm.DB, u *models.User, role models.UserRole, meta map[string]any) error {
+	if !authz.RoleHas(r.Context(), string(role), authz.RolesManage) {
+		if err := ensureOtherAdmin(tx, *u); err != nil {
+			if errors.Is(err, errLastAdmin) {
+				log.Printf("warn: OIDC: se conserva el rol %s del usuario %d: %v", u.Role, u.ID, err)
+				return nil
+			}
+			return err
+		}
+	}
+	meta["roleFrom"], meta["roleTo"] = u.Role, role
+	u.Role = role
+	return tx.Model(u).Update("role", role).Error
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/auth/oidc/oidctest"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+func oidcCallbackReqFor(t *testing.T, code, state string, cookie *http.Cookie) *http.Request {
+	t.Helper()
+	b, _ := json.Marshal(oidcCallbackReq{Code: code, State: state})
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/callback", bytes.NewReader(b))
+	r.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+// Sin la cookie del navegador que inició el login el callback se rechaza
+// antes de consumir el state (no necesita base de datos).
+func TestOIDCCallbackExigeCookieDelState(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "http://idp.invalid")
+	t.Setenv("OIDC_CLIENT_ID", oidctest.ClientID)
+
+	for name, cookie := range map[string]*http.Cookie{
+		"sin cookie":   nil,
+		"otro state":   {Name: oidcStateCookie, Value: "state-del-atacante"},
+		"cookie vacía": {Name: oidcStateCookie, Value: ""},
+		"otro nombre":  {Name: "state", Value: "state-de-la-victima"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			OIDCCallback(w, oidcCallbackReqFor(t, "code", "state-de-la-victima", cookie))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, quería 400 (%s)", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+/* ===================== Flujo completo (TEST_DB_DSN) ===================== */
+
+var (
+	ssoSupervisor = oidctest.User{Sub: "sub-sup", Email: "sso-sup@amestris.test", EmailVerified: true, Name: "Supervisor SSO", Groups: []string{"g-sup"}}
+	ssoAlchemist  = oidctest.User{Sub: "sub-alc", Email: "sso-alc@amestris.test", EmailVerified: true, Name: "Alquimista SSO", Groups: []string{"g-alc"}}
+	ssoLocal      = oidctest.User{Sub: "sub-local", Email: "sso-local@amestris.test", EmailVerified: true, Name: "Cuenta local", Groups: []string{"g-alc"}}
+)
+
+// setupOIDCFlow conecta a TEST_DB_DSN (se salta si no está), limpia los
+// usuarios de prueba y apunta el SSO a un proveedor httptest.
+func setupOIDCFlow(t *testing.T) *oidctest.Server {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN no definido")
+	}
+	t.Setenv("DB_DSN", dsn)
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	if err := db.Connect(); err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	if err := authz.Seed(context.Background()); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if err := jwtutil.Init(); err != nil {
+		t.Fatalf("jwt: %v", err)
+	}
+
+	emails := []string{ssoSupervisor.Email, ssoAlchemist.Email, ssoLocal.Email}
+	cleanup := func() {
+		var ids []uint
+		db.Get().Model(&models.User{}).Where("email IN ?", emails).Pluck("id", &ids)
+		if len(ids) == 0 {
+			return
+		}
+		db.Get().Where("user_id IN ?", ids).Delete(&models.UserIdentity{})
+		db.Get().Where("user_id IN ?", ids).Delete(&models.RefreshToken{})
+		db.Get().Where("user_id IN ?", ids).Delete(&models.AuthSession{})
+		db.Get().Where("id IN ?", ids).Delete(&models.User{})
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	idp := oidctest.New(t, ssoSupervisor, ssoAlchemist, ssoLocal)
+	t.Setenv("OIDC_ISSUER", idp.Issuer)
+	t.Setenv("OIDC_CLIENT_ID", oidctest.ClientID)
+	t.Setenv("OIDC_ROLE_MAP", "g-sup=SUPERVISOR,g-alc=ALCHEMIST")
+	t.Setenv("OIDC_LINK_BY_EMAIL", "")
+	t.Setenv("MFA_REQUIRED_ROLES", "SUPERVISOR")
+	return idp
+}
+
+// ssoLogin hace start → proveedor → callback y devuelve el callback.
+func ssoLogin(t *testing.T, idp *oidctest.Server, email string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	OIDCStart(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/start", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("start: %d %s", w.Code, w.Body.String())
+	}
+	var start struct {
+		AuthorizationURL string `json:"authorizationUrl"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &start)
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.MaxAge <= 0 {
+		t.Fatalf("start no dejó una cookie HttpOnly con el state: %+v", cookie)
+	}
+
+	code, state, err := idp.Authorize(start.AuthorizationURL, email)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if state != cookie.Value {
+		t.Fatalf("el proveedor devolvió otro state")
+	}
+
+	w = httptest.NewRecorder()
+	OIDCCallback(w, oidcCallbackReqFor(t, code, state, cookie))
+	return w
+}
+
+func TestOIDCFlujoCompleto(t *testing.T) {
+	idp := setupOIDCFlow(t)
+
+	t.Run("alta JIT y tokens", func(t *testing.T) {
+		w := ssoLogin(t, idp, ssoAlchemist.Email)
+		if w.Code != http.StatusOK {
+			t.Fatalf("callback: %d %s", w.Code, w.Body.String())
+		}
+		var out authResp
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		if out.Access == "" || out.Refresh == "" {
+			t.Fatalf("sin tokens: %s", w.Body.String())
+		}
+		for _, c := range w.Result().Cookies() {
+			if c.Name == oidcStateCookie && c.MaxAge >= 0 {
+				t.Fatalf("el callback no borró la cookie del state")
+			}
+		}
+	})
+
+	t.Run("rol con MFA obligatorio devuelve el desafío", func(t *testing.T) {
+		w := ssoLogin(t, idp, ssoSupervisor.Email)
+		if w.Code != http.StatusOK {
+			t.Fatalf("callback: %d %s", w.Code, w.Body.String())
+		}
+		var out mfaChallengeResp
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		if !out.MFARequired || !out.EnrollmentRequired || out.MFAToken == "" {
+			t.Fatalf("quería desafío de alta MFA: %s", w.Body.String())
+		}
+	})
+
+	t.Run("no vincula por email por defecto", func(t *testing.T) {
+		local := models.User{Name: "Local", Email: ssoLocal.Email, Role: models.UserRole(authz.RoleAlchemist), PasswordHash: "x"}
+		if err := db.Get().Create(&local).Error; err != nil {
+			t.Fatal(err)
+		}
+		if w := ssoLogin(t, idp, ssoLocal.Email); w.Code != http.StatusConflict {
+			t.Fatalf("status = %d, quería 409 (%s)", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("state de otro navegador", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		OIDCStart(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/start", nil))
+		var start struct {
+			AuthorizationURL string `json:"authorizationUrl"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &start)
+		// El atacante inicia su login y entrega su code/state a la víctima,
+		// que no tiene su cookie
+		code, state, err := idp.Authorize(start.AuthorizationURL, ssoAlchemist.Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = httptest.NewRecorder()
+		OIDCCallback(w, oidcCallbackReqFor(t, code, state, &http.Cookie{Name: oidcStateCookie, Value: "de-la-victima"}))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, quería 400", w.Code)
+		}
+	})
+}
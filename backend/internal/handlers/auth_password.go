@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/mail"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+)
+
+const minPasswordLen = 6
+
+var errResetInvalid = errors.New("token de restablecimiento inválido, expirado o ya usado")
+
+// passwordResetTTL: vigencia del token de restablecimiento (PASSWORD_RESET_TTL_MIN).
+func passwordResetTTL() time.Duration {
+	return time.Duration(db.MustGetInt("PASSWORD_RESET_TTL_MIN", 30)) * time.Minute
+}
+
+func auditPassword(r *http.Request, action string, userID uint, meta map[string]any) {
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   action,
+		Entity:   "user",
+		EntityID: userID,
+		Meta:     b,
+	})
+}
+
+/* ===================== CAMBIO (autenticado) ===================== */
+
+type passwordChangeReq struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+	// JTI del refresh de la sesión actual, solo para access tokens sin sid
+	// (anteriores a las sesiones); con sid se conserva esa sesión
+	JTI string `json:"jti"`
+}
+
+// POST /auth/password/change
+func PasswordChange(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	if me == nil {
+		writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+
+	var in passwordChangeReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	fields := map[string]string{}
+	if in.CurrentPassword == "" {
+		fields["currentPassword"] = "requerido"
+	}
+	if len(in.NewPassword) < minPasswordLen {
+		fields["newPassword"] = fmt.Sprintf("mínimo %d caracteres", minPasswordLen)
+	}
+	if len(fields) > 0 {
+		writeJSONError(w, http.StatusUnprocessableEntity, "validación", fields)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(me.PasswordHash), []byte(in.CurrentPassword)); err != nil {
+		writeJSONError(w, http.StatusForbidden, "contraseña actual incorrecta", map[string]string{"currentPassword": "incorrecta"})
+		return
+	}
+	if in.CurrentPassword == in.NewPassword {
+		writeJSONError(w, http.StatusUnprocessableEntity, "validación", map[string]string{"newPassword": "debe ser distinta de la actual"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo hashear contraseña")
+		return
+	}
+
+	var revoked int64
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", me.ID).Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+		// Se conserva siempre la sesión del access token; el jti no puede
+		// sustituirla (si no, la sesión actual caería con las demás)
+		keep := middleware.SessionIDFromContext(r.Context())
+		if keep == "" && in.JTI != "" {
+			var rt models.RefreshToken
+			if err := tx.Where("jti = ? AND user_id = ? AND revoked_at IS NULL", in.JTI, me.ID).First(&rt).Error; err == nil {
+				keep = rt.FamilyID
+			}
+		}
+		var err error
+		revoked, err = revokeUserSessions(tx, me.ID, keep, models.SessionRevokedPassword, time.Now())
+		return err
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo cambiar la contraseña")
+		return
+	}
+
+	auditPassword(r, "PASSWORD_CHANGE", me.ID, map[string]any{"revokedSessions": revoked})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "changed", "revokedSessions": revoked})
+}
+
+/* ===================== OLVIDO ===================== */
+
+type passwordForgotReq struct {
+	Email string `json:"email"`
+}
+
+// POST /auth/password/forgot — responde 202 exista o no el email
+func PasswordForgot(w http.ResponseWriter, r *http.Request) {
+	var in passwordForgotReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(in.Email))
+	if !emailRe.MatchString(email) {
+		writeJSONError(w, http.StatusUnprocessableEntity, "validación", map[string]string{"email": "email inválido"})
+		return
+	}
+
+	if err := requestPasswordReset(r, email); err != nil {
+		log.Printf("warn: solicitud de restablecimiento para %s: %v", email, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status": "si el email existe, recibirás un enlace para restablecer la contraseña",
+	})
+}
+
+func requestPasswordReset(r *http.Request, email string) error {
+	var u models.User
+	if err := db.Get().Where("email = ?", email).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if u.IsDisabled() {
+		return nil
+	}
+
+	token, err := randToken(32)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	pr := models.PasswordReset{
+		UserID:      u.ID,
+		TokenHash:   sha256Hex(token),
+		ExpiresAt:   now.Add(passwordResetTTL()),
+		RequestedIP: middleware.ClientIP(r),
+	}
+	link := fmt.Sprintf("%s/reset-password?token=%s", appPublicURL(), token)
+	msg := mail.Message{
+		To:      u.Email,
+		Subject: "Restablecer contraseña",
+		Body: fmt.Sprintf("Hola %s,\n\nPara elegir una nueva contraseña abre este enlace (válido hasta %s):\n%s\n\nSi no lo solicitaste, ignora este correo.\n",
+			u.Name, pr.ExpiresAt.Format(time.RFC1123), link),
+	}
+	meta, _ := json.Marshal(map[string]any{"ip": pr.RequestedIP})
+	// Solo el último enlace es válido. El correo va por el outbox: enviarlo
+	// aquí haría que la respuesta tardase más cuando el email existe
+	return db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL AND expires_at > ?", u.ID, now).
+			Update("expires_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&pr).Error; err != nil {
+			return err
+		}
+		if err := outbox.Mail(tx, msg); err != nil {
+			return err
+		}
+		return outbox.Audit(tx, async.AuditPayload{
+			Action:   "PASSWORD_RESET_REQUEST",
+			Entity:   "user",
+			EntityID: u.ID,
+			Meta:     meta,
+		})
+	})
+}
+
+/* ===================== RESTABLECER ===================== */
+
+type passwordResetReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// POST /auth/password/reset — consume el token y revoca todas las sesiones
+func PasswordReset(w http.ResponseWriter, r *http.Request) {
+	var in passwordResetReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	in.Token = strings.TrimSpace(in.Token)
+	fields := map[string]string{}
+	if in.Token == "" {
+		fields["token"] = "requerido"
+	}
+	if len(in.Password) < minPasswordLen {
+		fields["password"] = fmt.Sprintf("mínimo %d caracteres", minPasswordLen)
+	}
+	if len(fields) > 0 {
+		writeJSONError(w, http.StatusUnprocessableEntity, "validación", fields)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo hashear contraseña")
+		return
+	}
+
+	var pr models.PasswordReset
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", sha256Hex(in.Token)).First(&pr).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errResetInvalid
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if pr.UsedAt != nil || !now.Before(pr.ExpiresAt) {
+			return errResetInvalid
+		}
+
+		var u models.User
+		if err := tx.First(&u, pr.UserID).Error; err != nil {
+			return err
+		}
+		if u.IsDisabled() {
+			return errResetInvalid
+		}
+
+		if err := tx.Model(&pr).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&u).Updates(map[string]any{
+			"password_hash":         string(hash),
+			"tokens_invalid_before": now,
+		}).Error; err != nil {
+			return err
+		}
+		_, err = revokeUserSessions(tx, u.ID, "", models.SessionRevokedReset, now)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errResetInvalid) {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), map[string]string{"token": "inválido"})
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo restablecer la contraseña")
+		return
+	}
+
+	auditPassword(r, "PASSWORD_RESET", pr.UserID, map[string]any{"ip": middleware.ClientIP(r)})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "reset"})
+}
@@ -4,17 +4,24 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"gorm.io/gorm"
 
+	"amestris/backend/internal/async"
 	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/auth/revocation"
+	"amestris/backend/internal/authz"
 	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
 )
 
 /* ===================== UTILIDADES ===================== */
@@ -37,17 +44,48 @@ func sha256Hex(s string) string {
 /* ===================== ESTRUCTURAS ===================== */
 
 type tokensOut struct {
-	Access  string `json:"access"`
-	Refresh string `json:"refresh"`
-	JTI     string `json:"jti"`
-	Exp     int64  `json:"exp"`
+	Access    string `json:"access"`
+	Refresh   string `json:"refresh"`
+	JTI       string `json:"jti"`
+	Exp       int64  `json:"exp"`
+	SessionID string `json:"sessionId"`
 }
 
 /* ===================== EMISIÓN DE TOKENS ===================== */
 
-func issueTokens(ctx context.Context, u models.User) (tokensOut, error) {
-	// 1) Access token
-	access, exp, err := jwtutil.GenerateToken(u.ID, string(u.Role))
+// startSession abre una sesión (familia de refresh) para un login nuevo.
+func startSession(r *http.Request, u models.User) (tokensOut, error) {
+	id, err := randToken(16)
+	if err != nil {
+		return tokensOut{}, err
+	}
+	now := time.Now()
+	sess := models.AuthSession{
+		ID:         id,
+		UserID:     u.ID,
+		UserAgent:  r.UserAgent(),
+		IP:         middleware.ClientIP(r),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTTL()),
+	}
+	if err := db.Get().WithContext(r.Context()).Create(&sess).Error; err != nil {
+		return tokensOut{}, err
+	}
+	return issueTokens(r.Context(), u, sess.ID)
+}
+
+func refreshTTL() time.Duration {
+	return time.Duration(db.RefreshTokenTTLDays()) * 24 * time.Hour
+}
+
+// issueTokens emite access + refresh dentro de la familia sessionID.
+func issueTokens(ctx context.Context, u models.User, sessionID string) (tokensOut, error) {
+	// 1) Access token (con los permisos actuales del rol)
+	perms, err := authz.ForRole(ctx, string(u.Role))
+	if err != nil {
+		return tokensOut{}, err
+	}
+	access, exp, err := jwtutil.GenerateToken(u.ID, string(u.Role), sessionID, perms.Keys())
 	if err != nil {
 		return tokensOut{}, err
 	}
@@ -73,20 +111,64 @@ func issueTokens(ctx context.Context, u models.User) (tokensOut, error) {
 		UserID:    u.ID,
 		TokenHash: sha256Hex(refreshPlain),
 		JTI:       jti,
-		ExpiresAt: time.Now().Add(time.Duration(db.RefreshTokenTTLDays()) * 24 * time.Hour),
+		FamilyID:  sessionID,
+		ExpiresAt: time.Now().Add(refreshTTL()),
 	}
 	if err := db.Get().WithContext(ctx).Create(&rt).Error; err != nil {
 		return tokensOut{}, err
 	}
 
 	return tokensOut{
-		Access:  access,
-		Refresh: refreshPlain,
-		JTI:     jti,
-		Exp:     expUnix,
+		Access:    access,
+		Refresh:   refreshPlain,
+		JTI:       jti,
+		Exp:       expUnix,
+		SessionID: sessionID,
 	}, nil
 }
 
+/* ===================== REVOCACIÓN ===================== */
+
+// revokeSession revoca la sesión, todos sus refresh tokens y, vía la lista de
+// revocación, los access tokens vivos emitidos con su sid.
+func revokeSession(tx *gorm.DB, sessionID, reason string, now time.Time) error {
+	if err := revocation.Revoke(tx.Statement.Context, revocation.SessionKey(sessionID), now.Add(jwtutil.TTL())); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.AuthSession{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]any{"revoked_at": now, "revoked_reason": reason}).Error
+}
+
+// revokeUserSessions revoca todas las sesiones del usuario salvo exceptID.
+// Devuelve cuántas sesiones se revocaron.
+func revokeUserSessions(tx *gorm.DB, userID uint, exceptID, reason string, now time.Time) (int64, error) {
+	var ids []string
+	if err := tx.Model(&models.AuthSession{}).
+		Where("user_id = ? AND revoked_at IS NULL AND id <> ?", userID, exceptID).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := revokeSession(tx, id, reason, now); err != nil {
+			return 0, err
+		}
+	}
+
+	// Refresh sin familia (anteriores a las sesiones)
+	if err := tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (family_id IS NULL OR family_id = '')", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
 /* ===================== ENDPOINTS ===================== */
 
 type refreshIn struct {
@@ -110,15 +192,20 @@ func Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validar expiración o revocación
-	if rt.RevokedAt != nil || time.Now().After(rt.ExpiresAt) {
-		writeJSONError(w, http.StatusUnauthorized, "refresh expirado o revocado")
+	// Comparar hash
+	if subtle.ConstantTimeCompare([]byte(rt.TokenHash), []byte(sha256Hex(in.Refresh))) != 1 {
+		writeJSONError(w, http.StatusUnauthorized, "refresh inválido")
 		return
 	}
 
-	// Comparar hash
-	if rt.TokenHash != sha256Hex(in.Refresh) {
-		writeJSONError(w, http.StatusUnauthorized, "refresh inválido")
+	// Un refresh ya rotado que vuelve a presentarse indica robo: cae toda la familia
+	if rt.RevokedAt != nil {
+		handleRefreshReuse(r, rt)
+		writeJSONError(w, http.StatusUnauthorized, "refresh expirado o revocado")
+		return
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		writeJSONError(w, http.StatusUnauthorized, "refresh expirado o revocado")
 		return
 	}
 
@@ -128,16 +215,56 @@ func Refresh(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusUnauthorized, "usuario no encontrado")
 		return
 	}
+	if u.IsDisabled() {
+		writeJSONError(w, http.StatusUnauthorized, "cuenta deshabilitada")
+		return
+	}
 
-	// Revocar actual
+	// Revocar actual de forma condicional: si otro request ya lo rotó, es reutilización
 	now := time.Now()
-	if err := db.Get().Model(&rt).Update("revoked_at", &now).Error; err != nil {
+	res := db.Get().Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", rt.ID).
+		Update("revoked_at", now)
+	if res.Error != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudo rotar refresh")
+		return
+	}
+	if res.RowsAffected == 0 {
+		handleRefreshReuse(r, rt)
+		writeJSONError(w, http.StatusUnauthorized, "refresh expirado o revocado")
+		return
+	}
+
+	// Tokens previos a las familias: se les abre sesión al rotar
+	sessionID := rt.FamilyID
+	if sessionID == "" {
+		tok, err := startSession(r, u)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "no se pudo emitir tokens")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tok)
+		return
+	}
+
+	var sess models.AuthSession
+	if err := db.Get().First(&sess, "id = ?", sessionID).Error; err != nil || sess.RevokedAt != nil {
+		writeJSONError(w, http.StatusUnauthorized, "sesión revocada")
+		return
+	}
+	if err := db.Get().Model(&sess).Updates(map[string]any{
+		"last_used_at": now,
+		"expires_at":   now.Add(refreshTTL()),
+		"ip":           middleware.ClientIP(r),
+		"user_agent":   r.UserAgent(),
+	}).Error; err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "no se pudo rotar refresh")
 		return
 	}
 
-	// Emitir nuevos tokens
-	tok, err := issueTokens(r.Context(), u)
+	// Emitir nuevos tokens en la misma familia
+	tok, err := issueTokens(r.Context(), u, sessionID)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "no se pudo emitir tokens")
 		return
@@ -147,13 +274,44 @@ func Refresh(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(tok)
 }
 
+// handleRefreshReuse revoca la familia del token reutilizado y deja auditoría
+// de seguridad. Si la sesión ya estaba revocada (p. ej. logout) no hay alerta.
+func handleRefreshReuse(r *http.Request, rt models.RefreshToken) {
+	if rt.FamilyID == "" {
+		return
+	}
+	var sess models.AuthSession
+	if err := db.Get().First(&sess, "id = ?", rt.FamilyID).Error; err != nil || sess.RevokedAt != nil {
+		return
+	}
+	if err := revokeSession(db.Get(), sess.ID, models.SessionRevokedReuse, time.Now()); err != nil {
+		log.Printf("❌ No se pudo revocar la familia %s tras reutilización: %v", sess.ID, err)
+		return
+	}
+
+	log.Printf("🚨 Reutilización de refresh detectada: user=%d session=%s ip=%s", rt.UserID, sess.ID, middleware.ClientIP(r))
+	meta, _ := json.Marshal(map[string]any{
+		"userId":    rt.UserID,
+		"sessionId": sess.ID,
+		"jti":       rt.JTI,
+		"ip":        middleware.ClientIP(r),
+		"userAgent": r.UserAgent(),
+	})
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "REFRESH_TOKEN_REUSE",
+		Entity:   "security",
+		EntityID: rt.UserID,
+		Meta:     meta,
+	})
+}
+
 /* ===================== LOGOUT ===================== */
 
 type logoutIn struct {
 	JTI string `json:"jti"`
 }
 
-// POST /api/auth/logout
+// POST /api/auth/logout — revoca la sesión (familia) del refresh indicado
 func Logout(w http.ResponseWriter, r *http.Request) {
 	var in logoutIn
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.JTI == "" {
@@ -171,10 +329,52 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if rt.RevokedAt == nil {
-		now := time.Now()
+	now := time.Now()
+	if rt.FamilyID != "" {
+		_ = revokeSession(db.Get().WithContext(r.Context()), rt.FamilyID, models.SessionRevokedLogout, now)
+	} else if rt.RevokedAt == nil {
 		_ = db.Get().Model(&rt).Update("revoked_at", &now).Error
 	}
 
+	// Si llega el access token del mismo usuario, también deja de valer
+	if claims, err := jwtutil.ParseToken(middleware.BearerToken(r)); err == nil && claims.UserID == rt.UserID && claims.ID != "" {
+		_ = revocation.Revoke(r.Context(), revocation.JTIKey(claims.ID), claims.ExpiresAt.Time)
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
+
+// POST /auth/logout-all — cierra todas las sesiones del usuario, incluida la actual
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	if me == nil {
+		writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+
+	now := time.Now()
+	var revoked int64
+	err := db.Get().WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", me.ID).Update("tokens_invalid_before", now).Error; err != nil {
+			return err
+		}
+		var err error
+		revoked, err = revokeUserSessions(tx, me.ID, "", models.SessionRevokedLogout, now)
+		return err
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudieron cerrar las sesiones")
+		return
+	}
+
+	meta, _ := json.Marshal(map[string]any{"revokedSessions": revoked, "ip": middleware.ClientIP(r)})
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "LOGOUT_ALL",
+		Entity:   "user",
+		EntityID: me.ID,
+		Meta:     meta,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok", "revokedSessions": revoked})
+}
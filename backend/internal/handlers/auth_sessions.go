@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+type sessionDTO struct {
+	models.AuthSession
+	Current bool `json:"current"`
+}
+
+// GET /auth/sessions — sesiones activas del usuario autenticado
+func AuthSessionsList(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	if me == nil {
+		writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+
+	var list []models.AuthSession
+	if err := db.Get().
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", me.ID, time.Now()).
+		Order("last_used_at DESC").Find(&list).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "no se pudieron listar las sesiones")
+		return
+	}
+
+	current := middleware.SessionIDFromContext(r.Context())
+	out := make([]sessionDTO, 0, len(list))
+	for _, s := range list {
+		out = append(out, sessionDTO{AuthSession: s, Current: s.ID == current})
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// DELETE /auth/sessions/{id} — cierra una sesión propia (revoca su familia de refresh)
+func AuthSessionsRevoke(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	if me == nil {
+		writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	var s models.AuthSession
+	if err := db.Get().Where("id = ? AND user_id = ?", id, me.ID).First(&s).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "sesión no encontrada")
+		return
+	}
+	if s.RevokedAt == nil {
+		if err := revokeSession(db.Get(), s.ID, models.SessionRevokedUser, time.Now()); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "no se pudo cerrar la sesión")
+			return
+		}
+	}
+
+	meta, _ := json.Marshal(map[string]any{"sessionId": s.ID, "ip": s.IP})
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "SESSION_REVOKE",
+		Entity:   "user",
+		EntityID: me.ID,
+		Meta:     meta,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
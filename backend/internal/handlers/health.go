@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"amestris/backend/internal/db"
@@ -16,10 +17,20 @@ type healthResp struct {
 	CheckedAt string `json:"checkedAt"`
 }
 
+// draining: el proceso recibió SIGTERM y está terminando lo que tiene en
+// curso; /readyz responde 503 para que el balanceador deje de enviarle tráfico.
+var draining atomic.Bool
+
+// SetDraining marca el proceso como en parada (no hay vuelta atrás).
+func SetDraining() {
+	draining.Store(true)
+}
+
 func Healthz(w http.ResponseWriter, r *http.Request) {
 	writeHealth(w, r, false)
 }
 
+// Readyz: 503 mientras la DB no responde o el proceso se está deteniendo.
 func Readyz(w http.ResponseWriter, r *http.Request) {
 	writeHealth(w, r, true)
 }
@@ -31,11 +42,16 @@ func writeHealth(w http.ResponseWriter, r *http.Request, strict bool) {
 	dbStatus := pingDB(ctx)
 
 	status := "ok"
-	if strict && dbStatus != "ok" {
-		status = "down"
+	code := http.StatusOK
+	switch {
+	case strict && draining.Load():
+		status, code = "draining", http.StatusServiceUnavailable
+	case strict && dbStatus != "ok":
+		status, code = "down", http.StatusServiceUnavailable
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(healthResp{
 		Status:    status,
 		DB:        dbStatus,
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/mail"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInvitationInvalid  = errors.New("invitación inválida, expirada o ya usada")
+	errInvitationMismatch = errors.New("el email no coincide con la invitación")
+)
+
+// invitationTTL: vigencia por defecto de una invitación (INVITATION_TTL_HOURS).
+func invitationTTL() time.Duration {
+	return time.Duration(db.MustGetInt("INVITATION_TTL_HOURS", 72)) * time.Hour
+}
+
+// appPublicURL: URL del frontend usada en los enlaces de los correos.
+func appPublicURL() string {
+	return strings.TrimRight(db.MustGetEnv("APP_PUBLIC_URL", "http://localhost:3000"), "/")
+}
+
+// registrationRequiresInvitation: si es true, el registro sin invitación se rechaza.
+func registrationRequiresInvitation() bool {
+	return os.Getenv("REGISTRATION_REQUIRE_INVITATION") == "true"
+}
+
+type invitationCreateReq struct {
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	ExpiresInHours *int   `json:"expiresInHours"`
+}
+
+// POST /invitations — crea la invitación y envía el enlace por correo
+func InvitationsCreate(w http.ResponseWriter, r *http.Request) {
+	var in invitationCreateReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(in.Email))
+	if !emailRe.MatchString(email) {
+		WriteError(w, http.StatusBadRequest, "email inválido")
+		return
+	}
+	role := models.RoleAlchemist
+	if in.Role != "" {
+		name, ok, err := authz.RoleExists(r.Context(), in.Role)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "no se pudo validar el rol")
+			return
+		}
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "role inválido (ver GET /roles)")
+			return
+		}
+		role = models.UserRole(name)
+	}
+	if err := checkRoleGrant(r, string(role)); err != nil {
+		writeRoleGrantError(w, r, err, "invitation", 0, string(role))
+		return
+	}
+	ttl := invitationTTL()
+	if in.ExpiresInHours != nil {
+		if *in.ExpiresInHours <= 0 || *in.ExpiresInHours > 24*30 {
+			WriteError(w, http.StatusBadRequest, "expiresInHours debe estar entre 1 y 720")
+			return
+		}
+		ttl = time.Duration(*in.ExpiresInHours) * time.Hour
+	}
+
+	var exists int64
+	if err := db.Get().Model(&models.User{}).Where("email = ?", email).Count(&exists).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "error consultando email")
+		return
+	}
+	if exists > 0 {
+		WriteError(w, http.StatusConflict, "email ya registrado")
+		return
+	}
+
+	token, err := randToken(32)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo generar token")
+		return
+	}
+	now := time.Now()
+	inv := models.Invitation{
+		Email:     email,
+		Role:      role,
+		TokenHash: sha256Hex(token),
+		ExpiresAt: now.Add(ttl),
+	}
+	if u := middleware.UserFromContext(r.Context()); u != nil {
+		inv.InvitedByID = u.ID
+	}
+
+	// Una sola invitación pendiente por email: se revocan las anteriores
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Invitation{}).
+			Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL", email).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&inv).Error
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo crear la invitación")
+		return
+	}
+	inv.Status = models.InvitationPending
+
+	link := fmt.Sprintf("%s/register?invitation=%s&email=%s", appPublicURL(), token, url.QueryEscape(email))
+	if err := mail.Send(r.Context(), mail.Message{
+		To:      email,
+		Subject: "Invitación a Amestris",
+		Body: fmt.Sprintf("Has sido invitado como %s.\n\nCompleta tu registro aquí (válido hasta %s):\n%s\n",
+			role, inv.ExpiresAt.Format(time.RFC1123), link),
+	}); err != nil {
+		log.Printf("warn: no se pudo enviar invitación %d: %v", inv.ID, err)
+	}
+
+	meta, _ := json.Marshal(map[string]any{"email": email, "role": role, "expiresAt": inv.ExpiresAt})
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "INVITATION_CREATE",
+		Entity:   "invitation",
+		EntityID: inv.ID,
+		Meta:     meta,
+	})
+
+	WriteJSON(w, http.StatusCreated, inv)
+}
+
+// GET /invitations?status=PENDING|ACCEPTED|REVOKED|EXPIRED|ALL (default PENDING)
+func InvitationsList(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	q := db.Get().Order("created_at DESC")
+	switch models.InvitationStatus(strings.ToUpper(r.URL.Query().Get("status"))) {
+	case "", models.InvitationPending:
+		q = q.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case models.InvitationAccepted:
+		q = q.Where("accepted_at IS NOT NULL")
+	case models.InvitationRevoked:
+		q = q.Where("revoked_at IS NOT NULL AND accepted_at IS NULL")
+	case models.InvitationExpired:
+		q = q.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	case "ALL":
+	default:
+		WriteError(w, http.StatusBadRequest, "status inválido")
+		return
+	}
+
+	var list []models.Invitation
+	if err := q.Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar las invitaciones")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// DELETE /invitations/{id} — revoca una invitación pendiente
+func InvitationsRevoke(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var inv models.Invitation
+	if err := db.Get().First(&inv, id).Error; err != nil {
+		WriteError(w, http.StatusNotFound, "invitación no encontrada")
+		return
+	}
+	if inv.Status != models.InvitationPending {
+		WriteError(w, http.StatusConflict, "la invitación ya no está pendiente")
+		return
+	}
+	if err := db.Get().Model(&inv).Update("revoked_at", time.Now()).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo revocar la invitación")
+		return
+	}
+
+	meta, _ := json.Marshal(map[string]any{"email": inv.Email})
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "INVITATION_REVOKE",
+		Entity:   "invitation",
+		EntityID: inv.ID,
+		Meta:     meta,
+	})
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// claimInvitation bloquea la invitación del token y valida que siga pendiente
+// y que el email coincida. Debe llamarse dentro de la transacción del registro.
+func claimInvitation(tx *gorm.DB, token, email string) (models.Invitation, error) {
+	var inv models.Invitation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", sha256Hex(token)).First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return inv, errInvitationInvalid
+	}
+	if err != nil {
+		return inv, err
+	}
+	if inv.StatusAt(time.Now()) != models.InvitationPending {
+		return inv, errInvitationInvalid
+	}
+	if inv.Email != email {
+		return inv, errInvitationMismatch
+	}
+	return inv, nil
+}
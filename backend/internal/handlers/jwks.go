@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"amestris/backend/internal/auth/jwtutil"
+)
+
+// GET /.well-known/jwks.json — claves públicas para verificar nuestros access tokens
+func JWKS(w http.ResponseWriter, _ *http.Request) {
+	body, err := jwtutil.JWKS()
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, "claves no disponibles")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// Corto: una clave nueva solo firma cuando ha pasado jwtutil.ActivationDelay
+	// desde que se publicó, y ese margen incluye este max-age
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwtutil.JWKSMaxAge.Seconds())))
+	_, _ = w.Write(body)
+}
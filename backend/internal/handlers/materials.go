@@ -9,6 +9,8 @@ import (
 	"amestris/backend/internal/async"
 	"amestris/backend/internal/db"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -45,6 +47,19 @@ func MaterialsList(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// normalizeRarity valida la rareza recibida y la guarda en mayúsculas.
+func normalizeRarity(p *string) (*string, bool) {
+	if p == nil {
+		return nil, true
+	}
+	r, ok := models.ParseRarity(*p)
+	if !ok {
+		return nil, false
+	}
+	s := string(r)
+	return &s, true
+}
+
 // ---------- CREATE ----------
 type materialCreateReq struct {
 	Name     string  `json:"name"`
@@ -66,34 +81,46 @@ func MaterialsCreate(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, http.StatusBadRequest, "name y unit son obligatorios")
 		return
 	}
+	rarity, ok := normalizeRarity(in.Rarity)
+	if !ok {
+		WriteError(w, http.StatusBadRequest, "rarity inválida (COMMON, UNCOMMON, RARE, LEGENDARY)")
+		return
+	}
 	m := models.Material{
 		Name:     in.Name,
 		Quantity: in.Quantity,
 		Unit:     in.Unit,
-		Rarity:   in.Rarity,
+		Rarity:   rarity,
 		Notes:    in.Notes,
 	}
-	if err := db.DB.Create(&m).Error; err != nil {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&m).Error; err != nil {
+			return err
+		}
+
+		// --- Auditoría + evento (outbox) ---
+		meta := map[string]any{
+			"name":     m.Name,
+			"quantity": m.Quantity,
+			"unit":     m.Unit,
+			"rarity":   m.Rarity,
+		}
+		b, _ := json.Marshal(meta)
+		if err := outbox.Audit(tx, async.AuditPayload{
+			Action:   "CREATE",
+			Entity:   "material",
+			EntityID: m.ID,
+			Meta:     b,
+		}); err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.MaterialCreated, m.ID, m, nil)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo crear material")
 		return
 	}
 
-	// --- Encolar auditoría ---
-	meta := map[string]any{
-		"name":     m.Name,
-		"quantity": m.Quantity,
-		"unit":     m.Unit,
-		"rarity":   m.Rarity,
-	}
-	b, _ := json.Marshal(meta)
-	_ = async.EnqueueAudit(r.Context(), async.AuditPayload{
-		Action:   "CREATE",
-		Entity:   "material",
-		EntityID: m.ID,
-		Meta:     b,
-	})
-	// ---------------------------------------------------
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(m)
@@ -120,6 +147,8 @@ func MaterialsUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	prevQuantity := m.Quantity
+
 	var in materialUpdateReq
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		WriteError(w, http.StatusBadRequest, "json inválido")
@@ -146,16 +175,35 @@ func MaterialsUpdate(w http.ResponseWriter, r *http.Request) {
 		m.Unit = unit
 	}
 	if in.Rarity != nil {
-		m.Rarity = in.Rarity
+		rarity, ok := normalizeRarity(in.Rarity)
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "rarity inválida (COMMON, UNCOMMON, RARE, LEGENDARY)")
+			return
+		}
+		m.Rarity = rarity
 	}
 	if in.Notes != nil {
 		m.Notes = in.Notes
 	}
 
-	if err := db.DB.Save(&m).Error; err != nil {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&m).Error; err != nil {
+			return err
+		}
+		if err := outbox.Event(tx, realtime.MaterialUpdated, m.ID, m, nil); err != nil {
+			return err
+		}
+		if m.Quantity == prevQuantity {
+			return nil
+		}
+		return outbox.Event(tx, realtime.MaterialStockChanged, m.ID,
+			realtime.StockChanged(m, m.Quantity-prevQuantity, realtime.StockManual, nil), nil)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar")
 		return
 	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(m)
 }
@@ -171,20 +219,27 @@ func MaterialsDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := db.DB.Delete(&models.Material{}, id).Error; err != nil {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Material{}, id).Error; err != nil {
+			return err
+		}
+
+		// --- Auditoría + evento (outbox) ---
+		meta, _ := json.Marshal(map[string]any{"id": id})
+		if err := outbox.Audit(tx, async.AuditPayload{
+			Action:   "DELETE",
+			Entity:   "material",
+			EntityID: uint(id),
+			Meta:     meta,
+		}); err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.MaterialDeleted, uint(id), realtime.DeletedPayload{ID: uint(id)}, nil)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo eliminar")
 		return
 	}
 
-	// --- Encolar auditoría ---
-	meta, _ := json.Marshal(map[string]any{"id": id})
-	_ = async.EnqueueAudit(r.Context(), async.AuditPayload{
-		Action:   "DELETE",
-		Entity:   "material",
-		EntityID: uint(id),
-		Meta:     meta,
-	})
-	// ---------------------------------------------------
-
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -5,26 +5,63 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"amestris/backend/internal/authz"
 	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 /* ===== DTOs de entrada ===== */
 type missionCreateReq struct {
-	Title               string  `json:"title"`
-	Description         *string `json:"description"`
-	Status              *string `json:"status"`
-	AssignedAlchemistID *uint   `json:"assignedAlchemistId"`
+	Title               string     `json:"title"`
+	Description         *string    `json:"description"`
+	Status              *string    `json:"status"`
+	AssignedAlchemistID *uint      `json:"assignedAlchemistId"`
+	RequiredSpecialty   *string    `json:"requiredSpecialty"`
+	ScheduledAt         *time.Time `json:"scheduledAt"`
+	DueAt               *time.Time `json:"dueAt"`
 }
 
 type missionUpdateReq struct {
-	Title               *string `json:"title"`
-	Description         *string `json:"description"`
-	Status              *string `json:"status"`
-	AssignedAlchemistID *uint   `json:"assignedAlchemistId"`
+	Title               *string      `json:"title"`
+	Description         *string      `json:"description"`
+	Status              *string      `json:"status"`
+	AssignedAlchemistID *uint        `json:"assignedAlchemistId"`
+	RequiredSpecialty   *string      `json:"requiredSpecialty"`
+	ScheduledAt         nullableTime `json:"scheduledAt"`
+	DueAt               nullableTime `json:"dueAt"`
+}
+
+/* nullableTime distingue "campo ausente" de "null" en updates parciales */
+type nullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (n *nullableTime) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	if string(b) == "null" {
+		n.Value = nil
+		return nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	n.Value = &t
+	return nil
+}
+
+/* valida que la fecha límite no sea anterior al inicio programado */
+func validMissionDates(start, due *time.Time) bool {
+	return start == nil || due == nil || !due.Before(*start)
 }
 
 /* helper: desreferenciar punteros con default */
@@ -35,6 +72,11 @@ func val[T any](p *T, def T) T {
 	return def
 }
 
+/* Aprobar o rechazar una misión exige missions:approve */
+func needsApproval(s models.MissionStatus) bool {
+	return s == models.MissionApproved || s == models.MissionRejected
+}
+
 /* Normaliza el status string → models.MissionStatus */
 func parseMissionStatus(p *string, def models.MissionStatus) models.MissionStatus {
 	if p == nil {
@@ -49,9 +91,15 @@ func parseMissionStatus(p *string, def models.MissionStatus) models.MissionStatu
 
 /* =================== HANDLERS =================== */
 
+// GET /missions?overdue=true
 func ListMissions(w http.ResponseWriter, r *http.Request) {
+	q := db.DB.Preload("AssignedAlchemist")
+	if r.URL.Query().Get("overdue") == "true" {
+		q = q.Where("due_at < ? AND status NOT IN ?", time.Now(), models.ClosedMissionStatuses)
+	}
+
 	var list []models.Mission
-	if err := db.DB.Preload("AssignedAlchemist").Find(&list).Error; err != nil {
+	if err := q.Find(&list).Error; err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudieron listar las misiones")
 		return
 	}
@@ -68,6 +116,26 @@ func GetMission(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, m)
 }
 
+// GET /missions/stale?level=N — misiones marcadas como estancadas por el worker
+func ListStaleMissions(w http.ResponseWriter, r *http.Request) {
+	q := db.DB.Preload("AssignedAlchemist").Where("stale_since IS NOT NULL")
+	if v := r.URL.Query().Get("level"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < models.EscalationAlchemist {
+			WriteError(w, http.StatusBadRequest, "level inválido")
+			return
+		}
+		q = q.Where("escalation_level >= ?", n)
+	}
+
+	var list []models.Mission
+	if err := q.Order("escalation_level DESC").Order("stale_since ASC").Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar las misiones estancadas")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
 func CreateMission(w http.ResponseWriter, r *http.Request) {
 	var in missionCreateReq
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
@@ -81,26 +149,51 @@ func CreateMission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !validMissionDates(in.ScheduledAt, in.DueAt) {
+		WriteError(w, http.StatusBadRequest, "dueAt no puede ser anterior a scheduledAt")
+		return
+	}
+
 	// *string → string
 	desc := val(in.Description, "")
 	// string → models.MissionStatus
 	status := parseMissionStatus(in.Status, models.MissionStatus("OPEN"))
+	if needsApproval(status) && !middleware.Can(r, authz.MissionsApprove) {
+		WriteError(w, http.StatusForbidden, "sin permiso: "+authz.MissionsApprove)
+		return
+	}
 
 	m := models.Mission{
 		Title:               title,
 		Description:         desc,
 		Status:              status,
+		RequiredSpecialty:   strings.TrimSpace(val(in.RequiredSpecialty, "")),
 		AssignedAlchemistID: in.AssignedAlchemistID,
+		ScheduledAt:         in.ScheduledAt,
+		DueAt:               in.DueAt,
 	}
 
-	if err := db.DB.Create(&m).Error; err != nil {
+	// Valida capacidad/especialidad y crea en la misma transacción
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkAssignment(tx, nil, m); err != nil {
+			return err
+		}
+		if err := tx.Create(&m).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("AssignedAlchemist").First(&m, m.ID).Error; err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.MissionCreated, m.ID, m, m.AssignedAlchemistID)
+	})
+	if err != nil {
+		if isAssignmentError(err) {
+			writeAssignmentError(w, err)
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "no se pudo crear la misión")
 		return
 	}
-	if err := db.DB.Preload("AssignedAlchemist").First(&m, m.ID).Error; err != nil {
-		WriteError(w, http.StatusInternalServerError, "creada pero error al recargar")
-		return
-	}
 	WriteJSON(w, http.StatusCreated, m)
 }
 
@@ -112,6 +205,9 @@ func UpdateMission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	prev := m
+	prevStatus := m.Status
+
 	var in missionUpdateReq
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		WriteError(w, http.StatusBadRequest, "json inválido")
@@ -130,18 +226,67 @@ func UpdateMission(w http.ResponseWriter, r *http.Request) {
 		m.Description = *in.Description
 	}
 	if in.Status != nil {
-		m.Status = parseMissionStatus(in.Status, m.Status)
+		status := parseMissionStatus(in.Status, m.Status)
+		if status != m.Status && needsApproval(status) && !middleware.Can(r, authz.MissionsApprove) {
+			WriteError(w, http.StatusForbidden, "sin permiso: "+authz.MissionsApprove)
+			return
+		}
+		m.Status = status
 	}
 	if in.AssignedAlchemistID != nil {
 		m.AssignedAlchemistID = in.AssignedAlchemistID
 	}
-
-	if err := db.DB.Save(&m).Error; err != nil {
-		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar")
+	if in.RequiredSpecialty != nil {
+		m.RequiredSpecialty = strings.TrimSpace(*in.RequiredSpecialty)
+	}
+	if in.ScheduledAt.Set {
+		m.ScheduledAt = in.ScheduledAt.Value
+	}
+	if in.DueAt.Set {
+		m.DueAt = in.DueAt.Value
+		// Nueva fecha límite: se podrá volver a avisar si vence
+		m.OverdueNotifiedAt = nil
+	}
+	if !validMissionDates(m.ScheduledAt, m.DueAt) {
+		WriteError(w, http.StatusBadRequest, "dueAt no puede ser anterior a scheduledAt")
 		return
 	}
-	if err := db.DB.Preload("AssignedAlchemist").First(&m, m.ID).Error; err != nil {
-		WriteError(w, http.StatusInternalServerError, "actualizada pero error al recargar")
+
+	// Cualquier actualización cuenta como actividad: se limpia el escalamiento
+	m.StaleSince = nil
+	m.EscalationLevel = models.EscalationNone
+	m.LastEscalatedAt = nil
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkAssignment(tx, &prev, m); err != nil {
+			return err
+		}
+		if err := tx.Save(&m).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("AssignedAlchemist").First(&m, m.ID).Error; err != nil {
+			return err
+		}
+		if err := outbox.Event(tx, realtime.MissionUpdated, m.ID, m, m.AssignedAlchemistID); err != nil {
+			return err
+		}
+		if m.Status == prevStatus {
+			return nil
+		}
+		return outbox.Event(tx, realtime.MissionStatusChanged, m.ID, realtime.MissionStatusChangedPayload{
+			MissionID:           m.ID,
+			Title:               m.Title,
+			From:                prevStatus,
+			To:                  m.Status,
+			AssignedAlchemistID: m.AssignedAlchemistID,
+		}, m.AssignedAlchemistID)
+	})
+	if err != nil {
+		if isAssignmentError(err) {
+			writeAssignmentError(w, err)
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar")
 		return
 	}
 	WriteJSON(w, http.StatusOK, m)
@@ -149,7 +294,17 @@ func UpdateMission(w http.ResponseWriter, r *http.Request) {
 
 func DeleteMission(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	if err := db.DB.Delete(&models.Mission{}, id).Error; err != nil {
+	// El dueño decide quién recibe el evento
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var m models.Mission
+		_ = tx.Select("id", "assigned_alchemist_id").First(&m, id).Error
+		if err := tx.Delete(&models.Mission{}, id).Error; err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.MissionDeleted, uint(id),
+			realtime.DeletedPayload{ID: uint(id), AlchemistID: m.AssignedAlchemistID}, m.AssignedAlchemistID)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo eliminar")
 		return
 	}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	dateLayout        = "2006-01-02"
+	calendarMaxDays   = 366
+	calendarDefDays   = 30
+	icsLookbackDays   = 90
+	icsDefaultLengthH = 1
+)
+
+type calendarDay struct {
+	Date     string           `json:"date"`
+	Missions []models.Mission `json:"missions"`
+}
+
+type calendarResp struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Timezone string        `json:"timezone"`
+	Days     []calendarDay `json:"days"`
+}
+
+// parseCalendarDate acepta YYYY-MM-DD (en loc) o RFC3339.
+func parseCalendarDate(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation(dateLayout, v, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// missionSpan: intervalo que ocupa la misión en el calendario.
+func missionSpan(m models.Mission) (time.Time, time.Time, bool) {
+	switch {
+	case m.ScheduledAt != nil && m.DueAt != nil:
+		return *m.ScheduledAt, *m.DueAt, true
+	case m.ScheduledAt != nil:
+		return *m.ScheduledAt, *m.ScheduledAt, true
+	case m.DueAt != nil:
+		return *m.DueAt, *m.DueAt, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// scheduledMissionsQuery: misiones con fechas que tocan el intervalo [from, to).
+func scheduledMissionsQuery(from, to time.Time) *gorm.DB {
+	return db.Get().Model(&models.Mission{}).
+		Where("scheduled_at IS NOT NULL OR due_at IS NOT NULL").
+		Where("COALESCE(scheduled_at, due_at) < ?", to).
+		Where("COALESCE(due_at, scheduled_at) >= ?", from)
+}
+
+// GET /missions/calendar?from=YYYY-MM-DD&to=YYYY-MM-DD&alchemistId=&tz=
+func MissionsCalendar(w http.ResponseWriter, r *http.Request) {
+	qp := r.URL.Query()
+
+	loc := time.UTC
+	if tz := strings.TrimSpace(qp.Get("tz")); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "tz inválida")
+			return
+		}
+		loc = l
+	}
+
+	from := startOfDay(time.Now().In(loc))
+	if v := qp.Get("from"); v != "" {
+		t, err := parseCalendarDate(v, loc)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "from inválido (YYYY-MM-DD o RFC3339)")
+			return
+		}
+		from = startOfDay(t)
+	}
+	to := from.AddDate(0, 0, calendarDefDays-1)
+	if v := qp.Get("to"); v != "" {
+		t, err := parseCalendarDate(v, loc)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "to inválido (YYYY-MM-DD o RFC3339)")
+			return
+		}
+		to = startOfDay(t)
+	}
+	if to.Before(from) {
+		WriteError(w, http.StatusBadRequest, "to debe ser posterior a from")
+		return
+	}
+	if to.Sub(from) > calendarMaxDays*24*time.Hour {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("rango máximo de %d días", calendarMaxDays))
+		return
+	}
+	end := to.AddDate(0, 0, 1) // "to" es inclusivo
+
+	q := scheduledMissionsQuery(from, end).Preload("AssignedAlchemist")
+	if v := qp.Get("alchemistId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			WriteError(w, http.StatusBadRequest, "alchemistId inválido")
+			return
+		}
+		q = q.Where("assigned_alchemist_id = ?", id)
+	}
+
+	var list []models.Mission
+	if err := q.Order("COALESCE(scheduled_at, due_at) ASC").Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo consultar el calendario")
+		return
+	}
+
+	// Agrupa por día; una misión de varios días aparece en cada uno
+	byDay := map[string][]models.Mission{}
+	for _, m := range list {
+		start, stop, ok := missionSpan(m)
+		if !ok {
+			continue
+		}
+		day := startOfDay(start.In(loc))
+		if day.Before(from) {
+			day = from
+		}
+		last := startOfDay(stop.In(loc))
+		for ; !day.After(last) && day.Before(end); day = day.AddDate(0, 0, 1) {
+			k := day.Format(dateLayout)
+			byDay[k] = append(byDay[k], m)
+		}
+	}
+
+	days := make([]calendarDay, 0, len(byDay))
+	for d := from; d.Before(end); d = d.AddDate(0, 0, 1) {
+		k := d.Format(dateLayout)
+		if ms, ok := byDay[k]; ok {
+			days = append(days, calendarDay{Date: k, Missions: ms})
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, calendarResp{
+		From:     from.Format(dateLayout),
+		To:       to.Format(dateLayout),
+		Timezone: loc.String(),
+		Days:     days,
+	})
+}
+
+/* ===================== Feed iCalendar ===================== */
+
+func publicAPIURL() string {
+	return strings.TrimRight(db.MustGetEnv("PUBLIC_API_URL", "http://localhost:8080"), "/")
+}
+
+// POST /alchemists/{id}/calendar-token — genera (o rota) el token del feed .ics
+func AlchemistCalendarToken(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	issueCalendarToken(w, r, "alchemist no encontrado", func(q *gorm.DB) *gorm.DB { return q.Where("id = ?", id) })
+}
+
+// POST /auth/calendar-token — el mismo token para el alquimista vinculado al usuario
+func MyCalendarToken(w http.ResponseWriter, r *http.Request) {
+	me := middleware.UserFromContext(r.Context())
+	issueCalendarToken(w, r, "tu usuario no está vinculado a ningún alquimista", func(q *gorm.DB) *gorm.DB {
+		return q.Where("user_id = ?", me.ID)
+	})
+}
+
+// issueCalendarToken sustituye el token del alquimista que selecciona scope y
+// audita CALENDAR_TOKEN_CREATE o CALENDAR_TOKEN_ROTATE (sin el token).
+func issueCalendarToken(w http.ResponseWriter, r *http.Request, notFound string, scope func(*gorm.DB) *gorm.DB) {
+	token, err := randToken(24)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo generar token")
+		return
+	}
+
+	var a models.Alchemist
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := scope(tx.Clauses(clause.Locking{Strength: "UPDATE"})).First(&a).Error; err != nil {
+			return err
+		}
+		action := "CALENDAR_TOKEN_CREATE"
+		if a.CalendarTokenHash != "" {
+			action = "CALENDAR_TOKEN_ROTATE"
+		}
+		if err := tx.Model(&a).Update("calendar_token_hash", sha256Hex(token)).Error; err != nil {
+			return err
+		}
+		meta := map[string]any{}
+		if me := middleware.UserFromContext(r.Context()); me != nil {
+			meta["by"] = me.ID
+		}
+		b, _ := json.Marshal(meta)
+		return outbox.Audit(tx, async.AuditPayload{
+			Action:   action,
+			Entity:   "alchemist",
+			EntityID: a.ID,
+			Meta:     b,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteError(w, http.StatusNotFound, notFound)
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "no se pudo guardar token")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, map[string]string{
+		"token": token,
+		"url":   fmt.Sprintf("%s/api/calendar/alchemists/%d.ics?token=%s", publicAPIURL(), a.ID, token),
+	})
+}
+
+// GET /api/calendar/alchemists/{id}.ics?token= — público, autenticado por token del feed
+func AlchemistCalendarICS(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	token := r.URL.Query().Get("token")
+
+	var a models.Alchemist
+	if err := db.DB.First(&a, id).Error; err != nil || token == "" || a.CalendarTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(a.CalendarTokenHash), []byte(sha256Hex(token))) != 1 {
+		http.Error(w, "feed no encontrado", http.StatusNotFound)
+		return
+	}
+
+	from := time.Now().AddDate(0, 0, -icsLookbackDays)
+	var list []models.Mission
+	if err := scheduledMissionsQuery(from, time.Now().AddDate(10, 0, 0)).
+		Where("assigned_alchemist_id = ?", a.ID).
+		Order("id").Find(&list).Error; err != nil {
+		http.Error(w, "no se pudo generar el feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="alchemist-%d.ics"`, a.ID))
+	_, _ = w.Write([]byte(buildICS(a, list)))
+}
+
+func buildICS(a models.Alchemist, missions []models.Mission) string {
+	var b strings.Builder
+	line := func(s string) { b.WriteString(icsFold(s)) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Amestris//Misiones//ES")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + icsEscape("Misiones de "+a.Name))
+
+	for _, m := range missions {
+		start, stop, ok := missionSpan(m)
+		if !ok {
+			continue
+		}
+		if !stop.After(start) {
+			stop = start.Add(icsDefaultLengthH * time.Hour)
+		}
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:mission-%d@amestris", m.ID))
+		line("DTSTAMP:" + icsTime(m.UpdatedAt))
+		line("LAST-MODIFIED:" + icsTime(m.UpdatedAt))
+		line("DTSTART:" + icsTime(start))
+		line("DTEND:" + icsTime(stop))
+		line("SUMMARY:" + icsEscape(m.Title))
+		if m.Description != "" {
+			line("DESCRIPTION:" + icsEscape(m.Description))
+		}
+		line("STATUS:" + icsStatus(m.Status))
+		line("CATEGORIES:" + icsEscape(string(m.Status)))
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func icsStatus(s models.MissionStatus) string {
+	if s == models.MissionRejected {
+		return "CANCELLED"
+	}
+	if s == models.MissionPending {
+		return "TENTATIVE"
+	}
+	return "CONFIRMED"
+}
+
+// icsEscape escapa texto según RFC 5545 §3.3.11.
+func icsEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return r.Replace(s)
+}
+
+// icsFold corta líneas a 75 octetos sin partir runas y termina en CRLF.
+func icsFold(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s + "\r\n"
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		rl := len(string(r))
+		if n+rl > limit {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += rl
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -1,24 +1,151 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+
+	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
 	"amestris/backend/internal/realtime"
 )
 
-// GET /api/realtime/sse
+// realtimeTicketTTL: vigencia del ticket de stream (REALTIME_TICKET_TTL_SEC).
+func realtimeTicketTTL() time.Duration {
+	return time.Duration(db.MustGetInt("REALTIME_TICKET_TTL_SEC", 30)) * time.Second
+}
+
+// realtimeRecheck: cada cuánto se revalidan usuario y permisos de un stream
+// abierto (REALTIME_RECHECK_SEC).
+func realtimeRecheck() time.Duration {
+	return time.Duration(db.MustGetInt("REALTIME_RECHECK_SEC", 60)) * time.Second
+}
+
+// POST /api/realtime/ticket — ticket de un solo uso para ?ticket= en el SSE
+func RealtimeTicket(w http.ResponseWriter, r *http.Request) {
+	u := middleware.UserFromContext(r.Context())
+	var keyID uint
+	if k := middleware.APIKeyFromContext(r.Context()); k != nil {
+		keyID = k.ID
+	}
+	ticket, claims, err := jwtutil.GenerateStreamTicket(u.ID, middleware.SessionIDFromContext(r.Context()), keyID, realtimeTicketTTL())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo generar el ticket")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"ticket":    ticket,
+		"expiresAt": claims.ExpiresAt.Time,
+	})
+}
+
+// GET /api/realtime/sse?types=&topics=&lastEventId= — autenticado (AuthStream). Solo llegan
+// los eventos que el rol permite y, sin el permiso "todos" del tema, los del
+// alquimista vinculado al usuario.
 func RealtimeSSE(w http.ResponseWriter, r *http.Request) {
-	// CORS básico para dev
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-
-	// Por si algún proxy/cliente manda OPTIONS antes
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusNoContent)
+	sub, ok := realtimeSubscriber(w, r)
+	if !ok {
+		return
+	}
+	realtime.GlobalBroker().HandlerSSE(w, r, sub, realtimeRecheck(), lastEventID(r))
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Navegadores solo desde el frontend; clientes sin Origin (scripts) pasan
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || middleware.AllowedOrigin(origin)
+	},
+}
+
+// GET /api/realtime/ws?types=&topics=&lastEventId= — mismo auth y filtros que el
+// SSE, más subscribe/unsubscribe en caliente (ver realtime.ServeWS).
+func RealtimeWS(w http.ResponseWriter, r *http.Request) {
+	sub, ok := realtimeSubscriber(w, r)
+	if !ok {
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(hijacker{w}, r, nil)
+	if err != nil {
+		// Upgrade ya respondió el error
 		return
 	}
+	realtime.GlobalBroker().ServeWS(r.Context(), conn, sub, realtimeRecheck(), lastEventID(r))
+}
+
+// hijacker: los wrappers de los middlewares no implementan http.Hijacker;
+// ResponseController llega al writer original con Unwrap.
+type hijacker struct{ http.ResponseWriter }
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
 
-	// Broker SSE real
-	realtime.GlobalBroker().HandlerSSE(w, r)
+// realtimeSubscriber arma el suscriptor del usuario autenticado con su filtro
+// (?types=, ?topics=) y la revalidación periódica; si falla ya respondió.
+func realtimeSubscriber(w http.ResponseWriter, r *http.Request) (*realtime.Subscriber, bool) {
+	u := middleware.UserFromContext(r.Context())
+	perms, err := middleware.Permissions(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, "no se pudieron resolver los permisos")
+		return nil, false
+	}
+	alchemistID, err := linkedAlchemistID(r.Context(), u.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo abrir el stream")
+		return nil, false
+	}
+	sub, err := realtime.NewSubscriber(u.ID, realtime.Access{Perms: perms, AlchemistID: alchemistID}, r.URL.Query())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	sub.Refresh = func(ctx context.Context) (realtime.Access, error) {
+		perms, err := middleware.Revalidate(ctx)
+		if err != nil {
+			return realtime.Access{}, err
+		}
+		alchemistID, err := linkedAlchemistID(ctx, u.ID)
+		return realtime.Access{Perms: perms, AlchemistID: alchemistID}, err
+	}
+	return sub, true
+}
+
+// lastEventID: cabecera Last-Event-ID (reconexión automática de EventSource)
+// o ?lastEventId= (reconexión manual con un ticket nuevo): un id numérico o
+// la clave que el SSE manda como id; "" si no hay.
+func lastEventID(r *http.Request) string {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("lastEventId")
+	}
+	v = strings.TrimSpace(v)
+	if len(v) > 64 {
+		return ""
+	}
+	return v
+}
+
+// linkedAlchemistID: alquimista vinculado al usuario (nil si no tiene).
+func linkedAlchemistID(ctx context.Context, userID uint) (*uint, error) {
+	var a models.Alchemist
+	err := db.Get().WithContext(ctx).Select("id").Where("user_id = ?", userID).First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a.ID, nil
 }
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errRoleExists  = errors.New("el rol ya existe")
+	errRoleBuiltin = errors.New("los roles de sistema no se pueden eliminar")
+	errRoleInUse   = errors.New("el rol está asignado a usuarios o invitaciones pendientes")
+)
+
+var roleNameRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]{1,63}$`)
+
+type roleReq struct {
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+}
+
+type roleDTO struct {
+	models.Role
+	Permissions []string `json:"permissions"`
+	Users       int64    `json:"users"`
+}
+
+// GET /permissions — catálogo de permisos asignables
+func PermissionsList(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, authz.Catalog)
+}
+
+// GET /roles
+func RolesList(w http.ResponseWriter, r *http.Request) {
+	var roles []models.Role
+	if err := db.Get().Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar los roles")
+		return
+	}
+	out := make([]roleDTO, 0, len(roles))
+	for _, role := range roles {
+		dto, err := toRoleDTO(db.Get(), role)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "no se pudieron listar los roles")
+			return
+		}
+		out = append(out, dto)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// GET /roles/{name}
+func RolesGet(w http.ResponseWriter, r *http.Request) {
+	var role models.Role
+	if err := db.Get().Preload("Permissions").First(&role, "name = ?", authz.NormalizeRole(mux.Vars(r)["name"])).Error; err != nil {
+		WriteError(w, http.StatusNotFound, "rol no encontrado")
+		return
+	}
+	dto, err := toRoleDTO(db.Get(), role)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo cargar el rol")
+		return
+	}
+	WriteJSON(w, http.StatusOK, dto)
+}
+
+// POST /roles — {name, description, permissions[]}
+func RolesCreate(w http.ResponseWriter, r *http.Request) {
+	var in roleReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	name := authz.NormalizeRole(in.Name)
+	if !roleNameRe.MatchString(name) {
+		WriteError(w, http.StatusBadRequest, "name inválido (A-Z, 0-9 y _; 2 a 64 caracteres)")
+		return
+	}
+	var perms []string
+	if in.Permissions != nil {
+		var ok bool
+		if perms, ok = validPermissions(w, *in.Permissions); !ok {
+			return
+		}
+	}
+
+	role := models.Role{Name: name, Description: strings.TrimSpace(val(in.Description, ""))}
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&models.Role{}).Where("name = ?", name).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return errRoleExists
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return setRolePermissions(tx, name, perms)
+	})
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	authz.Invalidate()
+
+	auditRole(r, "ROLE_CREATE", name, map[string]any{"permissions": perms})
+	writeRole(w, name, http.StatusCreated)
+}
+
+// PUT /roles/{name} — description y/o lista completa de permisos
+func RolesUpdate(w http.ResponseWriter, r *http.Request) {
+	var in roleReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	var perms []string
+	if in.Permissions != nil {
+		var ok bool
+		if perms, ok = validPermissions(w, *in.Permissions); !ok {
+			return
+		}
+	}
+
+	name := authz.NormalizeRole(mux.Vars(r)["name"])
+	var before []string
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		var role models.Role
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Permissions").First(&role, "name = ?", name).Error; err != nil {
+			return err
+		}
+		before = role.PermissionKeys()
+		sort.Strings(before)
+		if in.Description != nil {
+			if err := tx.Model(&role).Update("description", strings.TrimSpace(*in.Description)).Error; err != nil {
+				return err
+			}
+		}
+		if in.Permissions == nil {
+			return nil
+		}
+		if slices.Contains(before, authz.RolesManage) && !slices.Contains(perms, authz.RolesManage) {
+			if err := ensureAdminsWithout(tx, name); err != nil {
+				return err
+			}
+		}
+		if err := setRolePermissions(tx, name, perms); err != nil {
+			return err
+		}
+		return tx.Model(&role).Update("updated_at", gorm.Expr("now()")).Error
+	})
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	authz.Invalidate()
+
+	meta := map[string]any{}
+	if in.Permissions != nil {
+		meta["from"] = before
+		meta["to"] = perms
+	}
+	if in.Description != nil {
+		meta["description"] = strings.TrimSpace(*in.Description)
+	}
+	auditRole(r, "ROLE_UPDATE", name, meta)
+	writeRole(w, name, http.StatusOK)
+}
+
+// DELETE /roles/{name} — solo roles propios sin usuarios ni invitaciones pendientes
+func RolesDelete(w http.ResponseWriter, r *http.Request) {
+	name := authz.NormalizeRole(mux.Vars(r)["name"])
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		var role models.Role
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&role, "name = ?", name).Error; err != nil {
+			return err
+		}
+		if role.Builtin {
+			return errRoleBuiltin
+		}
+		var users, invitations int64
+		if err := tx.Model(&models.User{}).Where("role = ?", name).Count(&users).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invitation{}).
+			Where("role = ? AND accepted_at IS NULL AND revoked_at IS NULL", name).
+			Count(&invitations).Error; err != nil {
+			return err
+		}
+		if users+invitations > 0 {
+			return errRoleInUse
+		}
+		if err := setRolePermissions(tx, name, nil); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	authz.Invalidate()
+
+	auditRole(r, "ROLE_DELETE", name, nil)
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+/* ===================== helpers ===================== */
+
+// writeRole responde con el rol ya guardado (tras crear o editar).
+func writeRole(w http.ResponseWriter, name string, status int) {
+	var role models.Role
+	if err := db.Get().Preload("Permissions").First(&role, "name = ?", name).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "guardado pero error al recargar")
+		return
+	}
+	dto, err := toRoleDTO(db.Get(), role)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "guardado pero error al recargar")
+		return
+	}
+	WriteJSON(w, status, dto)
+}
+
+func toRoleDTO(tx *gorm.DB, role models.Role) (roleDTO, error) {
+	dto := roleDTO{Role: role, Permissions: role.PermissionKeys()}
+	sort.Strings(dto.Permissions)
+	err := tx.Model(&models.User{}).Where("role = ?", role.Name).Count(&dto.Users).Error
+	return dto, err
+}
+
+// validPermissions deduplica y rechaza claves fuera del catálogo (400).
+func validPermissions(w http.ResponseWriter, in []string) ([]string, bool) {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(in))
+	for _, p := range in {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if !authz.Known(p) {
+			WriteError(w, http.StatusBadRequest, "permiso desconocido: "+p)
+			return nil, false
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out, true
+}
+
+// setRolePermissions reemplaza la lista de permisos del rol.
+func setRolePermissions(tx *gorm.DB, name string, perms []string) error {
+	if err := tx.Table("role_permissions").Where("role_name = ?", name).Delete(nil).Error; err != nil {
+		return err
+	}
+	if len(perms) == 0 {
+		return nil
+	}
+	rows := make([]map[string]any, len(perms))
+	for i, p := range perms {
+		rows[i] = map[string]any{"role_name": name, "permission_key": p}
+	}
+	return tx.Table("role_permissions").Create(rows).Error
+}
+
+// ensureAdminsWithout falla si, quitando roles:manage a role, no quedaría
+// ningún usuario habilitado capaz de administrar roles.
+func ensureAdminsWithout(tx *gorm.DB, role string) error {
+	roles, err := authz.RolesWith(tx, authz.RolesManage)
+	if err != nil {
+		return err
+	}
+	others := make([]string, 0, len(roles))
+	for _, r := range roles {
+		if r != role {
+			others = append(others, r)
+		}
+	}
+	var n int64
+	if len(others) > 0 {
+		if err := tx.Model(&models.User{}).
+			Where("role IN ? AND disabled_at IS NULL", others).
+			Count(&n).Error; err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		WriteError(w, http.StatusNotFound, "rol no encontrado")
+	case errors.Is(err, errRoleExists), errors.Is(err, errRoleBuiltin),
+		errors.Is(err, errRoleInUse), errors.Is(err, errLastAdmin):
+		WriteError(w, http.StatusConflict, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, "no se pudo guardar el rol")
+	}
+}
+
+func auditRole(r *http.Request, action, name string, meta map[string]any) {
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	meta["role"] = name
+	if me := middleware.UserFromContext(r.Context()); me != nil {
+		meta["by"] = me.ID
+	}
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action: action,
+		Entity: "role",
+		Meta:   b,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// GET /scheduler/jobs
+func SchedulerJobsList(w http.ResponseWriter, r *http.Request) {
+	var list []models.ScheduledJob
+	if err := db.Get().Order("name").Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar los jobs")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// POST /scheduler/jobs/{name}/trigger — el worker lo ejecuta en su próximo sondeo
+func SchedulerJobTrigger(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	updates := map[string]any{"trigger_requested_at": now}
+	if u := middleware.UserFromContext(r.Context()); u != nil {
+		updates["triggered_by_id"] = u.ID
+	}
+	updateScheduledJob(w, r, "TRIGGER", updates, http.StatusAccepted)
+}
+
+// POST /scheduler/jobs/{name}/pause
+func SchedulerJobPause(w http.ResponseWriter, r *http.Request) {
+	updateScheduledJob(w, r, "PAUSE", map[string]any{"paused": true}, http.StatusOK)
+}
+
+// POST /scheduler/jobs/{name}/resume
+func SchedulerJobResume(w http.ResponseWriter, r *http.Request) {
+	updateScheduledJob(w, r, "RESUME", map[string]any{"paused": false}, http.StatusOK)
+}
+
+func updateScheduledJob(w http.ResponseWriter, r *http.Request, action string, updates map[string]any, status int) {
+	name := mux.Vars(r)["name"]
+
+	var j models.ScheduledJob
+	if err := db.Get().First(&j, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteError(w, http.StatusNotFound, "job no encontrado")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "error consultando job")
+		return
+	}
+	if err := db.Get().Model(&j).Updates(updates).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar el job")
+		return
+	}
+	_ = db.Get().First(&j, "name = ?", name).Error
+
+	meta, _ := json.Marshal(map[string]any{"job": name, "action": action})
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action: "SCHEDULER_" + action,
+		Entity: "scheduled_job",
+		Meta:   meta,
+	})
+
+	WriteJSON(w, status, j)
+}
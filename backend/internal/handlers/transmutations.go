@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -9,7 +10,9 @@ import (
 
 	"amestris/backend/internal/async"
 	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
 	"amestris/backend/internal/realtime"
 
 	"github.com/gorilla/mux"
@@ -23,6 +26,7 @@ type transmutationCreateReq struct {
 	Title        string  `json:"title"`
 	MaterialID   uint    `json:"materialId"`
 	MissionID    *uint   `json:"missionId"`
+	AlchemistID  *uint   `json:"alchemistId"`
 	QuantityUsed float64 `json:"quantityUsed"`
 	Result       *string `json:"result"`
 }
@@ -33,17 +37,8 @@ type transmutationUpdateReq struct {
 	Result    *string `json:"result"`
 }
 
-type transmutationDTO struct {
-	ID           uint    `json:"id"`
-	Title        string  `json:"title"`
-	MaterialID   uint    `json:"materialId"`
-	MaterialName string  `json:"materialName,omitempty"`
-	MissionID    *uint   `json:"missionId,omitempty"`
-	MissionTitle string  `json:"missionTitle,omitempty"`
-	QuantityUsed float64 `json:"quantityUsed"`
-	Result       *string `json:"result,omitempty"`
-	CreatedAt    string  `json:"createdAt"`
-}
+// Mismo formato en la API y en los eventos transmutation.*
+type transmutationDTO = realtime.TransmutationPayload
 
 type transListResponse struct {
 	Items    []transmutationDTO `json:"items"`
@@ -59,6 +54,7 @@ func toDTO(t models.Transmutation) transmutationDTO {
 		ID:           t.ID,
 		Title:        t.Title,
 		MaterialID:   t.MaterialID,
+		AlchemistID:  t.AlchemistID,
 		QuantityUsed: t.QuantityUsed,
 		Result:       t.Result,
 		CreatedAt:    t.CreatedAt.Format(timeLayout),
@@ -150,12 +146,20 @@ func TransmutationsCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var created models.Transmutation
+	user := middleware.UserFromContext(r.Context())
 
 	err := db.Get().Transaction(func(tx *gorm.DB) error {
 		var m models.Material
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&m, in.MaterialID).Error; err != nil {
 			return err
 		}
+		performer, err := resolvePerformer(r.Context(), tx, user, in.AlchemistID, in.MissionID)
+		if err != nil {
+			return err
+		}
+		if err := checkRarityGate(r.Context(), user, performer, m); err != nil {
+			return err
+		}
 		if m.Quantity < in.QuantityUsed {
 			return gorm.ErrInvalidData
 		}
@@ -170,11 +174,41 @@ func TransmutationsCreate(w http.ResponseWriter, r *http.Request) {
 			QuantityUsed: in.QuantityUsed,
 			Result:       in.Result,
 		}
+		if performer != nil {
+			t.AlchemistID = &performer.ID
+		}
 		if err := tx.Create(&t).Error; err != nil {
 			return err
 		}
+		// Cargar relaciones para el DTO
+		if err := tx.Preload("Material").Preload("Mission").First(&t, t.ID).Error; err != nil {
+			return err
+		}
 		created = t
-		return nil
+
+		// Auditoría y eventos van en la misma transacción (outbox)
+		meta, _ := json.Marshal(map[string]any{
+			"title":        t.Title,
+			"materialId":   t.MaterialID,
+			"missionId":    t.MissionID,
+			"quantityUsed": t.QuantityUsed,
+			"result":       t.Result,
+			"createdAt":    time.Now().Format(time.RFC3339),
+		})
+		if err := outbox.Audit(tx, async.AuditPayload{
+			Action:   "CREATE",
+			Entity:   "transmutation",
+			EntityID: t.ID,
+			Meta:     meta,
+		}); err != nil {
+			return err
+		}
+		dto := toDTO(t)
+		if err := outbox.Event(tx, realtime.TransmutationCreated, dto.ID, dto, dto.AlchemistID); err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.MaterialStockChanged, m.ID,
+			realtime.StockChanged(m, -t.QuantityUsed, realtime.StockTransmutation, &t.ID), nil)
 	})
 
 	if err != nil {
@@ -186,36 +220,21 @@ func TransmutationsCreate(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusConflict, "stock insuficiente")
 			return
 		}
+		if isRankGateError(err) {
+			WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if errors.Is(err, errUnknownAlchemist) {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "no se pudo crear transmutation")
 		return
 	}
 
-	// Cargar relaciones para el DTO
-	_ = db.Get().Preload("Material").Preload("Mission").First(&created, created.ID).Error
-	dto := toDTO(created)
-
-	// Auditoría async
-	meta, _ := json.Marshal(map[string]any{
-		"title":        created.Title,
-		"materialId":   created.MaterialID,
-		"missionId":    created.MissionID,
-		"quantityUsed": created.QuantityUsed,
-		"result":       created.Result,
-		"createdAt":    time.Now().Format(time.RFC3339),
-	})
-	_ = async.EnqueueAudit(r.Context(), async.AuditPayload{
-		Action:   "CREATE",
-		Entity:   "transmutation",
-		EntityID: created.ID,
-		Meta:     meta,
-	})
-
-	// Evento SSE
-	realtime.Publish(r.Context(), "transmutation.created", dto)
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(dto)
+	_ = json.NewEncoder(w).Encode(toDTO(created))
 }
 
 // ---------- UPDATE (solo título, misión y resultado) ----------
@@ -263,35 +282,40 @@ func TransmutationsUpdate(w http.ResponseWriter, r *http.Request) {
 		t.MissionID = in.MissionID
 	}
 
-	if err := db.Get().Save(&t).Error; err != nil {
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&t).Error; err != nil {
+			return err
+		}
+		// Recargar relaciones
+		if err := tx.Preload("Material").Preload("Mission").First(&t, t.ID).Error; err != nil {
+			return err
+		}
+
+		meta, _ := json.Marshal(map[string]any{
+			"id":        t.ID,
+			"title":     t.Title,
+			"missionId": t.MissionID,
+			"result":    t.Result,
+			"updatedAt": time.Now().Format(time.RFC3339),
+		})
+		if err := outbox.Audit(tx, async.AuditPayload{
+			Action:   "UPDATE",
+			Entity:   "transmutation",
+			EntityID: t.ID,
+			Meta:     meta,
+		}); err != nil {
+			return err
+		}
+		dto := toDTO(t)
+		return outbox.Event(tx, realtime.TransmutationUpdated, dto.ID, dto, dto.AlchemistID)
+	})
+	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar transmutation")
 		return
 	}
 
-	// Recargar relaciones
-	_ = db.Get().Preload("Material").Preload("Mission").First(&t, t.ID).Error
-	dto := toDTO(t)
-
-	// Auditoría async
-	meta, _ := json.Marshal(map[string]any{
-		"id":        t.ID,
-		"title":     t.Title,
-		"missionId": t.MissionID,
-		"result":    t.Result,
-		"updatedAt": time.Now().Format(time.RFC3339),
-	})
-	_ = async.EnqueueAudit(r.Context(), async.AuditPayload{
-		Action:   "UPDATE",
-		Entity:   "transmutation",
-		EntityID: t.ID,
-		Meta:     meta,
-	})
-
-	// Evento SSE de actualización
-	realtime.Publish(r.Context(), "transmutation.updated", dto)
-
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(dto)
+	_ = json.NewEncoder(w).Encode(toDTO(t))
 }
 
 // ---------- DELETE (restaura stock) ----------
@@ -304,6 +328,8 @@ func TransmutationsDelete(w http.ResponseWriter, r *http.Request) {
 		if err := tx.Preload("Material").Preload("Mission").First(&t, id).Error; err != nil {
 			return err
 		}
+		tid := t.ID
+		var material models.Material
 
 		// Restaura el stock del material
 		if t.MaterialID != 0 && t.QuantityUsed > 0 {
@@ -313,12 +339,36 @@ func TransmutationsDelete(w http.ResponseWriter, r *http.Request) {
 			).Error; err != nil {
 				return err
 			}
+			if err := tx.First(&material, t.MaterialID).Error; err != nil {
+				return err
+			}
 		}
 
 		if err := tx.Delete(&models.Transmutation{}, id).Error; err != nil {
 			return err
 		}
-		return nil
+
+		meta, _ := json.Marshal(map[string]any{
+			"id":        id,
+			"deletedAt": time.Now().Format(time.RFC3339),
+		})
+		if err := outbox.Audit(tx, async.AuditPayload{
+			Action:   "DELETE",
+			Entity:   "transmutation",
+			EntityID: tid,
+			Meta:     meta,
+		}); err != nil {
+			return err
+		}
+		if err := outbox.Event(tx, realtime.TransmutationDeleted, tid,
+			realtime.DeletedPayload{ID: tid, AlchemistID: t.AlchemistID}, t.AlchemistID); err != nil {
+			return err
+		}
+		if material.ID == 0 {
+			return nil
+		}
+		return outbox.Event(tx, realtime.MaterialStockChanged, material.ID,
+			realtime.StockChanged(material, t.QuantityUsed, realtime.StockTransmutationDeleted, &tid), nil)
 	})
 
 	if err != nil {
@@ -330,22 +380,5 @@ func TransmutationsDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Auditoría
-	meta, _ := json.Marshal(map[string]any{
-		"id":        id,
-		"deletedAt": time.Now().Format(time.RFC3339),
-	})
-	_ = async.EnqueueAudit(r.Context(), async.AuditPayload{
-		Action:   "DELETE",
-		Entity:   "transmutation",
-		EntityID: uint(id),
-		Meta:     meta,
-	})
-
-	// Evento SSE de eliminación
-	realtime.Publish(r.Context(), "transmutation.deleted", map[string]any{
-		"id": id,
-	})
-
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/jobs"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/queue"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+type transmutationQueueReq struct {
+	Title       string  `json:"title"`
+	MaterialID  uint    `json:"materialId"`
+	AlchemistID *uint   `json:"alchemistId"`
+	Quantity    float64 `json:"quantity"`
+	Result      string  `json:"result"`
+}
+
+// POST /transmutations/queue — encola una transmutación para el worker
+func TransmutationsEnqueue(w http.ResponseWriter, r *http.Request) {
+	var in transmutationQueueReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || strings.TrimSpace(in.Title) == "" {
+		in = transmutationQueueReq{Title: "Cola demo", MaterialID: 1, Quantity: 2, Result: "Lingote"}
+	}
+	var res *string
+	if s := strings.TrimSpace(in.Result); s != "" {
+		res = &s
+	}
+
+	// El límite de rango se valida al encolar, donde se conoce al usuario
+	var m models.Material
+	if err := db.Get().First(&m, in.MaterialID).Error; err != nil {
+		WriteError(w, http.StatusBadRequest, "materialId inexistente")
+		return
+	}
+	user := middleware.UserFromContext(r.Context())
+	performer, err := resolvePerformer(r.Context(), db.Get(), user, in.AlchemistID, nil)
+	if err == nil {
+		err = checkRarityGate(r.Context(), user, performer, m)
+	}
+	if err != nil {
+		switch {
+		case isRankGateError(err):
+			WriteError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, errUnknownAlchemist):
+			WriteError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			WriteError(w, http.StatusBadRequest, "alquimista inexistente")
+		default:
+			WriteError(w, http.StatusInternalServerError, "no se pudo validar la transmutación")
+		}
+		return
+	}
+
+	p := jobs.PayloadTransmutation{
+		Title:      in.Title,
+		MaterialID: in.MaterialID,
+		Quantity:   in.Quantity,
+		Result:     res,
+	}
+	if performer != nil {
+		p.AlchemistID = &performer.ID
+	}
+	raw, _ := json.Marshal(p)
+	opts := []asynq.Option{asynq.MaxRetry(3), asynq.Timeout(30 * time.Second)}
+	// Con Idempotency-Key la tarea tiene un TaskID fijo: aunque la respuesta
+	// guardada ya no exista, asynq rechaza el duplicado mientras la retiene
+	var taskID string
+	if key := strings.TrimSpace(r.Header.Get(middleware.HeaderIdempotencyKey)); key != "" {
+		taskID = idempotentTaskID(user.ID, key)
+		opts = append(opts, asynq.TaskID(taskID), asynq.Retention(middleware.IdempotencyTTL()))
+	}
+	task := asynq.NewTask(jobs.TaskTransmutation, raw, opts...)
+
+	info, err := queue.Client.Enqueue(task)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		info, err = queue.Inspector.GetTaskInfo("default", taskID)
+	}
+	if err != nil {
+		http.Error(w, "no se pudo encolar tarea: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"taskId":          info.ID,
+		"queue":           info.Queue,
+		"state":           info.State.String(),
+		"next_process_at": info.NextProcessAt,
+	})
+}
+
+// idempotentTaskID: TaskID de asynq para la Idempotency-Key de un usuario.
+func idempotentTaskID(userID uint, key string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", userID, key)))
+	return "transmutation:" + hex.EncodeToString(sum[:16])
+}
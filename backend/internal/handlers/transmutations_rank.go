@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errRankRequired     = errors.New("el material requiere un alquimista con rango suficiente")
+	errRankTooLow       = errors.New("rango insuficiente para la rareza del material")
+	errForeignAlchemist = errors.New("solo puedes transmutar como tu propio alquimista")
+	errUnknownAlchemist = errors.New("alchemistId inexistente")
+)
+
+func isRankGateError(err error) bool {
+	return errors.Is(err, errRankRequired) || errors.Is(err, errRankTooLow) || errors.Is(err, errForeignAlchemist)
+}
+
+// resolvePerformer determina qué alquimista ejecuta la transmutación.
+// Con transmutations:any se puede indicar (o se toma el asignado a la misión);
+// el resto transmuta siempre como el alquimista vinculado a su cuenta.
+func resolvePerformer(ctx context.Context, tx *gorm.DB, u *models.User, alchemistID, missionID *uint) (*models.Alchemist, error) {
+	if canTransmuteAny(ctx, u) {
+		id := alchemistID
+		if id == nil && missionID != nil {
+			var mi models.Mission
+			if err := tx.Select("assigned_alchemist_id").First(&mi, *missionID).Error; err == nil {
+				id = mi.AssignedAlchemistID
+			}
+		}
+		if id == nil {
+			return nil, nil
+		}
+		var a models.Alchemist
+		if err := tx.First(&a, *id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errUnknownAlchemist
+			}
+			return nil, err
+		}
+		return &a, nil
+	}
+
+	if u == nil {
+		return nil, nil
+	}
+	var a models.Alchemist
+	if err := tx.Where("user_id = ?", u.ID).First(&a).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if alchemistID != nil {
+				return nil, errForeignAlchemist
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+	if alchemistID != nil && *alchemistID != a.ID {
+		return nil, errForeignAlchemist
+	}
+	return &a, nil
+}
+
+// checkRarityGate aplica el límite de rareza según el rango del alquimista.
+// Sin alquimista solo se permiten materiales COMMON, salvo con transmutations:any.
+func checkRarityGate(ctx context.Context, u *models.User, performer *models.Alchemist, m models.Material) error {
+	rarity := m.RarityValue()
+	if performer == nil {
+		if rarity == models.RarityCommon || canTransmuteAny(ctx, u) {
+			return nil
+		}
+		return errRankRequired
+	}
+	if !performer.Rank.CanTransmute(rarity) {
+		return fmt.Errorf("%w: %s no puede usar materiales %s", errRankTooLow, performer.Rank, rarity)
+	}
+	return nil
+}
+
+func canTransmuteAny(ctx context.Context, u *models.User) bool {
+	return u != nil && middleware.Allowed(ctx, authz.TransmutationsAny)
+}
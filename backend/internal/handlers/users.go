@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errSelfAction     = errors.New("no puedes aplicar esta acción sobre tu propia cuenta")
+	errLastAdmin      = errors.New("debe quedar al menos un usuario activo con permiso roles:manage")
+	errUserHasHistory = errors.New("el usuario tiene historial asociado; deshabilítalo en lugar de eliminarlo")
+	errRoleEscalation = errors.New("el rol tiene permisos que no tienes; hace falta roles:manage")
+)
+
+type userRoleReq struct {
+	Role string `json:"role"`
+}
+
+// GET /users?page=&pageSize=&q=&role=&disabled=
+func UsersList(w http.ResponseWriter, r *http.Request) {
+	qp := r.URL.Query()
+	page, _ := strconv.Atoi(qp.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(qp.Get("pageSize"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	q := db.Get().Model(&models.User{})
+	if s := strings.ToLower(strings.TrimSpace(qp.Get("q"))); s != "" {
+		like := "%" + s + "%"
+		q = q.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ?", like, like)
+	}
+	if v := qp.Get("role"); v != "" {
+		q = q.Where("role = ?", authz.NormalizeRole(v))
+	}
+	switch qp.Get("disabled") {
+	case "true":
+		q = q.Where("disabled_at IS NOT NULL")
+	case "false":
+		q = q.Where("disabled_at IS NULL")
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar los usuarios")
+		return
+	}
+	var items []models.User
+	if err := q.Order("id").Limit(pageSize).Offset((page - 1) * pageSize).Find(&items).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar los usuarios")
+		return
+	}
+	WriteJSON(w, http.StatusOK, listResponse{Items: items, Page: page, PageSize: pageSize, Total: total})
+}
+
+// GET /users/{id}
+func UsersGet(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var u models.User
+	if err := db.Get().First(&u, id).Error; err != nil {
+		WriteError(w, http.StatusNotFound, "usuario no encontrado")
+		return
+	}
+	WriteJSON(w, http.StatusOK, u)
+}
+
+// PUT /users/{id}/role
+func UsersUpdateRole(w http.ResponseWriter, r *http.Request) {
+	var in userRoleReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	name, ok, err := authz.RoleExists(r.Context(), in.Role)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo validar el rol")
+		return
+	}
+	if !ok {
+		WriteError(w, http.StatusBadRequest, "role inválido (ver GET /roles)")
+		return
+	}
+	role := models.UserRole(name)
+	if err := checkRoleGrant(r, name); err != nil {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		writeRoleGrantError(w, r, err, "user", uint(id), name)
+		return
+	}
+
+	var from models.UserRole
+	u, err := mutateUser(r, func(tx *gorm.DB, u *models.User) error {
+		from = u.Role
+		if u.Role == role {
+			return nil
+		}
+		// Tampoco se puede degradar a quien tiene más permisos que uno
+		if err := checkRoleGrant(r, string(u.Role)); err != nil {
+			return err
+		}
+		if !authz.RoleHas(r.Context(), string(role), authz.RolesManage) {
+			if err := ensureOtherAdmin(tx, *u); err != nil {
+				return err
+			}
+		}
+		u.Role = role
+		return tx.Model(u).Update("role", role).Error
+	})
+	if errors.Is(err, errRoleEscalation) {
+		writeRoleGrantError(w, r, err, "user", u.ID, string(from))
+		return
+	}
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+
+	if from != role {
+		auditUser(r, "USER_ROLE_CHANGE", u.ID, map[string]any{"from": from, "to": role})
+	}
+	WriteJSON(w, http.StatusOK, u)
+}
+
+// POST /users/{id}/disable — bloquea el acceso y revoca sus refresh tokens
+func UsersDisable(w http.ResponseWriter, r *http.Request) {
+	u, err := mutateUser(r, func(tx *gorm.DB, u *models.User) error {
+		// Como al cambiar el rol: no se actúa sobre quien tiene más permisos
+		if err := checkRoleGrant(r, string(u.Role)); err != nil {
+			return err
+		}
+		if u.IsDisabled() {
+			return nil
+		}
+		if err := ensureOtherAdmin(tx, *u); err != nil {
+			return err
+		}
+		now := time.Now()
+		u.DisabledAt = &now
+		if err := tx.Model(u).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+		_, err := revokeUserSessions(tx, u.ID, "", models.SessionRevokedDisabled, now)
+		return err
+	})
+	if errors.Is(err, errRoleEscalation) {
+		writeRoleGrantError(w, r, err, "user", u.ID, string(u.Role))
+		return
+	}
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	auditUser(r, "USER_DISABLE", u.ID, nil)
+	WriteJSON(w, http.StatusOK, u)
+}
+
+// POST /users/{id}/enable
+func UsersEnable(w http.ResponseWriter, r *http.Request) {
+	u, err := mutateUser(r, func(tx *gorm.DB, u *models.User) error {
+		if err := checkRoleGrant(r, string(u.Role)); err != nil {
+			return err
+		}
+		u.DisabledAt = nil
+		return tx.Model(u).Update("disabled_at", nil).Error
+	})
+	if errors.Is(err, errRoleEscalation) {
+		writeRoleGrantError(w, r, err, "user", u.ID, string(u.Role))
+		return
+	}
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	auditUser(r, "USER_ENABLE", u.ID, nil)
+	WriteJSON(w, http.StatusOK, u)
+}
+
+// DELETE /users/{id}
+func UsersDelete(w http.ResponseWriter, r *http.Request) {
+	u, err := mutateUser(r, func(tx *gorm.DB, u *models.User) error {
+		if err := checkRoleGrant(r, string(u.Role)); err != nil {
+			return err
+		}
+		if err := ensureOtherAdmin(tx, *u); err != nil {
+			return err
+		}
+		if err := ensureNoHistory(tx, u.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Alchemist{}).Where("user_id = ?", u.ID).Update("user_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.AuthSession{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.APIKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := clearMFA(tx, u.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(u).Error; err != nil {
+			// 23503 (foreign_key_violation): otra tabla que lo referencie y no
+			// esté en ensureNoHistory
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+				return errUserHasHistory
+			}
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, errRoleEscalation) {
+		writeRoleGrantError(w, r, err, "user", u.ID, string(u.Role))
+		return
+	}
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	auditUser(r, "USER_DELETE", u.ID, map[string]any{"email": u.Email})
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+/* ===================== helpers ===================== */
+
+// mutateUser bloquea al usuario {id} y aplica fn en una transacción.
+// Ningún supervisor puede administrar su propia cuenta desde aquí.
+func mutateUser(r *http.Request, fn func(tx *gorm.DB, u *models.User) error) (models.User, error) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if me := middleware.UserFromContext(r.Context()); me != nil && int(me.ID) == id {
+		return models.User{}, errSelfAction
+	}
+
+	var u models.User
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&u, id).Error; err != nil {
+			return err
+		}
+		return fn(tx, &u)
+	})
+	return u, err
+}
+
+// ensureNoHistory falla con errUserHasHistory si el usuario figura como autor
+// de cambios de rango o de invitaciones: esas filas lo referencian sin
+// ON DELETE y el historial debe conservar quién hizo qué.
+func ensureNoHistory(tx *gorm.DB, userID uint) error {
+	for _, q := range []struct {
+		model any
+		where string
+	}{
+		{&models.RankChange{}, "changed_by_id = ?"},
+		{&models.Invitation{}, "invited_by_id = ?"},
+	} {
+		var n int64
+		if err := tx.Model(q.model).Where(q.where, userID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return errUserHasHistory
+		}
+	}
+	return nil
+}
+
+// ensureOtherAdmin falla si u es el último usuario habilitado cuyo rol puede
+// administrar roles (sin él nadie podría volver a asignar permisos).
+func ensureOtherAdmin(tx *gorm.DB, u models.User) error {
+	roles, err := authz.RolesWith(tx, authz.RolesManage)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(roles, string(u.Role)) {
+		return nil
+	}
+	var n int64
+	if err := tx.Model(&models.User{}).
+		Where("role IN ? AND disabled_at IS NULL AND id <> ?", roles, u.ID).
+		Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// checkRoleGrant: solo se asigna (o se quita) un rol cuyos permisos tiene
+// quien lo hace, salvo que tenga roles:manage. Sin esto users:write o
+// invitations:manage bastarían para dar SUPERVISOR.
+func checkRoleGrant(r *http.Request, role string) error {
+	have, err := middleware.Permissions(r.Context())
+	if err != nil {
+		return err
+	}
+	if have.Has(authz.RolesManage) {
+		return nil
+	}
+	want, err := authz.ForRole(r.Context(), role)
+	if err != nil {
+		return err
+	}
+	for k := range want {
+		if !have.Has(k) {
+			return errRoleEscalation
+		}
+	}
+	return nil
+}
+
+// writeRoleGrantError responde 403 (y lo audita) si checkRoleGrant rechazó el rol.
+func writeRoleGrantError(w http.ResponseWriter, r *http.Request, err error, entity string, entityID uint, role string) {
+	if !errors.Is(err, errRoleEscalation) {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron resolver los permisos")
+		return
+	}
+	meta := map[string]any{"role": role}
+	if me := middleware.UserFromContext(r.Context()); me != nil {
+		meta["by"] = me.ID
+	}
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   "ROLE_GRANT_DENIED",
+		Entity:   entity,
+		EntityID: entityID,
+		Meta:     b,
+	})
+	WriteError(w, http.StatusForbidden, err.Error())
+}
+
+func writeUserAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		WriteError(w, http.StatusNotFound, "usuario no encontrado")
+	case errors.Is(err, errSelfAction):
+		WriteError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, errLastAdmin), errors.Is(err, errUserHasHistory):
+		WriteError(w, http.StatusConflict, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar el usuario")
+	}
+}
+
+func auditUser(r *http.Request, action string, userID uint, meta map[string]any) {
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	if me := middleware.UserFromContext(r.Context()); me != nil {
+		meta["by"] = me.ID
+	}
+	b, _ := json.Marshal(meta)
+	_ = outbox.Audit(db.Get(), async.AuditPayload{
+		Action:   action,
+		Entity:   "user",
+		EntityID: userID,
+		Meta:     b,
+	})
+}
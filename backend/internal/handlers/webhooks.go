@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/middleware"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
+	"amestris/backend/internal/webhooks"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var errWebhookNotFound = errors.New("webhook no encontrado")
+
+type webhookReq struct {
+	Name   *string  `json:"name"`
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Secret *string  `json:"secret"` // solo al crear; si falta se genera
+	Active *bool    `json:"active"`
+}
+
+type webhookSecretResp struct {
+	Webhook models.Webhook `json:"webhook"`
+	Secret  string         `json:"secret"` // solo se muestra al crear o rotar
+}
+
+/* ===================== CRUD ===================== */
+
+// GET /webhooks
+func WebhooksList(w http.ResponseWriter, r *http.Request) {
+	var list []models.Webhook
+	if err := db.Get().Order("id").Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar los webhooks")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// GET /webhooks/{id}
+func WebhooksGet(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, h)
+}
+
+// POST /webhooks — el secreto solo se devuelve en esta respuesta
+func WebhooksCreate(w http.ResponseWriter, r *http.Request) {
+	var in webhookReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	if in.Name == nil || in.URL == nil || len(in.Events) == 0 {
+		WriteError(w, http.StatusBadRequest, "name, url y events son obligatorios")
+		return
+	}
+	h := models.Webhook{Active: true, CreatedByID: middleware.UserFromContext(r.Context()).ID}
+	if !applyWebhook(w, &h, in) {
+		return
+	}
+	if in.Secret != nil && strings.TrimSpace(*in.Secret) != "" {
+		secret := strings.TrimSpace(*in.Secret)
+		if len(secret) < 16 || len(secret) > 128 {
+			WriteError(w, http.StatusBadRequest, "secret debe tener entre 16 y 128 caracteres")
+			return
+		}
+		h.Secret = secret
+	} else {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "no se pudo generar el secreto")
+			return
+		}
+		h.Secret = secret
+	}
+
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&h).Error; err != nil {
+			return err
+		}
+		return auditWebhook(tx, r, "WEBHOOK_CREATE", h, nil)
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo crear el webhook")
+		return
+	}
+	WriteJSON(w, http.StatusCreated, webhookSecretResp{Webhook: h, Secret: h.Secret})
+}
+
+// PUT /webhooks/{id} — name, url, events, active (el secreto se rota aparte)
+func WebhooksUpdate(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	var in webhookReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		WriteError(w, http.StatusBadRequest, "json inválido")
+		return
+	}
+	if in.Secret != nil {
+		WriteError(w, http.StatusBadRequest, "el secreto se cambia con POST /webhooks/{id}/rotate-secret")
+		return
+	}
+	if in.Events != nil && len(in.Events) == 0 {
+		WriteError(w, http.StatusBadRequest, "events no puede quedar vacío")
+		return
+	}
+	if !applyWebhook(w, &h, in) {
+		return
+	}
+
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&h).Error; err != nil {
+			return err
+		}
+		return auditWebhook(tx, r, "WEBHOOK_UPDATE", h, nil)
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo actualizar el webhook")
+		return
+	}
+	WriteJSON(w, http.StatusOK, h)
+}
+
+// POST /webhooks/{id}/rotate-secret — las entregas siguientes se firman con el nuevo
+func WebhooksRotateSecret(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo generar el secreto")
+		return
+	}
+	h.Secret = secret
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&h).Update("secret", secret).Error; err != nil {
+			return err
+		}
+		return auditWebhook(tx, r, "WEBHOOK_ROTATE_SECRET", h, nil)
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo rotar el secreto")
+		return
+	}
+	WriteJSON(w, http.StatusOK, webhookSecretResp{Webhook: h, Secret: secret})
+}
+
+// DELETE /webhooks/{id} — borra también su registro de entregas
+func WebhooksDelete(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", h.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&h).Error; err != nil {
+			return err
+		}
+		return auditWebhook(tx, r, "WEBHOOK_DELETE", h, nil)
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo eliminar el webhook")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+/* ===================== Entregas ===================== */
+
+// GET /webhooks/{id}/deliveries?status=PENDING|DELIVERED|FAILED|DEAD&limit=50
+func WebhookDeliveriesList(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	qp := r.URL.Query()
+	q := db.Get().Where("webhook_id = ?", h.ID)
+	if v := strings.ToUpper(qp.Get("status")); v != "" {
+		switch models.WebhookDeliveryStatus(v) {
+		case models.WebhookPending, models.WebhookDelivered, models.WebhookFailed, models.WebhookDead:
+			q = q.Where("status = ?", v)
+		default:
+			WriteError(w, http.StatusBadRequest, "status inválido (PENDING, DELIVERED, FAILED, DEAD)")
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(qp.Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	var list []models.WebhookDelivery
+	if err := q.Order("id DESC").Limit(limit).Find(&list).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudieron listar las entregas")
+		return
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// POST /webhooks/{id}/deliveries/{deliveryId}/replay — reenvía una entrega terminada
+func WebhookDeliveryReplay(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	did, _ := strconv.Atoi(mux.Vars(r)["deliveryId"])
+	var dl models.WebhookDelivery
+	if err := db.Get().Where("webhook_id = ?", h.ID).First(&dl, did).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteError(w, http.StatusNotFound, "entrega no encontrada")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "error consultando la entrega")
+		return
+	}
+
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := webhooks.Replay(tx, &dl); err != nil {
+			return err
+		}
+		return auditWebhook(tx, r, "WEBHOOK_REPLAY", h, map[string]any{
+			"deliveryId": dl.ID,
+			"eventId":    dl.EventID,
+			"eventType":  dl.EventType,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, webhooks.ErrNotReplayable) {
+			WriteError(w, http.StatusConflict, err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "no se pudo reenviar la entrega")
+		return
+	}
+	WriteJSON(w, http.StatusAccepted, dl)
+}
+
+// POST /webhooks/{id}/ping — encola un evento webhook.ping para probar el receptor
+func WebhooksPing(w http.ResponseWriter, r *http.Request) {
+	h, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	var dl *models.WebhookDelivery
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		var err error
+		dl, err = webhooks.Ping(tx, h)
+		return err
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo encolar el ping")
+		return
+	}
+	WriteJSON(w, http.StatusAccepted, dl)
+}
+
+/* ===================== helpers ===================== */
+
+func loadWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var h models.Webhook
+	if err := db.Get().First(&h, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteError(w, http.StatusNotFound, errWebhookNotFound.Error())
+			return h, false
+		}
+		WriteError(w, http.StatusInternalServerError, "error consultando el webhook")
+		return h, false
+	}
+	return h, true
+}
+
+// applyWebhook valida y copia name, url, events y active.
+func applyWebhook(w http.ResponseWriter, h *models.Webhook, in webhookReq) bool {
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" || len(name) > 100 {
+			WriteError(w, http.StatusBadRequest, "name es obligatorio (máx. 100 caracteres)")
+			return false
+		}
+		h.Name = name
+	}
+	if in.URL != nil {
+		raw := strings.TrimSpace(*in.URL)
+		if err := webhooks.CheckURL(raw); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+		h.URL = raw
+	}
+	if len(in.Events) > 0 {
+		events, ok := validWebhookEvents(in.Events)
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "events: tipos válidos son \"*\" o los de GET /realtime/sse ("+strings.Join(realtime.Types, ", ")+")")
+			return false
+		}
+		h.Events = events
+	}
+	if in.Active != nil {
+		h.Active = *in.Active
+	}
+	return true
+}
+
+func validWebhookEvents(in []string) ([]string, bool) {
+	known := make(map[string]bool, len(realtime.Types))
+	for _, t := range realtime.Types {
+		known[t] = true
+	}
+	seen := map[string]bool{}
+	out := make([]string, 0, len(in))
+	for _, e := range in {
+		e = strings.TrimSpace(e)
+		if e != "*" && !known[e] {
+			return nil, false
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out, true
+}
+
+// auditWebhook audita en tx; nunca incluye el secreto.
+func auditWebhook(tx *gorm.DB, r *http.Request, action string, h models.Webhook, extra map[string]any) error {
+	meta := map[string]any{
+		"name":   h.Name,
+		"url":    h.URL,
+		"events": h.Events,
+		"active": h.Active,
+	}
+	for k, v := range extra {
+		meta[k] = v
+	}
+	if me := middleware.UserFromContext(r.Context()); me != nil {
+		meta["by"] = me.ID
+	}
+	b, _ := json.Marshal(meta)
+	return outbox.Audit(tx, async.AuditPayload{
+		Action:   action,
+		Entity:   "webhook",
+		EntityID: h.ID,
+		Meta:     b,
+	})
+}
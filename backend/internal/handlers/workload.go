@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errOverCapacity      = errors.New("el alquimista alcanzó su capacidad de misiones en curso")
+	errSpecialtyMismatch = errors.New("la especialidad del alquimista no coincide con la requerida")
+	errNoCandidate       = errors.New("no hay alquimistas disponibles para la misión")
+)
+
+// defaultCapacity: capacidad para alquimistas creados sin valor explícito.
+func defaultCapacity() int {
+	return db.MustGetInt("ALCHEMIST_DEFAULT_CAPACITY", 3)
+}
+
+// activeMissionCount cuenta las misiones IN_PROGRESS del alquimista, sin contar excludeID.
+func activeMissionCount(tx *gorm.DB, alchemistID, excludeID uint) (int64, error) {
+	var n int64
+	err := tx.Model(&models.Mission{}).
+		Where("assigned_alchemist_id = ? AND status = ? AND id <> ?", alchemistID, models.MissionInProgress, excludeID).
+		Count(&n).Error
+	return n, err
+}
+
+// checkAssignment valida especialidad y capacidad para dejar m asignada a su
+// alquimista; prev es la misión antes del cambio (nil si es nueva). Solo se
+// valida lo que el cambio toca: editar el título de una misión cuyo alquimista
+// cambió después de especialidad, o ya está por encima de una capacidad que
+// se redujo, no debe fallar.
+// Debe llamarse dentro de una transacción: bloquea la fila del alquimista.
+func checkAssignment(tx *gorm.DB, prev *models.Mission, m models.Mission) error {
+	if m.AssignedAlchemistID == nil {
+		return nil
+	}
+	reassigned := prev == nil || prev.AssignedAlchemistID == nil || *prev.AssignedAlchemistID != *m.AssignedAlchemistID
+	checkSpecialty := reassigned || !strings.EqualFold(prev.RequiredSpecialty, m.RequiredSpecialty)
+	checkCapacity := m.Status == models.MissionInProgress && (reassigned || prev.Status != models.MissionInProgress)
+	if !checkSpecialty && !checkCapacity {
+		return nil
+	}
+
+	var a models.Alchemist
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&a, *m.AssignedAlchemistID).Error; err != nil {
+		return err
+	}
+	if checkSpecialty && !a.MatchesSpecialty(m.RequiredSpecialty) {
+		return errSpecialtyMismatch
+	}
+	if !checkCapacity {
+		return nil
+	}
+	active, err := activeMissionCount(tx, a.ID, m.ID)
+	if err != nil {
+		return err
+	}
+	if int(active) >= a.Capacity {
+		return errOverCapacity
+	}
+	return nil
+}
+
+func isAssignmentError(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errOverCapacity) ||
+		errors.Is(err, errSpecialtyMismatch) || errors.Is(err, errNoCandidate)
+}
+
+// writeAssignmentError traduce los errores de checkAssignment a HTTP.
+func writeAssignmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		WriteError(w, http.StatusBadRequest, "assignedAlchemistId inexistente")
+	case errors.Is(err, errOverCapacity), errors.Is(err, errSpecialtyMismatch), errors.Is(err, errNoCandidate):
+		WriteError(w, http.StatusConflict, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, "no se pudo validar la asignación")
+	}
+}
+
+/* ===================== WORKLOAD ===================== */
+
+type workloadResp struct {
+	AlchemistID uint                           `json:"alchemistId"`
+	Name        string                         `json:"name"`
+	Rank        models.AlchemistRank           `json:"rank"`
+	Specialty   string                         `json:"specialty"`
+	Capacity    int                            `json:"capacity"`
+	Active      int64                          `json:"active"`
+	Available   int                            `json:"available"`
+	Utilization float64                        `json:"utilization"`
+	Overdue     int64                          `json:"overdue"`
+	ByStatus    map[models.MissionStatus]int64 `json:"byStatus"`
+}
+
+// GET /alchemists/{id}/workload
+func AlchemistWorkload(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var a models.Alchemist
+	if err := db.DB.First(&a, id).Error; err != nil {
+		WriteError(w, http.StatusNotFound, "alchemist no encontrado")
+		return
+	}
+
+	var rows []struct {
+		Status models.MissionStatus
+		N      int64
+	}
+	if err := db.DB.Model(&models.Mission{}).
+		Select("status, COUNT(*) AS n").
+		Where("assigned_alchemist_id = ?", a.ID).
+		Group("status").Scan(&rows).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo calcular la carga")
+		return
+	}
+
+	var overdue int64
+	if err := db.DB.Model(&models.Mission{}).
+		Where("assigned_alchemist_id = ? AND due_at < ? AND status NOT IN ?", a.ID, time.Now(), models.ClosedMissionStatuses).
+		Count(&overdue).Error; err != nil {
+		WriteError(w, http.StatusInternalServerError, "no se pudo calcular la carga")
+		return
+	}
+
+	out := workloadResp{
+		AlchemistID: a.ID,
+		Name:        a.Name,
+		Rank:        a.Rank,
+		Specialty:   a.Specialty,
+		Capacity:    a.Capacity,
+		Overdue:     overdue,
+		ByStatus:    map[models.MissionStatus]int64{},
+	}
+	for _, row := range rows {
+		out.ByStatus[row.Status] = row.N
+	}
+	out.Active = out.ByStatus[models.MissionInProgress]
+	if avail := a.Capacity - int(out.Active); avail > 0 {
+		out.Available = avail
+	}
+	if a.Capacity > 0 {
+		out.Utilization = float64(out.Active) / float64(a.Capacity)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+/* ===================== AUTO-ASSIGN ===================== */
+
+type assignCandidate struct {
+	Alchemist models.Alchemist `json:"alchemist"`
+	Active    int64            `json:"active"`
+	Load      float64          `json:"load"`
+	RankLevel int              `json:"rankLevel"`
+}
+
+// rankCandidates filtra por especialidad y capacidad y ordena: menor carga
+// relativa, luego mayor rango y por último el ID más bajo.
+func rankCandidates(tx *gorm.DB, m models.Mission) ([]assignCandidate, error) {
+	var alchemists []models.Alchemist
+	if err := tx.Find(&alchemists).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		AssignedAlchemistID uint
+		N                   int64
+	}
+	if err := tx.Model(&models.Mission{}).
+		Select("assigned_alchemist_id, COUNT(*) AS n").
+		Where("status = ? AND assigned_alchemist_id IS NOT NULL AND id <> ?", models.MissionInProgress, m.ID).
+		Group("assigned_alchemist_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	active := map[uint]int64{}
+	for _, c := range counts {
+		active[c.AssignedAlchemistID] = c.N
+	}
+
+	out := make([]assignCandidate, 0, len(alchemists))
+	for _, a := range alchemists {
+		n := active[a.ID]
+		if a.Capacity <= 0 || int(n) >= a.Capacity || !a.MatchesSpecialty(m.RequiredSpecialty) {
+			continue
+		}
+		out = append(out, assignCandidate{
+			Alchemist: a,
+			Active:    n,
+			Load:      float64(n) / float64(a.Capacity),
+			RankLevel: a.Rank.Level(),
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Load != out[j].Load {
+			return out[i].Load < out[j].Load
+		}
+		if out[i].RankLevel != out[j].RankLevel {
+			return out[i].RankLevel > out[j].RankLevel
+		}
+		return out[i].Alchemist.ID < out[j].Alchemist.ID
+	})
+	return out, nil
+}
+
+type autoAssignResp struct {
+	Mission    models.Mission  `json:"mission"`
+	Chosen     assignCandidate `json:"chosen"`
+	Candidates int             `json:"candidates"`
+}
+
+// POST /missions/{id}/auto-assign
+func AutoAssignMission(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var out autoAssignResp
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		var m models.Mission
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&m, id).Error; err != nil {
+			return err
+		}
+		if m.Status.IsClosed() {
+			return fmt.Errorf("%w: misión cerrada", errNoCandidate)
+		}
+
+		candidates, err := rankCandidates(tx, m)
+		if err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return errNoCandidate
+		}
+		chosen := candidates[0]
+
+		prev := m
+		m.AssignedAlchemistID = &chosen.Alchemist.ID
+		if err := checkAssignment(tx, &prev, m); err != nil {
+			return err
+		}
+		if err := tx.Model(&m).Update("assigned_alchemist_id", chosen.Alchemist.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("AssignedAlchemist").First(&m, m.ID).Error; err != nil {
+			return err
+		}
+		out = autoAssignResp{Mission: m, Chosen: chosen, Candidates: len(candidates)}
+
+		meta, _ := json.Marshal(map[string]any{
+			"alchemistId": chosen.Alchemist.ID,
+			"active":      chosen.Active,
+			"capacity":    chosen.Alchemist.Capacity,
+			"candidates":  len(candidates),
+		})
+		if err := outbox.Audit(tx, async.AuditPayload{
+			Action:   "AUTO_ASSIGN",
+			Entity:   "mission",
+			EntityID: m.ID,
+			Meta:     meta,
+		}); err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.MissionUpdated, m.ID, m, m.AssignedAlchemistID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteError(w, http.StatusNotFound, "misión no encontrada")
+			return
+		}
+		writeAssignmentError(w, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"testing"
+
+	"amestris/backend/internal/models"
+)
+
+// Si el cambio no toca alquimista, especialidad ni paso a IN_PROGRESS, no se
+// valida nada (ni se consulta la base: tx es nil).
+func TestCheckAssignmentSinCambiosDeAsignacion(t *testing.T) {
+	alc := uint(7)
+	prev := models.Mission{ID: 1, Title: "antes", Status: models.MissionInProgress, RequiredSpecialty: "Fuego", AssignedAlchemistID: &alc}
+
+	for name, edit := range map[string]func(*models.Mission){
+		"título":                    func(m *models.Mission) { m.Title = "después" },
+		"especialidad en otra caja": func(m *models.Mission) { m.RequiredSpecialty = "fuego" },
+		"mismo alquimista":          func(m *models.Mission) { same := alc; m.AssignedAlchemistID = &same },
+		"sin alquimista":            func(m *models.Mission) { m.AssignedAlchemistID = nil },
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := prev
+			edit(&m)
+			if err := checkAssignment(nil, &prev, m); err != nil {
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"amestris/backend/internal/auth/loginguard"
+	"amestris/backend/internal/auth/revocation"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/metrics"
+	"amestris/backend/internal/models"
+)
+
+// RunAuthCleanup borra revocaciones de access tokens ya vencidas, refresh
+// tokens expirados hace más de un día, contadores de login inactivos y logins
+// SSO sin completar.
+func RunAuthCleanup(ctx context.Context) error {
+	revoked, err := revocation.PurgeExpired(ctx)
+	if err != nil {
+		metrics.JobProcessed(JobAuthCleanup, "db_error")
+		return err
+	}
+
+	res := db.Get().WithContext(ctx).
+		Where("expires_at < ?", time.Now().Add(-24*time.Hour)).
+		Delete(&models.RefreshToken{})
+	if res.Error != nil {
+		metrics.JobProcessed(JobAuthCleanup, "db_error")
+		return res.Error
+	}
+
+	if err := db.Get().WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.OIDCState{}).Error; err != nil {
+		metrics.JobProcessed(JobAuthCleanup, "db_error")
+		return err
+	}
+
+	throttles, err := loginguard.Purge(ctx)
+	if err != nil {
+		metrics.JobProcessed(JobAuthCleanup, "db_error")
+		return err
+	}
+
+	log.Printf("🧹 Limpieza auth: %d revocaciones, %d refresh vencidos y %d contadores de login", revoked, res.RowsAffected, throttles)
+	metrics.JobProcessed(JobAuthCleanup, "ok")
+	return nil
+}
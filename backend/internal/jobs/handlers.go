@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"log"
 
-	"amestris/backend/internal/async"
 	"amestris/backend/internal/db"
 	"amestris/backend/internal/models"
 )
@@ -22,25 +21,6 @@ func jsonOrNil(v any) json.RawMessage {
 	return json.RawMessage(b)
 }
 
-// Guarda un registro de auditoría a partir del payload recibido de la cola.
-func HandleAuditMessage(ctx context.Context, payload async.AuditPayload) error {
-	meta := jsonOrNil(payload.Meta)
-
-	a := models.Audit{
-		Action:   payload.Action,
-		Entity:   payload.Entity,
-		EntityID: payload.EntityID,
-		Meta:     meta,
-	}
-
-	if err := db.DB.Create(&a).Error; err != nil {
-		return err
-	}
-
-	log.Printf("✅ Auditoría registrada: action=%s entity=%s id=%d", a.Action, a.Entity, a.EntityID)
-	return nil
-}
-
 // Crea un registro de auditoría diario (tarea programada).
 func HandleDailyAudit(ctx context.Context) error {
 	metaObj := map[string]any{
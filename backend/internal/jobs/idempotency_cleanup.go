@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/metrics"
+	"amestris/backend/internal/models"
+)
+
+// RunIdempotencyCleanup borra las Idempotency-Key vencidas (IDEMPOTENCY_TTL_HOURS).
+func RunIdempotencyCleanup(ctx context.Context) error {
+	res := db.Get().WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.IdempotencyKey{})
+	if res.Error != nil {
+		metrics.JobProcessed(JobIdempotencyCleanup, "db_error")
+		return res.Error
+	}
+	log.Printf("🧹 Limpieza idempotencia: %d claves vencidas", res.RowsAffected)
+	metrics.JobProcessed(JobIdempotencyCleanup, "ok")
+	return nil
+}
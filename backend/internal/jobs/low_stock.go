@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+// LowStockThreshold: cantidad por debajo de la cual un material se reporta.
+func LowStockThreshold() int {
+	return db.MustGetInt("MATERIAL_LOW_STOCK_THRESHOLD", 5)
+}
+
+// RunLowStockCheck reporta los materiales con stock bajo.
+func RunLowStockCheck(ctx context.Context, threshold int) error {
+	var low []models.Material
+	if err := db.Get().WithContext(ctx).Where("quantity < ?", threshold).Find(&low).Error; err != nil {
+		return err
+	}
+
+	if len(low) == 0 {
+		log.Printf("✅ Verificación stock: ningún material por debajo de %d", threshold)
+		return nil
+	}
+	for _, m := range low {
+		log.Printf("⚠️  Stock bajo: material id=%d name=%q qty=%.2f %s (umbral=%d)",
+			m.ID, m.Name, m.Quantity, m.Unit, threshold)
+	}
+	return nil
+}
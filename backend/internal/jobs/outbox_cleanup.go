@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/metrics"
+	"amestris/backend/internal/models"
+)
+
+// RunOutboxCleanup borra los mensajes del outbox ya entregados hace más de
+// OUTBOX_RETENTION_HOURS y las entregas de webhooks exitosas de hace más de
+// WEBHOOK_LOG_RETENTION_DAYS. Los DEAD quedan para revisarlos a mano.
+func RunOutboxCleanup(ctx context.Context) error {
+	hours := db.MustGetInt("OUTBOX_RETENTION_HOURS", 72)
+	res := db.Get().WithContext(ctx).
+		Where("status = ? AND delivered_at < ?", models.OutboxDelivered, time.Now().Add(-time.Duration(hours)*time.Hour)).
+		Delete(&models.OutboxMessage{})
+	if res.Error != nil {
+		metrics.JobProcessed(JobOutboxCleanup, "db_error")
+		return res.Error
+	}
+
+	days := db.MustGetInt("WEBHOOK_LOG_RETENTION_DAYS", 30)
+	hooks := db.Get().WithContext(ctx).
+		Where("status = ? AND delivered_at < ?", models.WebhookDelivered, time.Now().AddDate(0, 0, -days)).
+		Delete(&models.WebhookDelivery{})
+	if hooks.Error != nil {
+		metrics.JobProcessed(JobOutboxCleanup, "db_error")
+		return hooks.Error
+	}
+
+	log.Printf("🧹 Limpieza outbox: %d mensajes y %d entregas de webhooks", res.RowsAffected, hooks.RowsAffected)
+	metrics.JobProcessed(JobOutboxCleanup, "ok")
+	return nil
+}
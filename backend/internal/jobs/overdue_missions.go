@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/metrics"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
+
+	"gorm.io/gorm"
+)
+
+// RunOverdueMissionsCheck avisa (una sola vez por fecha límite) de las misiones
+// abiertas cuyo dueAt ya pasó.
+func RunOverdueMissionsCheck(ctx context.Context) error {
+	now := time.Now()
+
+	var missions []models.Mission
+	if err := db.Get().WithContext(ctx).
+		Where("due_at < ? AND overdue_notified_at IS NULL AND status NOT IN ?", now, models.ClosedMissionStatuses).
+		Find(&missions).Error; err != nil {
+		metrics.JobProcessed("overdue_missions", "db_error")
+		return err
+	}
+
+	for _, m := range missions {
+		payload := MissionOverduePayload{
+			MissionID:           m.ID,
+			Title:               m.Title,
+			Status:              m.Status,
+			AssignedAlchemistID: m.AssignedAlchemistID,
+			DueAt:               *m.DueAt,
+		}
+		err := db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Mission{}).Where("id = ?", m.ID).
+				UpdateColumn("overdue_notified_at", now).Error; err != nil {
+				return err
+			}
+			a := models.Audit{
+				Action:   "MISSION_OVERDUE",
+				Entity:   "mission",
+				EntityID: m.ID,
+				Meta:     jsonOrNil(payload),
+			}
+			if err := tx.Create(&a).Error; err != nil {
+				return err
+			}
+			return outbox.Event(tx, realtime.MissionOverdue, m.ID, payload, m.AssignedAlchemistID)
+		})
+		if err != nil {
+			log.Printf("❌ Error marcando misión vencida %d: %v", m.ID, err)
+			continue
+		}
+		log.Printf("⏰ Misión vencida: %d — %s (dueAt=%s)", m.ID, m.Title, m.DueAt.Format(time.RFC3339))
+	}
+
+	metrics.JobProcessed("overdue_missions", "ok")
+	return nil
+}
@@ -2,39 +2,57 @@ package jobs
 
 import (
 	"context"
-	"log"
-	"time"
-)
+	"fmt"
 
-// StartDailyJob: lanza una goroutine que ejecuta tareas diarias.
-func StartDailyJobs(ctx context.Context) {
-	go func() {
-		// Ejecuta una vez al inicio
-		runDailyChecks(ctx)
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/scheduler"
+)
 
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
+// Nombres de los jobs programados (clave en scheduled_jobs y en SCHEDULE_<NAME>)
+const (
+	JobDailyAudit         = "daily_audit"
+	JobLowStock           = "low_stock_check"
+	JobStaleMissions      = "stale_missions"
+	JobOverdue            = "overdue_missions"
+	JobAuthCleanup        = "auth_cleanup"
+	JobOutboxCleanup      = "outbox_cleanup"
+	JobIdempotencyCleanup = "idempotency_cleanup"
+)
 
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("⏹ Deteniendo jobs diarios")
-				return
-			case <-ticker.C:
-				runDailyChecks(ctx)
-			}
-		}
-	}()
+// verificationSpec: expresión por defecto de las verificaciones. Respeta el
+// antiguo VERIFY_INTERVAL_SEC si está definido.
+func verificationSpec() string {
+	if n := db.MustGetInt("VERIFY_INTERVAL_SEC", 0); n > 0 {
+		return fmt.Sprintf("@every %ds", n)
+	}
+	return "@daily"
 }
 
-func runDailyChecks(ctx context.Context) {
-	log.Println("🕒 Ejecutando verificaciones diarias...")
+// RegisterScheduled registra en el scheduler los jobs periódicos del worker.
+func RegisterScheduled(s *scheduler.Scheduler) error {
+	spec := verificationSpec()
 
-	// 1) Registrar auditoría diaria
-	if err := HandleDailyAudit(ctx); err != nil {
-		log.Printf("❌ Error en auditoría diaria: %v", err)
+	if err := s.Register(JobDailyAudit, "@daily", HandleDailyAudit); err != nil {
+		return err
 	}
-
-	// 2) Revisar misiones no cerradas de más de 7 días (ejemplo)
-	RunStaleMissionsCheck(7)
+	if err := s.Register(JobLowStock, spec, func(ctx context.Context) error {
+		return RunLowStockCheck(ctx, LowStockThreshold())
+	}); err != nil {
+		return err
+	}
+	if err := s.Register(JobStaleMissions, spec, func(ctx context.Context) error {
+		return RunStaleMissionsCheck(ctx, StaleDays())
+	}); err != nil {
+		return err
+	}
+	if err := s.Register(JobOverdue, "@every 15m", RunOverdueMissionsCheck); err != nil {
+		return err
+	}
+	if err := s.Register(JobAuthCleanup, "@hourly", RunAuthCleanup); err != nil {
+		return err
+	}
+	if err := s.Register(JobOutboxCleanup, "@hourly", RunOutboxCleanup); err != nil {
+		return err
+	}
+	return s.Register(JobIdempotencyCleanup, "@hourly", RunIdempotencyCleanup)
 }
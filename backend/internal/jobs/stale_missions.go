@@ -1,27 +1,168 @@
 package jobs
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"amestris/backend/internal/authz"
 	"amestris/backend/internal/db"
+	"amestris/backend/internal/mail"
+	"amestris/backend/internal/metrics"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
+
+	"gorm.io/gorm"
 )
 
-func RunStaleMissionsCheck(days int) {
-	limit := time.Now().AddDate(0, 0, -days)
+// StaleDays: umbral (en días) sin actividad para considerar una misión estancada.
+func StaleDays() int {
+	return db.MustGetInt("MISSION_STALE_DAYS", 30)
+}
+
+// RunStaleMissionsCheck marca en BD las misiones abiertas sin actividad desde
+// hace más de `days` días y sube su nivel de escalamiento: primero se avisa al
+// alquimista asignado y, si pasan otros `days` días, a los supervisores.
+func RunStaleMissionsCheck(ctx context.Context, days int) error {
+	if days <= 0 {
+		days = StaleDays()
+	}
+	now := time.Now()
+	limit := now.AddDate(0, 0, -days)
 
 	var missions []models.Mission
-	err := db.Get().
-		Where("updated_at < ? AND status != ?", limit, models.MissionCompleted).
+	err := db.Get().WithContext(ctx).
+		Where("updated_at < ? AND status NOT IN ?", limit, models.ClosedMissionStatuses).
 		Find(&missions).Error
-
 	if err != nil {
 		log.Printf("❌ Error revisando misiones viejas: %v", err)
-		return
+		metrics.JobProcessed("stale_missions", "db_error")
+		return err
 	}
 
+	escalated := 0
 	for _, m := range missions {
-		log.Printf("⚠️ Misión vieja detectada: %d — %s (status=%s)", m.ID, m.Title, m.Status)
+		level := staleLevel(now.Sub(m.UpdatedAt), days)
+		// Sin alquimista asignado no hay a quién avisar en el primer nivel
+		if m.AssignedAlchemistID == nil {
+			level = models.EscalationSupervisor
+		}
+		if level <= m.EscalationLevel {
+			continue
+		}
+		if err := escalateMission(ctx, m, level, now); err != nil {
+			log.Printf("❌ Error escalando misión %d: %v", m.ID, err)
+			continue
+		}
+		escalated++
+	}
+
+	log.Printf("🕒 Misiones estancadas: %d detectadas, %d escaladas (umbral=%d días)", len(missions), escalated, days)
+	metrics.JobProcessed("stale_missions", "ok")
+	return nil
+}
+
+func staleLevel(idle time.Duration, days int) int {
+	if idle >= 2*time.Duration(days)*24*time.Hour {
+		return models.EscalationSupervisor
+	}
+	return models.EscalationAlchemist
+}
+
+func escalateMission(ctx context.Context, m models.Mission, level int, now time.Time) error {
+	staleSince := now
+	if m.StaleSince != nil {
+		staleSince = *m.StaleSince
+	}
+
+	notify := "alchemist"
+	if level >= models.EscalationSupervisor {
+		notify = "supervisors"
+	}
+	payload := MissionStalePayload{
+		MissionID:           m.ID,
+		Title:               m.Title,
+		Status:              m.Status,
+		EscalationLevel:     level,
+		Notify:              notify,
+		AssignedAlchemistID: m.AssignedAlchemistID,
+		IdleDays:            int(now.Sub(m.UpdatedAt).Hours() / 24),
+		StaleSince:          staleSince,
+	}
+
+	// Marca, auditoría, evento y correos (outbox) en una sola transacción
+	var notified int
+	err := db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// UpdateColumns no toca updated_at: marcar la misión no cuenta como actividad
+		if err := tx.Model(&models.Mission{}).Where("id = ?", m.ID).
+			UpdateColumns(map[string]any{
+				"stale_since":       staleSince,
+				"escalation_level":  level,
+				"last_escalated_at": now,
+			}).Error; err != nil {
+			return err
+		}
+		a := models.Audit{
+			Action:   "MISSION_STALE",
+			Entity:   "mission",
+			EntityID: m.ID,
+			Meta:     jsonOrNil(payload),
+		}
+		if err := tx.Create(&a).Error; err != nil {
+			return err
+		}
+		// El SSE solo llega a quien esté conectado; el correo queda
+		to, err := escalationRecipients(tx, m, level)
+		if err != nil {
+			return err
+		}
+		for _, u := range to {
+			if err := outbox.Mail(tx, staleMissionMail(u, payload)); err != nil {
+				return err
+			}
+		}
+		notified = len(to)
+		return outbox.Event(tx, realtime.MissionStale, m.ID, payload, m.AssignedAlchemistID)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("⚠️ Misión estancada escalada: %d — %s (nivel=%d, aviso=%s, correos=%d)", m.ID, m.Title, level, notify, notified)
+	metrics.JobProcessed("stale_missions", "escalated")
+	return nil
+}
+
+// escalationRecipients: en el primer nivel, el usuario vinculado al alquimista
+// asignado; en el de supervisores, los usuarios activos cuyo rol puede aprobar
+// misiones (los roles son editables, así que no se fija SUPERVISOR).
+func escalationRecipients(tx *gorm.DB, m models.Mission, level int) ([]models.User, error) {
+	var users []models.User
+	q := tx.Model(&models.User{}).Where("disabled_at IS NULL")
+	if level >= models.EscalationSupervisor {
+		roles, err := authz.RolesWith(tx, authz.MissionsApprove)
+		if err != nil || len(roles) == 0 {
+			return nil, err
+		}
+		err = q.Where("role IN ?", roles).Order("id").Find(&users).Error
+		return users, err
+	}
+	if m.AssignedAlchemistID == nil {
+		return nil, nil
+	}
+	err := q.Where("id = (SELECT user_id FROM alchemists WHERE id = ?)", *m.AssignedAlchemistID).Find(&users).Error
+	return users, err
+}
+
+func staleMissionMail(u models.User, p MissionStalePayload) mail.Message {
+	base := strings.TrimRight(db.MustGetEnv("APP_PUBLIC_URL", "http://localhost:3000"), "/")
+	return mail.Message{
+		To:      u.Email,
+		Subject: fmt.Sprintf("Misión estancada: %s", p.Title),
+		Body: fmt.Sprintf("Hola %s,\n\nLa misión #%d \"%s\" (%s) lleva %d días sin actividad (estancada desde %s).\n%s/missions\n",
+			u.Name, p.MissionID, p.Title, p.Status, p.IdleDays, p.StaleSince.Format("02/01/2006"), base),
 	}
 }
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"time"
 
 	"amestris/backend/internal/db"
 	"amestris/backend/internal/metrics"
 	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+	"amestris/backend/internal/realtime"
 
 	"github.com/hibiken/asynq"
 	"gorm.io/gorm"
@@ -24,6 +27,7 @@ func HandleTransmutationTask(ctx context.Context, t *asynq.Task) error {
 		return err
 	}
 
+	var tm models.Transmutation
 	err := db.Get().Transaction(func(tx *gorm.DB) error {
 		var m models.Material
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
@@ -43,9 +47,10 @@ func HandleTransmutationTask(ctx context.Context, t *asynq.Task) error {
 		}
 
 		// Crear transmutation básica
-		tm := models.Transmutation{
+		tm = models.Transmutation{
 			Title:        p.Title,
 			MaterialID:   p.MaterialID,
+			AlchemistID:  p.AlchemistID,
 			QuantityUsed: p.Quantity,
 			Result:       p.Result,
 		}
@@ -53,7 +58,21 @@ func HandleTransmutationTask(ctx context.Context, t *asynq.Task) error {
 			return err
 		}
 
-		return nil
+		// Eventos por el outbox: salen solo si la transacción hace commit
+		if err := outbox.Event(tx, realtime.TransmutationCreated, tm.ID, realtime.TransmutationPayload{
+			ID:           tm.ID,
+			Title:        tm.Title,
+			MaterialID:   tm.MaterialID,
+			MaterialName: m.Name,
+			AlchemistID:  tm.AlchemistID,
+			QuantityUsed: tm.QuantityUsed,
+			Result:       tm.Result,
+			CreatedAt:    tm.CreatedAt.Format(time.RFC3339),
+		}, tm.AlchemistID); err != nil {
+			return err
+		}
+		return outbox.Event(tx, realtime.MaterialStockChanged, m.ID,
+			realtime.StockChanged(m, -tm.QuantityUsed, realtime.StockTransmutation, &tm.ID), nil)
 	})
 
 	if err != nil {
@@ -1,5 +1,11 @@
 package jobs
 
+import (
+	"time"
+
+	"amestris/backend/internal/models"
+)
+
 // Nombre de la cola donde se encolarán las transmutaciones.
 const QueueTransmutations = "transmutations"
 
@@ -8,8 +14,30 @@ const TaskTransmutation = "transmutations:create"
 
 // Payload que viaja en la tarea.
 type PayloadTransmutation struct {
-	Title      string  `json:"title"`
-	MaterialID uint    `json:"materialId"`
-	Quantity   float64 `json:"quantity"` // cantidad usada
-	Result     *string `json:"result,omitempty"`
+	Title       string  `json:"title"`
+	MaterialID  uint    `json:"materialId"`
+	AlchemistID *uint   `json:"alchemistId,omitempty"` // validado al encolar
+	Quantity    float64 `json:"quantity"`              // cantidad usada
+	Result      *string `json:"result,omitempty"`
+}
+
+// Payload del evento "mission.stale" (SSE y auditoría).
+type MissionStalePayload struct {
+	MissionID           uint                 `json:"missionId"`
+	Title               string               `json:"title"`
+	Status              models.MissionStatus `json:"status"`
+	EscalationLevel     int                  `json:"escalationLevel"`
+	Notify              string               `json:"notify"` // "alchemist" | "supervisors"
+	AssignedAlchemistID *uint                `json:"assignedAlchemistId,omitempty"`
+	IdleDays            int                  `json:"idleDays"`
+	StaleSince          time.Time            `json:"staleSince"`
+}
+
+// Payload del evento "mission.overdue".
+type MissionOverduePayload struct {
+	MissionID           uint                 `json:"missionId"`
+	Title               string               `json:"title"`
+	Status              models.MissionStatus `json:"status"`
+	AssignedAlchemistID *uint                `json:"assignedAlchemistId,omitempty"`
+	DueAt               time.Time            `json:"dueAt"`
 }
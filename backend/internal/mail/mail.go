@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender: implementación de envío de correo (log, archivo, SMTP…).
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	mu     sync.RWMutex
+	sender Sender
+)
+
+// SetSender reemplaza el sender global (p. ej. en pruebas).
+func SetSender(s Sender) {
+	mu.Lock()
+	sender = s
+	mu.Unlock()
+}
+
+// Default devuelve el sender global; si no hay, lo crea desde MAIL_DRIVER.
+func Default() Sender {
+	mu.RLock()
+	s := sender
+	mu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if sender == nil {
+		sender = fromEnv()
+	}
+	return sender
+}
+
+// Send envía con el sender global.
+func Send(ctx context.Context, msg Message) error {
+	return Default().Send(ctx, msg)
+}
+
+func From() string {
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		return v
+	}
+	return "no-reply@amestris.local"
+}
+
+// MAIL_DRIVER=log (default) | file (MAIL_DIR, default ./mail-out)
+func fromEnv() Sender {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DRIVER"))) {
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail-out"
+		}
+		log.Printf("📧 Correos guardados en %s", dir)
+		return FileSender{Dir: dir}
+	default:
+		return LogSender{}
+	}
+}
+
+/* ===================== LogSender ===================== */
+
+// LogSender escribe el correo en el log (desarrollo).
+type LogSender struct{}
+
+func (LogSender) Send(_ context.Context, msg Message) error {
+	log.Printf("📧 [mail] from=%s to=%s subject=%q\n%s", From(), msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+/* ===================== FileSender ===================== */
+
+// FileSender guarda cada correo como archivo .eml en Dir.
+type FileSender struct {
+	Dir string
+}
+
+var unsafeName = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (f FileSender) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(f.Dir, 0o750); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s_%s.eml", now.UTC().Format("20060102T150405.000000000"), unsafeName.ReplaceAllString(msg.To, "_"))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", From())
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return os.WriteFile(filepath.Join(f.Dir, name), []byte(b.String()), 0o640)
+}
@@ -35,7 +35,7 @@ var (
 	// ====== OPCIONAL: métricas de SSE y Workers ======
 	sseClients = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "sse_clients",
-		Help: "Clientes SSE conectados.",
+		Help: "Clientes SSE y WebSocket conectados.",
 	})
 
 	sseEvents = prometheus.NewCounterVec(
@@ -46,6 +46,52 @@ var (
 		[]string{"type"},
 	)
 
+	sseDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sse_events_dropped_total",
+			Help: "Eventos SSE descartados por tipo porque el buffer del cliente estaba lleno.",
+		},
+		[]string{"type"},
+	)
+
+	sseClientDropped = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sse_client_dropped_events",
+		Help:    "Eventos descartados por cliente SSE durante su conexión (se observa al desconectar).",
+		Buckets: []float64{0, 1, 5, 20, 100, 500},
+	})
+
+	sseReplayed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sse_replay_total",
+			Help: "Reconexiones con Last-Event-ID por resultado (ok: reanudada, gap: el buffer ya no tenía los eventos).",
+		},
+		[]string{"result"},
+	)
+
+	wsCommands = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ws_commands_total",
+			Help: "Comandos recibidos por WebSocket por op (subscribe, unsubscribe, ping) y resultado.",
+		},
+		[]string{"op", "result"},
+	)
+
+	outboxDelivered = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "outbox_messages_total",
+			Help: "Mensajes del outbox procesados por tipo y resultado (ok, retry, dead).",
+		},
+		[]string{"kind", "result"},
+	)
+
+	webhookDeliveries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_deliveries_total",
+			Help: "Intentos de entrega de webhooks por resultado (ok, retry, dead).",
+		},
+		[]string{"result"},
+	)
+
 	workerProcessed = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "worker_jobs_total",
@@ -57,7 +103,7 @@ var (
 
 func init() {
 	prometheus.MustRegister(inFlight, httpRequests, httpDuration)
-	prometheus.MustRegister(sseClients, sseEvents, workerProcessed)
+	prometheus.MustRegister(sseClients, sseEvents, sseDropped, sseClientDropped, sseReplayed, wsCommands, outboxDelivered, webhookDeliveries, workerProcessed)
 }
 
 // Handler expone /api/metrics.
@@ -94,6 +140,11 @@ func (w *statusWriter) WriteHeader(code int) {
 	w.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap expone el writer original a http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 /* Hooks opcionales */
 
 // Marca +1 cliente SSE (llamar en AddClient)
@@ -105,6 +156,24 @@ func SSEClientDec() { sseClients.Dec() }
 // Marca 1 evento SSE emitido (llamar en Broadcast)
 func SSEEvent(typ string) { sseEvents.WithLabelValues(typ).Inc() }
 
+// Marca 1 evento SSE descartado para un cliente lento
+func SSEDropped(typ string) { sseDropped.WithLabelValues(typ).Inc() }
+
+// Eventos que perdió un cliente SSE en toda su conexión
+func SSEClientDropped(n int) { sseClientDropped.Observe(float64(n)) }
+
+// Resultado de una reanudación con Last-Event-ID (ok | gap)
+func SSEReplay(result string) { sseReplayed.WithLabelValues(result).Inc() }
+
+// Comando WebSocket procesado (ok | error)
+func WSCommand(op, result string) { wsCommands.WithLabelValues(op, result).Inc() }
+
+// Mensaje del outbox procesado por el relay
+func OutboxDelivered(kind, result string) { outboxDelivered.WithLabelValues(kind, result).Inc() }
+
+// Intento de entrega de un webhook
+func WebhookDelivered(result string) { webhookDeliveries.WithLabelValues(result).Inc() }
+
 // Marca tarea de worker procesada (llamar en worker)
 func JobProcessed(name, result string) {
 	workerProcessed.WithLabelValues(name, result).Inc()
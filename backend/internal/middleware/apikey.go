@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/auth/apikey"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+// API key del request autenticado (nil si se usó un access token)
+const apiKeyCtxKey ctxKey = "apikey"
+
+var ErrAPIKeyInvalid = errors.New("API key inválida, revocada o expirada")
+
+// lastUsedEvery: last_used_at se escribe como mucho una vez por este intervalo
+const lastUsedEvery = time.Minute
+
+func APIKeyFromContext(ctx context.Context) *models.APIKey {
+	k, _ := ctx.Value(apiKeyCtxKey).(*models.APIKey)
+	return k
+}
+
+func AttachAPIKey(r *http.Request, k *models.APIKey) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey, k))
+}
+
+// APIKeyFromRequest extrae la key de "Authorization: ApiKey …" o X-API-Key.
+func APIKeyFromRequest(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get("X-API-Key")); v != "" {
+		return v
+	}
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "ApiKey") {
+		return strings.TrimSpace(parts[1])
+	}
+	return ""
+}
+
+// AuthenticateAPIKey valida la key y el estado de su usuario, y anota el último uso.
+func AuthenticateAPIKey(r *http.Request, raw string) (*models.APIKey, *models.User, error) {
+	prefix, secret, ok := apikey.Split(raw)
+	if !ok {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+	ctx := r.Context()
+
+	var k models.APIKey
+	if err := db.Get().WithContext(ctx).Where("prefix = ?", prefix).First(&k).Error; err != nil {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+	now := time.Now()
+	if !apikey.Matches(secret, k.SecretHash) || !k.Active(now) {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+
+	var u models.User
+	if err := db.Get().WithContext(ctx).First(&u, k.UserID).Error; err != nil {
+		return nil, nil, ErrUserInvalid
+	}
+	if u.IsDisabled() {
+		return nil, nil, ErrUserDisabled
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedEvery {
+		ip := ClientIP(r)
+		if err := db.Get().WithContext(ctx).Model(&k).
+			Updates(map[string]any{"last_used_at": now, "last_used_ip": ip}).Error; err != nil {
+			log.Printf("warn: api key %d: last_used: %v", k.ID, err)
+		}
+		k.LastUsedAt, k.LastUsedIP = &now, ip
+	}
+	return &k, &u, nil
+}
+
+// RequireSession rechaza API keys: para rutas de la propia cuenta (contraseña,
+// sesiones, MFA, crear keys) que solo deben usarse con un login interactivo.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if APIKeyFromContext(r.Context()) != nil {
+			writeJSONError(w, http.StatusForbidden, "no disponible con API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,10 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
-	"net"
+	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"amestris/backend/internal/db"
@@ -22,19 +22,8 @@ func (w *writerWrapper) WriteHeader(code int) {
 	w.ResponseWriter.WriteHeader(code)
 }
 
-// --- util para IP del cliente ---
-func clientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		p := strings.Split(xff, ",")
-		return strings.TrimSpace(p[0])
-	}
-	if xr := r.Header.Get("X-Real-IP"); xr != "" {
-		return xr
-	}
-	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && host != "" {
-		return host
-	}
-	return r.RemoteAddr
+func (w *writerWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 func Audit() func(http.Handler) http.Handler {
@@ -56,9 +45,14 @@ func Audit() func(http.Handler) http.Handler {
 				"method":    r.Method,
 				"status":    ww.status,
 				"userAgent": r.UserAgent(),
-				"ip":        clientIP(r),
+				"ip":        ClientIP(r),
 				"latencyMs": time.Since(start).Milliseconds(),
 			}
+			// Uso de API keys: queda en cada registro HTTP
+			if k := APIKeyFromContext(r.Context()); k != nil {
+				meta["apiKeyId"] = k.ID
+				meta["apiKeyPrefix"] = k.Prefix
+			}
 			raw, _ := json.Marshal(meta)
 
 			a := models.Audit{
@@ -68,9 +62,11 @@ func Audit() func(http.Handler) http.Handler {
 				Meta:     raw,
 			}
 
-			go func() {
-				_ = db.Get().Create(&a).Error
-			}()
+			// Síncrono: una goroutine suelta se perdía al apagar el servidor.
+			// WithoutCancel: se guarda aunque el cliente ya haya cortado.
+			if err := db.Get().WithContext(context.WithoutCancel(r.Context())).Create(&a).Error; err != nil {
+				log.Printf("warn: no se pudo auditar %s %s: %v", r.Method, r.URL.Path, err)
+			}
 		})
 	}
 }
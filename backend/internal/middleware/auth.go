@@ -1,11 +1,16 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	importjwt "amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/auth/revocation"
 	"amestris/backend/internal/db"
 	"amestris/backend/internal/models"
 )
@@ -19,10 +24,82 @@ func writeJSONError(w http.ResponseWriter, status int, msg string) {
 	_ = json.NewEncoder(w).Encode(apiError{Error: msg})
 }
 
-// AuthJWT: middleware de autenticación por JWT.
+// Errores de Authenticate; el mensaje se devuelve tal cual al cliente.
+var (
+	ErrTokenInvalid  = errors.New("Token inválido o expirado")
+	ErrTokenRevoked  = errors.New("Token revocado")
+	ErrUserInvalid   = errors.New("Usuario no válido")
+	ErrUserDisabled  = errors.New("Usuario deshabilitado")
+	ErrRevocationErr = errors.New("No se pudo verificar el token")
+)
+
+// Authenticate valida firma y expiración del access token, la lista de
+// revocación (jti y sesión) y el estado actual del usuario en BD.
+func Authenticate(ctx context.Context, token string) (*importjwt.Claims, *models.User, error) {
+	claims, err := importjwt.ParseToken(token)
+	if err != nil {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	keys := make([]string, 0, 2)
+	if claims.ID != "" {
+		keys = append(keys, revocation.JTIKey(claims.ID))
+	}
+	if claims.SessionID != "" {
+		keys = append(keys, revocation.SessionKey(claims.SessionID))
+	}
+	for _, k := range keys {
+		revoked, err := revocation.IsRevoked(ctx, k)
+		if err != nil {
+			log.Printf("❌ revocación: %v", err)
+			return nil, nil, ErrRevocationErr
+		}
+		if revoked {
+			return nil, nil, ErrTokenRevoked
+		}
+	}
+
+	// (Re)validar usuario desde la base de datos y obtener rol actualizado
+	var u models.User
+	if err := db.DB.WithContext(ctx).First(&u, claims.UserID).Error; err != nil {
+		return nil, nil, ErrUserInvalid
+	}
+	if u.IsDisabled() {
+		return nil, nil, ErrUserDisabled
+	}
+	if u.TokensInvalidBefore != nil && claims.IssuedAt != nil &&
+		claims.IssuedAt.Time.Before(u.TokensInvalidBefore.Truncate(time.Second)) {
+		return nil, nil, ErrTokenRevoked
+	}
+	return claims, &u, nil
+}
+
+// BearerToken extrae el token de "Authorization: Bearer …" ("" si no hay).
+func BearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// AuthJWT: middleware de autenticación por JWT o API key
+// ("Authorization: ApiKey amk_…" o "X-API-Key: amk_…").
 
 func AuthJWT(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if raw := APIKeyFromRequest(r); raw != "" {
+			k, u, err := AuthenticateAPIKey(r, raw)
+			if err != nil {
+				writeJSONError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			r = AttachUser(r, u)
+			r = AttachAPIKey(r, k)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		authz := r.Header.Get("Authorization")
 		if authz == "" {
 			writeJSONError(w, http.StatusUnauthorized, "Falta encabezado Authorization Bearer")
@@ -40,22 +117,23 @@ func AuthJWT(next http.Handler) http.Handler {
 			return
 		}
 
-		// Parsear y validar token
-		claims, err := importjwt.ParseToken(token)
+		// Parsear, validar token y usuario
+		claims, u, err := Authenticate(r.Context(), token)
 		if err != nil {
-			writeJSONError(w, http.StatusUnauthorized, "Token inválido o expirado")
-			return
-		}
-
-		// (Re)validar usuario desde la base de datos y obtener rol actualizado
-		var u models.User
-		if err := db.DB.First(&u, claims.UserID).Error; err != nil {
-			writeJSONError(w, http.StatusUnauthorized, "Usuario no válido")
+			status := http.StatusUnauthorized
+			if errors.Is(err, ErrRevocationErr) {
+				status = http.StatusServiceUnavailable
+			}
+			writeJSONError(w, status, err.Error())
 			return
 		}
 
 		// Adjuntar usuario al contexto para que otros middlewares/handlers lo lean
-		r = AttachUser(r, &u)
+		r = AttachUser(r, u)
+		if claims.SessionID != "" {
+			r = AttachSessionID(r, claims.SessionID)
+		}
+		r = AttachClaims(r, claims)
 
 		next.ServeHTTP(w, r)
 	})
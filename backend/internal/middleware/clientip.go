@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedOnce sync.Once
+	trustedNets []*net.IPNet
+)
+
+// trustedProxies: TRUSTED_PROXIES=10.0.0.0/8,172.16.0.1,... (IPs o CIDRs).
+// Solo se leen X-Forwarded-For / X-Real-IP si la petición llega desde uno de ellos.
+func trustedProxies() []*net.IPNet {
+	trustedOnce.Do(func() {
+		for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			if !strings.Contains(p, "/") {
+				if strings.Contains(p, ":") {
+					p += "/128"
+				} else {
+					p += "/32"
+				}
+			}
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				log.Printf("warn: TRUSTED_PROXIES: %q inválido", p)
+				continue
+			}
+			trustedNets = append(trustedNets, n)
+		}
+	})
+	return trustedNets
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies() {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP: IP del cliente. Parte de RemoteAddr y, mientras el salto sea un
+// proxy de confianza, recorre X-Forwarded-For de derecha a izquierda; la
+// primera IP no confiable es el cliente. Así un X-Forwarded-For inventado
+// por el cliente no sirve para suplantar otra IP.
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrustedProxy(net.ParseIP(remote)) {
+		return remote
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				break
+			}
+			if !isTrustedProxy(ip) || i == 0 {
+				return ip.String()
+			}
+		}
+	}
+	if xr := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xr) != nil {
+		return xr
+	}
+	return remote
+}
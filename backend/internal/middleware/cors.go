@@ -10,6 +10,12 @@ var allowedOrigins = map[string]bool{
 	"http://127.0.0.1:3001": true,
 }
 
+// AllowedOrigin: el origen está en la lista blanca (p. ej. para aceptar el
+// handshake de WebSocket, que no pasa por CORS).
+func AllowedOrigin(origin string) bool {
+	return allowedOrigins[origin]
+}
+
 // Middleware principal de CORS
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -24,7 +30,7 @@ func CORS(next http.Handler) http.Handler {
 
 		w.Header().Set("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, X-API-Key, Idempotency-Key")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		// Si es un preflight, responder directamente
@@ -49,7 +55,7 @@ func Preflight(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, X-API-Key, Idempotency-Key")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+// HeaderIdempotencyKey: clave que el cliente repite en los reintentos de un POST.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+const (
+	maxIdempotencyKey  = 255
+	maxIdempotencyBody = 1 << 20
+	// Hasta aquí una clave sin respuesta se considera en curso (409 con
+	// Retry-After). Pasado este tiempo probablemente el proceso cayó, pero
+	// no se sabe si antes o después de aplicar el cambio: la clave sigue
+	// retenida hasta expires_at y el reintento recibe 409 sin Retry-After.
+	idempotencyInFlight = time.Minute
+)
+
+var (
+	errIdempotencyMismatch = errors.New("Idempotency-Key ya usada con otra petición")
+	errIdempotencyInFlight = errors.New("hay una petición en curso con esta Idempotency-Key")
+	errIdempotencyUnknown  = errors.New("la petición original con esta Idempotency-Key no terminó; comprueba si se aplicó y usa otra clave")
+)
+
+// IdempotencyTTL: cuánto se guarda cada respuesta (IDEMPOTENCY_TTL_HOURS).
+func IdempotencyTTL() time.Duration {
+	return time.Duration(db.MustGetInt("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour
+}
+
+// Idempotency: un POST con Idempotency-Key se ejecuta una sola vez por usuario
+// y clave. Los reintentos con el mismo método, ruta y cuerpo reciben la
+// respuesta guardada (con Idempotent-Replayed: true); con otro cuerpo, 422;
+// mientras la original sigue en curso o si no llegó a terminar, 409 (nunca se
+// vuelve a ejecutar antes de que venza la clave). Solo se guardan respuestas
+// 2xx: tras un error la clave queda libre para reintentar. Va después de AuthJWT.
+func Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(HeaderIdempotencyKey))
+		u := UserFromContext(r.Context())
+		if key == "" || r.Method != http.MethodPost || u == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if len(key) > maxIdempotencyKey {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Idempotency-Key admite hasta %d caracteres", maxIdempotencyKey))
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotencyBody+1))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "no se pudo leer el cuerpo")
+			return
+		}
+		if len(body) > maxIdempotencyBody {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "cuerpo demasiado grande para Idempotency-Key")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := context.WithoutCancel(r.Context())
+		row, stored, err := claimIdempotencyKey(ctx, u.ID, key, requestHash(r, body), r)
+		switch {
+		case errors.Is(err, errIdempotencyMismatch):
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		case errors.Is(err, errIdempotencyInFlight):
+			w.Header().Set("Retry-After", "1")
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		case errors.Is(err, errIdempotencyUnknown):
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			log.Printf("warn: idempotency: %v", err)
+			writeJSONError(w, http.StatusServiceUnavailable, "no se pudo comprobar la Idempotency-Key")
+			return
+		case stored != nil:
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.StatusCode)
+			_, _ = w.Write(stored.ResponseBody)
+			return
+		}
+		w.Header().Del("Content-Type")
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		finishIdempotencyKey(ctx, row, rec)
+	})
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claimIdempotencyKey reserva la clave (row) o devuelve la respuesta guardada
+// (stored). Solo se reutiliza una clave vencida.
+func claimIdempotencyKey(ctx context.Context, userID uint, key, hash string, r *http.Request) (row, stored *models.IdempotencyKey, err error) {
+	now := time.Now()
+	fresh := models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: hash,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		ExpiresAt:   now.Add(IdempotencyTTL()),
+		CreatedAt:   now,
+	}
+	res := db.Get().WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&fresh)
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return &fresh, nil, nil
+	}
+
+	var ex models.IdempotencyKey
+	if err := db.Get().WithContext(ctx).Where("user_id = ? AND key = ?", userID, key).First(&ex).Error; err != nil {
+		return nil, nil, err
+	}
+	expired := now.After(ex.ExpiresAt)
+	switch {
+	case !expired && ex.RequestHash != hash:
+		return nil, nil, errIdempotencyMismatch
+	case !expired && ex.StatusCode != 0:
+		return nil, &ex, nil
+	case !expired && now.Sub(ex.CreatedAt) < idempotencyInFlight:
+		return nil, nil, errIdempotencyInFlight
+	case !expired:
+		return nil, nil, errIdempotencyUnknown
+	}
+
+	// Vencida: se toma solo si nadie se adelantó (created_at igual)
+	res = db.Get().WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("id = ? AND created_at = ?", ex.ID, ex.CreatedAt).
+		Updates(map[string]any{
+			"request_hash":  hash,
+			"method":        r.Method,
+			"path":          r.URL.Path,
+			"status_code":   0,
+			"content_type":  "",
+			"response_body": nil,
+			"expires_at":    fresh.ExpiresAt,
+			"created_at":    now,
+		})
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil, errIdempotencyInFlight
+	}
+	fresh.ID = ex.ID
+	return &fresh, nil, nil
+}
+
+// finishIdempotencyKey guarda la respuesta 2xx o libera la clave. Si no llega
+// a correr (caída) o falla al guardar, la clave queda retenida sin respuesta.
+func finishIdempotencyKey(ctx context.Context, row *models.IdempotencyKey, rec *idempotencyRecorder) {
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var err error
+	if status >= 200 && status < 300 {
+		err = db.Get().WithContext(ctx).Model(&models.IdempotencyKey{}).Where("id = ?", row.ID).
+			Updates(map[string]any{
+				"status_code":   status,
+				"content_type":  rec.Header().Get("Content-Type"),
+				"response_body": rec.body.Bytes(),
+			}).Error
+	} else {
+		err = db.Get().WithContext(ctx).Delete(&models.IdempotencyKey{}, row.ID).Error
+	}
+	if err != nil {
+		log.Printf("warn: idempotency: no se pudo cerrar la clave %d: %v", row.ID, err)
+	}
+}
+
+// idempotencyRecorder copia status y cuerpo mientras escribe al cliente.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -16,6 +16,11 @@ func (sr *statusRecorder) WriteHeader(code int) {
 	sr.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap permite a http.ResponseController llegar al writer original (Flush del SSE).
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
 type logEntry struct {
 	Level      string  `json:"level"`
 	Msg        string  `json:"msg"`
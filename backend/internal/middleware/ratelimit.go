@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -43,15 +42,6 @@ func init() {
 	}()
 }
 
-func getIP(r *http.Request) string {
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		return xff
-	}
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return ip
-}
-
 func getVisitor(ip string) *rate.Limiter {
 	visitorsMu.Lock()
 	defer visitorsMu.Unlock()
@@ -79,7 +69,7 @@ func cleanupVisitors() {
 
 func RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := getIP(r)
+		ip := ClientIP(r)
 		lim := getVisitor(ip)
 		if !lim.Allow() {
 			w.WriteHeader(http.StatusTooManyRequests)
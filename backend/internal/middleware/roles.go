@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"strings"
 
+	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/authz"
 	"amestris/backend/internal/models"
 )
 
@@ -12,6 +15,12 @@ import (
 // Debe coincidir con la que usa AuthJWT.
 const userCtxKey ctxKey = "user"
 
+// Sesión (sid del access token) del request autenticado
+const sessionCtxKey ctxKey = "session"
+
+// Claims del access token del request autenticado
+const claimsCtxKey ctxKey = "claims"
+
 // Helpers de contexto
 
 func UserFromContext(ctx context.Context) *models.User {
@@ -27,7 +36,85 @@ func AttachUser(r *http.Request, u *models.User) *http.Request {
 	return r.WithContext(context.WithValue(r.Context(), userCtxKey, u))
 }
 
-// Autorización por roles
+func SessionIDFromContext(ctx context.Context) string {
+	s, _ := ctx.Value(sessionCtxKey).(string)
+	return s
+}
+
+func AttachSessionID(r *http.Request, sid string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionCtxKey, sid))
+}
+
+func ClaimsFromContext(ctx context.Context) *jwtutil.Claims {
+	c, _ := ctx.Value(claimsCtxKey).(*jwtutil.Claims)
+	return c
+}
+
+func AttachClaims(r *http.Request, c *jwtutil.Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsCtxKey, c))
+}
+
+// Autorización por permisos
+
+// Permissions devuelve los permisos efectivos del request: los del rol actual
+// del usuario (BD con caché, no el claim perms, para que un cambio de rol o de
+// permisos se aplique sin esperar a que caduque el token), limitados a los
+// scopes si se autenticó con API key.
+func Permissions(ctx context.Context) (authz.Set, error) {
+	u := UserFromContext(ctx)
+	if u == nil {
+		return authz.Set{}, nil
+	}
+	perms, err := authz.ForRole(ctx, string(u.Role))
+	if err != nil {
+		return nil, err
+	}
+	if k := APIKeyFromContext(ctx); k != nil {
+		perms = perms.Intersect(k.Scopes)
+	}
+	return perms, nil
+}
+
+// Allowed: comprobación dentro de handlers; un error cuenta como "no".
+func Allowed(ctx context.Context, perm string) bool {
+	perms, err := Permissions(ctx)
+	if err != nil {
+		log.Printf("❌ authz: %v", err)
+		return false
+	}
+	return perms.Has(perm)
+}
+
+// Can indica si el request autenticado tiene el permiso.
+func Can(r *http.Request, perm string) bool {
+	return Allowed(r.Context(), perm)
+}
+
+// RequirePermission: mux.MiddlewareFunc que exige TODOS los permisos indicados
+func RequirePermission(perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if UserFromContext(r.Context()) == nil {
+				writeJSONError(w, http.StatusUnauthorized, "no autenticado")
+				return
+			}
+			have, err := Permissions(r.Context())
+			if err != nil {
+				writeJSONError(w, http.StatusServiceUnavailable, "no se pudieron resolver los permisos")
+				return
+			}
+			for _, p := range perms {
+				if !have.Has(p) {
+					writeJSONError(w, http.StatusForbidden, "sin permiso: "+p)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Autorización por roles (anterior a los permisos; se mantiene por compatibilidad)
 
 // RequireRole: wrapper para HANDLERS
 func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/auth/revocation"
+	"amestris/backend/internal/authz"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+var ErrTicketInvalid = errors.New("Ticket de stream inválido, expirado o ya usado")
+
+// AuthStream: como AuthJWT, pero acepta además ?ticket= (POST /realtime/ticket)
+// para clientes EventSource, que no pueden enviar cabeceras.
+func AuthStream(next http.Handler) http.Handler {
+	withHeaders := AuthJWT(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			withHeaders.ServeHTTP(w, r)
+			return
+		}
+		c, u, k, err := AuthenticateTicket(r.Context(), ticket)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, ErrRevocationErr) {
+				status = http.StatusServiceUnavailable
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		r = AttachUser(r, u)
+		if c.SessionID != "" {
+			r = AttachSessionID(r, c.SessionID)
+		}
+		if k != nil {
+			r = AttachAPIKey(r, k)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthenticateTicket valida el ticket, lo marca como usado (lista de
+// revocación hasta su expiración) y revalida sesión, API key y usuario.
+func AuthenticateTicket(ctx context.Context, ticket string) (*jwtutil.StreamClaims, *models.User, *models.APIKey, error) {
+	c, err := jwtutil.ParseStreamTicket(ticket)
+	if err != nil || c.ID == "" {
+		return nil, nil, nil, ErrTicketInvalid
+	}
+
+	keys := []string{revocation.JTIKey(c.ID)}
+	if c.SessionID != "" {
+		keys = append(keys, revocation.SessionKey(c.SessionID))
+	}
+	for _, key := range keys {
+		revoked, err := revocation.IsRevoked(ctx, key)
+		if err != nil {
+			log.Printf("❌ revocación: %v", err)
+			return nil, nil, nil, ErrRevocationErr
+		}
+		if revoked {
+			return nil, nil, nil, ErrTicketInvalid
+		}
+	}
+	// Un solo uso: las reconexiones piden un ticket nuevo
+	if err := revocation.Revoke(ctx, revocation.JTIKey(c.ID), c.ExpiresAt.Time); err != nil {
+		log.Printf("❌ revocación: %v", err)
+		return nil, nil, nil, ErrRevocationErr
+	}
+
+	var k *models.APIKey
+	if c.APIKeyID != 0 {
+		k = &models.APIKey{}
+		if err := db.Get().WithContext(ctx).First(k, c.APIKeyID).Error; err != nil || !k.Active(time.Now()) {
+			return nil, nil, nil, ErrAPIKeyInvalid
+		}
+	}
+
+	var u models.User
+	if err := db.Get().WithContext(ctx).First(&u, c.UserID).Error; err != nil {
+		return nil, nil, nil, ErrUserInvalid
+	}
+	if u.IsDisabled() {
+		return nil, nil, nil, ErrUserDisabled
+	}
+	if u.TokensInvalidBefore != nil && c.IssuedAt != nil &&
+		c.IssuedAt.Time.Before(u.TokensInvalidBefore.Truncate(time.Second)) {
+		return nil, nil, nil, ErrTokenRevoked
+	}
+	return c, &u, k, nil
+}
+
+// Revalidate comprueba, para conexiones largas, que el usuario, la sesión y
+// la API key del contexto siguen vigentes, y devuelve los permisos actuales
+// (rol ∩ scopes).
+func Revalidate(ctx context.Context) (authz.Set, error) {
+	cur := UserFromContext(ctx)
+	if cur == nil {
+		return nil, ErrUserInvalid
+	}
+	var u models.User
+	if err := db.Get().WithContext(ctx).First(&u, cur.ID).Error; err != nil {
+		return nil, ErrUserInvalid
+	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+	// logout-all, cambio de contraseña o rol: invalida lo emitido antes
+	if u.TokensInvalidBefore != nil && (cur.TokensInvalidBefore == nil || u.TokensInvalidBefore.After(*cur.TokensInvalidBefore)) {
+		return nil, ErrTokenRevoked
+	}
+	if sid := SessionIDFromContext(ctx); sid != "" {
+		revoked, err := revocation.IsRevoked(ctx, revocation.SessionKey(sid))
+		if err != nil {
+			return nil, ErrRevocationErr
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	perms, err := authz.ForRole(ctx, string(u.Role))
+	if err != nil {
+		return nil, err
+	}
+	if k := APIKeyFromContext(ctx); k != nil {
+		var key models.APIKey
+		if err := db.Get().WithContext(ctx).First(&key, k.ID).Error; err != nil || !key.Active(time.Now()) {
+			return nil, ErrAPIKeyInvalid
+		}
+		perms = perms.Intersect(key.Scopes)
+	}
+	return perms, nil
+}
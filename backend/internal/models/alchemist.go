@@ -1,12 +1,73 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+type AlchemistRank string
+
+const (
+	RankApprentice AlchemistRank = "Apprentice"
+	RankJourneyman AlchemistRank = "Journeyman"
+	RankExpert     AlchemistRank = "Expert"
+	RankState      AlchemistRank = "State"
+	RankMaster     AlchemistRank = "Master"
+)
+
+// Ranks en orden ascendente de experiencia
+var Ranks = []AlchemistRank{RankApprentice, RankJourneyman, RankExpert, RankState, RankMaster}
+
+// Rareza máxima de material que puede transmutar cada rango
+var rankMaxRarity = map[AlchemistRank]MaterialRarity{
+	RankApprentice: RarityCommon,
+	RankJourneyman: RarityUncommon,
+	RankExpert:     RarityRare,
+	RankState:      RarityRare,
+	RankMaster:     RarityLegendary,
+}
+
+// ParseRank normaliza el rango sin distinguir mayúsculas.
+func ParseRank(s string) (AlchemistRank, bool) {
+	s = strings.TrimSpace(s)
+	for _, r := range Ranks {
+		if strings.EqualFold(s, string(r)) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// Level devuelve la posición del rango (1 = Apprentice); 0 si no es válido.
+func (r AlchemistRank) Level() int {
+	for i, v := range Ranks {
+		if v == r {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// CanTransmute indica si el rango permite usar un material de esa rareza.
+func (r AlchemistRank) CanTransmute(rarity MaterialRarity) bool {
+	max, ok := rankMaxRarity[r]
+	return ok && rarity.Level() <= max.Level()
+}
 
 type Alchemist struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name" gorm:"type:text;not null"`
-	Rank      string    `json:"rank" gorm:"type:text;not null;default:Apprentice"`
-	Specialty string    `json:"specialty" gorm:"type:text"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID                uint          `json:"id" gorm:"primaryKey"`
+	Name              string        `json:"name" gorm:"type:text;not null"`
+	Rank              AlchemistRank `json:"rank" gorm:"type:text;not null;default:Apprentice"`
+	Specialty         string        `json:"specialty" gorm:"type:text"`
+	Capacity          int           `json:"capacity" gorm:"not null;default:3"` // máx. misiones IN_PROGRESS simultáneas
+	UserID            *uint         `json:"userId" gorm:"uniqueIndex"`          // usuario vinculado (opcional)
+	CalendarTokenHash string        `json:"-" gorm:"size:64;index"`             // hash del token del feed .ics
+	CreatedAt         time.Time     `json:"createdAt"`
+	UpdatedAt         time.Time     `json:"updatedAt"`
+}
+
+// MatchesSpecialty compara especialidades sin distinguir mayúsculas.
+func (a Alchemist) MatchesSpecialty(required string) bool {
+	required = strings.TrimSpace(required)
+	return required == "" || strings.EqualFold(strings.TrimSpace(a.Specialty), required)
 }
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// API key (ver auth/apikey). Actúa como UserID con los permisos de su rol
+// limitados a Scopes.
+type APIKey struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"type:text;not null"`
+	Kind        string     `json:"kind" gorm:"type:text;not null"` // PERSONAL | SERVICE
+	UserID      uint       `json:"userId" gorm:"not null;index"`
+	Prefix      string     `json:"prefix" gorm:"size:16;uniqueIndex;not null"`
+	SecretHash  string     `json:"-" gorm:"size:64;not null"`
+	Scopes      []string   `json:"scopes" gorm:"serializer:json;type:jsonb;not null"`
+	CreatedByID uint       `json:"createdById" gorm:"not null"`
+	ExpiresAt   time.Time  `json:"expiresAt" gorm:"not null;index"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP  string     `json:"lastUsedIp,omitempty" gorm:"type:text"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
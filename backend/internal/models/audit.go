@@ -11,5 +11,6 @@ type Audit struct {
 	Entity    string          `json:"entity"`
 	EntityID  uint            `json:"entityId"`
 	Meta      json.RawMessage `gorm:"type:jsonb" json:"meta"`
+	DedupeKey *string         `gorm:"size:64;uniqueIndex" json:"-"` // clave del outbox
 	CreatedAt time.Time       `json:"createdAt"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Sesión de login: agrupa la familia de refresh tokens que se rotan a partir
+// de un mismo login. Revocar la sesión invalida todos sus refresh.
+type AuthSession struct {
+	ID            string     `json:"id" gorm:"primaryKey;size:64"`
+	UserID        uint       `json:"userId" gorm:"not null;index"`
+	UserAgent     string     `json:"userAgent" gorm:"type:text"`
+	IP            string     `json:"ip" gorm:"type:text"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	LastUsedAt    time.Time  `json:"lastUsedAt"`
+	ExpiresAt     time.Time  `json:"expiresAt" gorm:"not null;index"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty" gorm:"index"`
+	RevokedReason string     `json:"revokedReason,omitempty" gorm:"type:text"` // logout | reuse | password_reset | …
+}
+
+func (AuthSession) TableName() string {
+	return "auth_sessions"
+}
+
+// Motivos de revocación de sesión
+const (
+	SessionRevokedLogout   = "logout"
+	SessionRevokedUser     = "user"
+	SessionRevokedReuse    = "reuse"
+	SessionRevokedPassword = "password_change"
+	SessionRevokedReset    = "password_reset"
+	SessionRevokedDisabled = "user_disabled"
+	SessionRevokedMFAReset = "mfa_reset"
+)
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Respuesta guardada de un POST con Idempotency-Key, por usuario y clave.
+// StatusCode 0 = la petición original sigue en curso.
+type IdempotencyKey struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"userId" gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key,priority:1"`
+	Key          string    `json:"key" gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_user_key,priority:2"`
+	RequestHash  string    `json:"-" gorm:"size:64;not null"` // sha256 de método, ruta y cuerpo
+	Method       string    `json:"method" gorm:"size:10;not null"`
+	Path         string    `json:"path" gorm:"type:text;not null"`
+	StatusCode   int       `json:"statusCode" gorm:"not null;default:0"`
+	ContentType  string    `json:"-" gorm:"type:text"`
+	ResponseBody []byte    `json:"-" gorm:"type:bytea"`
+	ExpiresAt    time.Time `json:"expiresAt" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
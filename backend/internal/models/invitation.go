@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "PENDING"
+	InvitationAccepted InvitationStatus = "ACCEPTED"
+	InvitationRevoked  InvitationStatus = "REVOKED"
+	InvitationExpired  InvitationStatus = "EXPIRED"
+)
+
+// Invitación de alta: token de un solo uso ligado a email + rol
+type Invitation struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Email          string     `json:"email" gorm:"type:text;not null;index"`
+	Role           UserRole   `json:"role" gorm:"type:text;not null"`
+	TokenHash      string     `json:"-" gorm:"not null;size:128;uniqueIndex"` // hash del token enviado por correo
+	ExpiresAt      time.Time  `json:"expiresAt" gorm:"not null;index"`
+	AcceptedAt     *time.Time `json:"acceptedAt,omitempty"`
+	AcceptedUserID *uint      `json:"acceptedUserId,omitempty"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+	InvitedByID    uint       `json:"invitedById" gorm:"not null"`
+	InvitedBy      *User      `json:"invitedBy,omitempty" gorm:"foreignKey:InvitedByID"`
+	CreatedAt      time.Time  `json:"createdAt"`
+
+	Status InvitationStatus `json:"status" gorm:"-"`
+}
+
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+func (i Invitation) StatusAt(now time.Time) InvitationStatus {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
+
+// AfterFind calcula el estado al leer de BD
+func (i *Invitation) AfterFind(_ *gorm.DB) error {
+	i.Status = i.StatusAt(time.Now())
+	return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Contador de intentos de login fallidos. Key es "acct:<email>" o "ip:<ip>".
+// NextAttemptAt aplica el retraso progresivo; LockedUntil el bloqueo temporal.
+// Pending: intentos reservados aún sin resultado (ver loginguard.Reserve).
+type LoginThrottle struct {
+	Key           string     `json:"key" gorm:"primaryKey;size:320"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	FirstFailedAt time.Time  `json:"firstFailedAt"`
+	LastFailedAt  time.Time  `json:"lastFailedAt" gorm:"index"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" gorm:"index"`
+	Lockouts      int        `json:"lockouts" gorm:"not null;default:0"`
+	Pending       int        `json:"pending" gorm:"not null;default:0"`
+	ReservedAt    *time.Time `json:"reservedAt,omitempty"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
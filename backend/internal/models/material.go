@@ -1,6 +1,45 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+type MaterialRarity string
+
+const (
+	RarityCommon    MaterialRarity = "COMMON"
+	RarityUncommon  MaterialRarity = "UNCOMMON"
+	RarityRare      MaterialRarity = "RARE"
+	RarityLegendary MaterialRarity = "LEGENDARY"
+)
+
+// Rarities en orden ascendente
+var Rarities = []MaterialRarity{RarityCommon, RarityUncommon, RarityRare, RarityLegendary}
+
+// ParseRarity normaliza la rareza; vacío equivale a COMMON.
+func ParseRarity(s string) (MaterialRarity, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return RarityCommon, true
+	}
+	for _, r := range Rarities {
+		if s == string(r) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// Level: 1 = COMMON; valores desconocidos cuentan como COMMON.
+func (r MaterialRarity) Level() int {
+	for i, v := range Rarities {
+		if v == r {
+			return i + 1
+		}
+	}
+	return 1
+}
 
 type Material struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -12,3 +51,14 @@ type Material struct {
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// RarityValue devuelve la rareza normalizada del material.
+func (m Material) RarityValue() MaterialRarity {
+	if m.Rarity == nil {
+		return RarityCommon
+	}
+	if r, ok := ParseRarity(*m.Rarity); ok {
+		return r
+	}
+	return RarityCommon
+}
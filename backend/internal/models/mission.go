@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type MissionStatus string
 
@@ -12,15 +16,52 @@ const (
 	MissionRejected   MissionStatus = "REJECTED"
 )
 
+// Estados en los que la misión ya no requiere trabajo
+var ClosedMissionStatuses = []MissionStatus{MissionCompleted, MissionRejected}
+
+func (s MissionStatus) IsClosed() bool {
+	for _, c := range ClosedMissionStatuses {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Niveles de escalamiento para misiones estancadas
+const (
+	EscalationNone       = 0
+	EscalationAlchemist  = 1 // se notifica al alquimista asignado
+	EscalationSupervisor = 2 // se notifica a los supervisores
+)
+
 type Mission struct {
 	ID                  uint          `json:"id" gorm:"primaryKey"`
 	Title               string        `json:"title" gorm:"type:text;not null"`
 	Description         string        `json:"description" gorm:"type:text"`
 	Status              MissionStatus `json:"status" gorm:"type:text;default:PENDING;not null"`
+	RequiredSpecialty   string        `json:"requiredSpecialty" gorm:"type:text"`
 	AssignedAlchemistID *uint         `json:"assignedAlchemistId" gorm:"index"`
 	AssignedAlchemist   *Alchemist    `json:"assignedAlchemist" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
-	ScheduledAt         *time.Time    `json:"scheduledAt"`
+	ScheduledAt         *time.Time    `json:"scheduledAt" gorm:"index"`
+	DueAt               *time.Time    `json:"dueAt" gorm:"index"`
+	Overdue             bool          `json:"overdue" gorm:"-"`
+	OverdueNotifiedAt   *time.Time    `json:"overdueNotifiedAt,omitempty"`
 	CompletedAt         *time.Time    `json:"completedAt"`
+	StaleSince          *time.Time    `json:"staleSince" gorm:"index"`
+	EscalationLevel     int           `json:"escalationLevel" gorm:"not null;default:0"`
+	LastEscalatedAt     *time.Time    `json:"lastEscalatedAt"`
 	CreatedAt           time.Time     `json:"createdAt"`
 	UpdatedAt           time.Time     `json:"updatedAt"`
 }
+
+// IsOverdue: tiene fecha límite vencida y sigue abierta.
+func (m *Mission) IsOverdue(now time.Time) bool {
+	return m.DueAt != nil && !m.Status.IsClosed() && now.After(*m.DueAt)
+}
+
+// AfterFind calcula el campo derivado Overdue al leer de la BD.
+func (m *Mission) AfterFind(tx *gorm.DB) error {
+	m.Overdue = m.IsOverdue(time.Now())
+	return nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "PENDING"
+	OutboxDelivered OutboxStatus = "DELIVERED"
+	OutboxDead      OutboxStatus = "DEAD" // agotó los reintentos
+)
+
+// OutboxMessage: auditoría o evento escrito en la misma transacción que el
+// cambio de dominio; el relay lo entrega al menos una vez a sus destinos.
+type OutboxMessage struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	Kind        string          `json:"kind" gorm:"size:20;not null"`            // audit | event | webhook
+	Key         string          `json:"key" gorm:"size:64;not null;uniqueIndex"` // deduplicación en los destinos
+	Payload     json.RawMessage `json:"payload" gorm:"type:jsonb;not null"`
+	Status      OutboxStatus    `json:"status" gorm:"type:text;not null;default:PENDING;index:idx_outbox_pending,priority:1"`
+	Attempts    int             `json:"attempts" gorm:"not null;default:0"`
+	LastError   string          `json:"lastError,omitempty" gorm:"type:text"`
+	AvailableAt time.Time       `json:"availableAt" gorm:"not null;index:idx_outbox_pending,priority:2"`
+	// Reclamado por un relay (ClaimID) hasta LockedUntil; si el relay cae, otro
+	// lo retoma al vencer.
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+	ClaimID     string     `json:"-" gorm:"size:32"`
+	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
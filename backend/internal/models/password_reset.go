@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Token de un solo uso para restablecer contraseña (se guarda solo el hash)
+type PasswordReset struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"userId" gorm:"not null;index"`
+	TokenHash   string     `json:"-" gorm:"not null;size:128;uniqueIndex"`
+	ExpiresAt   time.Time  `json:"expiresAt" gorm:"not null;index"`
+	UsedAt      *time.Time `json:"usedAt,omitempty"`
+	RequestedIP string     `json:"requestedIp" gorm:"type:text"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (PasswordReset) TableName() string {
+	return "password_resets"
+}
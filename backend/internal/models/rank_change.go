@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Historial de certificación: cada cambio de rango de un alquimista
+type RankChange struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	AlchemistID uint          `json:"alchemistId" gorm:"not null;index"`
+	FromRank    AlchemistRank `json:"fromRank" gorm:"type:text;not null"`
+	ToRank      AlchemistRank `json:"toRank" gorm:"type:text;not null"`
+	Direction   string        `json:"direction" gorm:"type:text;not null"` // PROMOTION | DEMOTION
+	Reason      string        `json:"reason" gorm:"type:text;not null"`
+	ChangedByID uint          `json:"changedById" gorm:"not null"`
+	ChangedBy   *User         `json:"changedBy,omitempty" gorm:"foreignKey:ChangedByID"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+func (RankChange) TableName() string {
+	return "rank_changes"
+}
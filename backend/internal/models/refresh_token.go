@@ -8,6 +8,7 @@ type RefreshToken struct {
 	UserID    uint       `gorm:"not null;index" json:"userId"`
 	TokenHash string     `gorm:"not null;size:128;uniqueIndex" json:"-"`  // hash del refresh
 	JTI       string     `gorm:"not null;size:64;uniqueIndex" json:"jti"` // identificador único del refresh
+	FamilyID  string     `gorm:"size:64;index" json:"familyId"`           // AuthSession a la que pertenece
 	ExpiresAt time.Time  `gorm:"not null;index" json:"expiresAt"`
 	RevokedAt *time.Time `gorm:"index" json:"revokedAt,omitempty"`
 	CreatedAt time.Time  `json:"createdAt"`
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Lista de revocación de access tokens. Key es "jti:<jti>" o "sid:<sesión>";
+// la fila puede borrarse una vez pasado ExpiresAt.
+type RevokedToken struct {
+	Key       string    `json:"key" gorm:"primaryKey;size:100"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
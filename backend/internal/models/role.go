@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Rol asignable a usuarios (users.role guarda Name). Los de sistema
+// (SUPERVISOR, ALCHEMIST) no se pueden eliminar.
+type Role struct {
+	Name        string       `json:"name" gorm:"primaryKey;size:64"`
+	Description string       `json:"description" gorm:"type:text"`
+	Builtin     bool         `json:"builtin" gorm:"not null;default:false"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// Permiso del catálogo (ver authz.Catalog), p. ej. "materials:write".
+type Permission struct {
+	Key         string `json:"key" gorm:"primaryKey;size:64"`
+	Description string `json:"description" gorm:"type:text"`
+}
+
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+func (r Role) PermissionKeys() []string {
+	out := make([]string, len(r.Permissions))
+	for i, p := range r.Permissions {
+		out[i] = p.Key
+	}
+	return out
+}
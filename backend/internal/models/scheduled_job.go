@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type ScheduledJobStatus string
+
+const (
+	JobIdle    ScheduledJobStatus = "IDLE"
+	JobRunning ScheduledJobStatus = "RUNNING"
+	JobOK      ScheduledJobStatus = "OK"
+	JobFailed  ScheduledJobStatus = "FAILED"
+)
+
+// Registro persistente de los jobs programados del worker
+type ScheduledJob struct {
+	Name               string             `json:"name" gorm:"primaryKey;size:80"`
+	Schedule           string             `json:"schedule" gorm:"type:text;not null"`
+	Status             ScheduledJobStatus `json:"status" gorm:"type:text;not null;default:IDLE"`
+	Paused             bool               `json:"paused" gorm:"not null;default:false"`
+	LastRunAt          *time.Time         `json:"lastRunAt"`
+	LastFinishedAt     *time.Time         `json:"lastFinishedAt"`
+	LastDurationMs     int64              `json:"lastDurationMs"`
+	LastError          string             `json:"lastError,omitempty" gorm:"type:text"`
+	NextRunAt          *time.Time         `json:"nextRunAt"`
+	RunCount           int64              `json:"runCount" gorm:"not null;default:0"`
+	FailCount          int64              `json:"failCount" gorm:"not null;default:0"`
+	TriggerRequestedAt *time.Time         `json:"triggerRequestedAt,omitempty"`
+	TriggeredByID      *uint              `json:"triggeredById,omitempty"`
+	LockedBy           string             `json:"lockedBy,omitempty" gorm:"size:120"` // réplica que tiene el lease
+	LockedUntil        *time.Time         `json:"lockedUntil,omitempty"`
+	CreatedAt          time.Time          `json:"createdAt"`
+	UpdatedAt          time.Time          `json:"updatedAt"`
+}
+
+func (ScheduledJob) TableName() string {
+	return "scheduled_jobs"
+}
@@ -9,6 +9,7 @@ type Transmutation struct {
 	Material     Material  `gorm:"foreignKey:MaterialID" json:"-"`
 	MissionID    *uint     `json:"missionId,omitempty"`
 	Mission      Mission   `gorm:"foreignKey:MissionID" json:"-"`
+	AlchemistID  *uint     `gorm:"index" json:"alchemistId,omitempty"` // quien ejecutó la transmutación
 	QuantityUsed float64   `json:"quantityUsed"`
 	Result       *string   `json:"result,omitempty"`
 	CreatedAt    time.Time `json:"createdAt"`
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type UserRole string
 
@@ -9,12 +12,35 @@ const (
 	RoleSupervisor UserRole = "SUPERVISOR"
 )
 
+// ParseUserRole normaliza el rol sin distinguir mayúsculas.
+func ParseUserRole(s string) (UserRole, bool) {
+	switch UserRole(strings.ToUpper(strings.TrimSpace(s))) {
+	case RoleAlchemist:
+		return RoleAlchemist, true
+	case RoleSupervisor:
+		return RoleSupervisor, true
+	}
+	return "", false
+}
+
 type User struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	Name         string    `json:"name" gorm:"type:text;not null"`
-	Email        string    `json:"email" gorm:"uniqueIndex;not null"`
-	PasswordHash string    `json:"-" gorm:"column:password_hash;not null"`
-	Role         UserRole  `json:"role" gorm:"type:text;not null;default:ALCHEMIST"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"type:text;not null"`
+	Email        string     `json:"email" gorm:"uniqueIndex;not null"`
+	PasswordHash string     `json:"-" gorm:"column:password_hash;not null"`
+	Role         UserRole   `json:"role" gorm:"type:text;not null;default:ALCHEMIST"`
+	DisabledAt   *time.Time `json:"disabledAt,omitempty" gorm:"index"` // cuenta deshabilitada por un supervisor
+	MFAEnabledAt *time.Time `json:"mfaEnabledAt,omitempty"`            // TOTP activo (ver UserMFA)
+	// Access tokens emitidos antes de esta fecha se rechazan ("cerrar sesión en todos lados")
+	TokensInvalidBefore *time.Time `json:"-"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+}
+
+func (u User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+func (u User) MFAEnabled() bool {
+	return u.MFAEnabledAt != nil
 }
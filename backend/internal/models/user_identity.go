@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Identidad externa (SSO OIDC) vinculada a un usuario: iss + sub del id_token.
+type UserIdentity struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"userId" gorm:"not null;index"`
+	Issuer      string    `json:"issuer" gorm:"type:text;not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject     string    `json:"subject" gorm:"type:text;not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Email       string    `json:"email" gorm:"type:text"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastLoginAt time.Time `json:"lastLoginAt"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// Login SSO en curso: state (hash) → nonce y code_verifier PKCE. Se borra al
+// usarse; el verifier nunca sale del servidor.
+type OIDCState struct {
+	StateHash    string    `gorm:"primaryKey;size:64"`
+	Nonce        string    `gorm:"type:text;not null"`
+	CodeVerifier string    `gorm:"type:text;not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+func (OIDCState) TableName() string {
+	return "oidc_states"
+}
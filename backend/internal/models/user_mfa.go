@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Segundo factor TOTP de un usuario. Mientras ConfirmedAt es nil el secreto
+// está pendiente de activar (se confirmó la contraseña pero no un código).
+type UserMFA struct {
+	UserID      uint       `json:"userId" gorm:"primaryKey"`
+	Secret      string     `json:"-" gorm:"type:text;not null"` // base32
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+	// Último paso TOTP aceptado: el mismo código no se puede usar dos veces
+	LastStep  int64     `json:"-" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// Código de recuperación de un solo uso (se guarda solo el hash)
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"userId" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;size:128;uniqueIndex"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook: suscripción de un sistema externo a eventos de dominio (ver
+// realtime.Catalog). Cada entrega se firma con HMAC-SHA256 usando Secret.
+type Webhook struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"type:text;not null"`
+	URL         string    `json:"url" gorm:"type:text;not null"`
+	Events      []string  `json:"events" gorm:"serializer:json;type:jsonb;not null"` // tipos de evento o "*"
+	Secret      string    `json:"-" gorm:"size:128;not null"`
+	Active      bool      `json:"active" gorm:"not null;default:true"`
+	CreatedByID uint      `json:"createdById" gorm:"not null"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookPending   WebhookDeliveryStatus = "PENDING"
+	WebhookDelivered WebhookDeliveryStatus = "DELIVERED"
+	WebhookFailed    WebhookDeliveryStatus = "FAILED" // se reintentará
+	WebhookDead      WebhookDeliveryStatus = "DEAD"   // agotó los reintentos
+)
+
+// WebhookDelivery: registro de la entrega de un evento a un webhook. Payload
+// es el cuerpo exacto que se envía (también en los reintentos y replays).
+type WebhookDelivery struct {
+	ID             uint                  `json:"id" gorm:"primaryKey"`
+	WebhookID      uint                  `json:"webhookId" gorm:"not null;uniqueIndex:idx_webhook_deliveries_event,priority:1"`
+	EventID        string                `json:"eventId" gorm:"size:64;not null;uniqueIndex:idx_webhook_deliveries_event,priority:2"` // clave del outbox
+	EventType      string                `json:"eventType" gorm:"type:text;not null"`
+	Payload        json.RawMessage       `json:"payload" gorm:"type:jsonb;not null"`
+	Status         WebhookDeliveryStatus `json:"status" gorm:"type:text;not null;default:PENDING;index"`
+	Attempts       int                   `json:"attempts" gorm:"not null;default:0"`
+	ResponseStatus int                   `json:"responseStatus,omitempty"`
+	ResponseBody   string                `json:"responseBody,omitempty" gorm:"type:text"`
+	LastError      string                `json:"lastError,omitempty" gorm:"type:text"`
+	DurationMs     int64                 `json:"durationMs,omitempty"`
+	DeliveredAt    *time.Time            `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time             `json:"createdAt"`
+	UpdatedAt      time.Time             `json:"updatedAt"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,99 @@
+// Package outbox implementa el patrón transactional outbox: auditorías y
+// eventos se guardan en outbox_messages dentro de la misma transacción que el
+// cambio de dominio, y el Relay los entrega después (al menos una vez, con
+// Key para deduplicar en cada destino).
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/mail"
+	"amestris/backend/internal/models"
+)
+
+// Tipos de mensaje
+const (
+	KindAudit   = "audit"
+	KindEvent   = "event"
+	KindWebhook = "webhook" // una entrega (webhook_deliveries) pendiente de enviar
+	KindMail    = "mail"
+)
+
+// notifyChannel: canal de LISTEN/NOTIFY; Postgres lo entrega al hacer commit.
+const notifyChannel = "outbox"
+
+// EventPayload: evento de tiempo real tal como queda en el outbox.
+type EventPayload struct {
+	Type        string          `json:"type"`
+	ResourceID  uint            `json:"resourceId,omitempty"`
+	AlchemistID *uint           `json:"alchemistId,omitempty"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Audit guarda una auditoría en tx. Fuera de una transacción se pasa db.Get().
+func Audit(tx *gorm.DB, p async.AuditPayload) error {
+	return add(tx, KindAudit, p)
+}
+
+// Event guarda un evento de tiempo real (ver realtime.Catalog) en tx;
+// alchemistID es el dueño del recurso (nil si no tiene).
+func Event(tx *gorm.DB, evType string, resourceID uint, data any, alchemistID *uint) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return add(tx, KindEvent, EventPayload{Type: evType, ResourceID: resourceID, AlchemistID: alchemistID, Data: raw})
+}
+
+// WebhookPayload: entrega de webhook a enviar.
+type WebhookPayload struct {
+	DeliveryID uint `json:"deliveryId"`
+}
+
+// Webhook encola en tx el envío de una entrega ya registrada.
+func Webhook(tx *gorm.DB, deliveryID uint) error {
+	return add(tx, KindWebhook, WebhookPayload{DeliveryID: deliveryID})
+}
+
+// Mail encola en tx un correo: se envía después del commit, fuera de la
+// petición, y solo si la transacción se confirma.
+func Mail(tx *gorm.DB, msg mail.Message) error {
+	return add(tx, KindMail, msg)
+}
+
+func add(tx *gorm.DB, kind string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	m := models.OutboxMessage{
+		Kind:        kind,
+		Key:         key,
+		Payload:     raw,
+		Status:      models.OutboxPending,
+		AvailableAt: time.Now(),
+	}
+	if err := tx.Create(&m).Error; err != nil {
+		return err
+	}
+	// Despierta a los relays cuando (y solo si) la transacción hace commit
+	return tx.Exec("SELECT pg_notify(?, '')", notifyChannel).Error
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
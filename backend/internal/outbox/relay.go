@@ -0,0 +1,372 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/mail"
+	"amestris/backend/internal/metrics"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/realtime"
+)
+
+// Sink entrega un mensaje a un destino. Debe ser idempotente por m.Key: tras
+// un fallo (o una caída antes de marcarlo entregado) el mensaje se reintenta
+// en todos los destinos de su tipo.
+type Sink func(ctx context.Context, m models.OutboxMessage) error
+
+// Relay lee outbox_messages pendientes y los entrega a los destinos de su
+// tipo. Varias réplicas pueden correrlo a la vez: cada lote se reclama con
+// FOR UPDATE SKIP LOCKED y un lease (locked_until) que se confirma enseguida;
+// la entrega ocurre fuera de la transacción. Los tipos con carril propio
+// (Lane) se reclaman aparte para que un destino lento no frene al resto.
+type Relay struct {
+	db    *gorm.DB
+	retry async.RetryConfig
+	batch int
+	poll  time.Duration
+	lease time.Duration
+
+	mu      sync.RWMutex
+	sinks   map[string][]Sink
+	retries map[string]async.RetryConfig // por tipo; si no, retry
+	lanes   [][]string                   // tipos con carril propio
+	skip    []string                     // tipos que este relay no reclama
+	kicks   []chan struct{}
+}
+
+// NewRelay crea el relay con los destinos por defecto (audits, tiempo real y correo);
+// el lote, el sondeo y el lease salen de OUTBOX_BATCH, OUTBOX_POLL_MS y
+// OUTBOX_LEASE_SEC.
+func NewRelay(d *gorm.DB, retry async.RetryConfig) *Relay {
+	r := &Relay{
+		db:      d,
+		retry:   retry,
+		batch:   db.MustGetInt("OUTBOX_BATCH", 100),
+		poll:    time.Duration(db.MustGetInt("OUTBOX_POLL_MS", 1000)) * time.Millisecond,
+		lease:   time.Duration(db.MustGetInt("OUTBOX_LEASE_SEC", 60)) * time.Second,
+		sinks:   map[string][]Sink{},
+		retries: map[string]async.RetryConfig{},
+	}
+	r.Handle(KindAudit, auditSink(d))
+	r.Handle(KindEvent, realtimeSink)
+	r.Handle(KindMail, mailSink)
+	return r
+}
+
+// RetryFromEnv: reintentos del relay (JOB_MAX_ATTEMPTS, JOB_BACKOFF_MS,
+// JOB_BACKOFF_MAX_MS).
+func RetryFromEnv() async.RetryConfig {
+	return async.RetryConfig{
+		MaxAttempts: db.MustGetInt("JOB_MAX_ATTEMPTS", 5),
+		BackoffBase: time.Duration(db.MustGetInt("JOB_BACKOFF_MS", 500)) * time.Millisecond,
+		BackoffMax:  time.Duration(db.MustGetInt("JOB_BACKOFF_MAX_MS", 30_000)) * time.Millisecond,
+		Factor:      2.0,
+	}
+}
+
+// Handle agrega un destino para los mensajes de kind.
+func (r *Relay) Handle(kind string, s Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks[kind] = append(r.sinks[kind], s)
+}
+
+// SetRetry usa c para los reintentos de los mensajes de kind.
+func (r *Relay) SetRetry(kind string, c async.RetryConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries[kind] = c
+}
+
+// Lane entrega los mensajes de kinds en un carril propio. Se llama antes de Run.
+func (r *Relay) Lane(kinds ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lanes = append(r.lanes, kinds)
+}
+
+// Skip deja los mensajes de kinds para otro proceso. Se llama antes de Run.
+func (r *Relay) Skip(kinds ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skip = append(r.skip, kinds...)
+}
+
+// Run entrega lotes hasta que ctx termina: al recibir NOTIFY (commit de un
+// mensaje nuevo) o cada OUTBOX_POLL_MS para reintentos y por si LISTEN cae.
+// Cada carril termina su lote aunque ctx se cancele; Run vuelve cuando
+// todos terminaron.
+func (r *Relay) Run(ctx context.Context) {
+	r.mu.Lock()
+	own := slices.Clone(r.skip)
+	for _, l := range r.lanes {
+		own = append(own, l...)
+	}
+	filters := []func(*gorm.DB) *gorm.DB{func(q *gorm.DB) *gorm.DB {
+		if len(own) == 0 {
+			return q
+		}
+		return q.Where("kind NOT IN ?", own)
+	}}
+	for _, l := range r.lanes {
+		kinds := slices.DeleteFunc(slices.Clone(l), func(k string) bool { return slices.Contains(r.skip, k) })
+		if len(kinds) == 0 {
+			continue
+		}
+		filters = append(filters, func(q *gorm.DB) *gorm.DB { return q.Where("kind IN ?", kinds) })
+	}
+	r.kicks = make([]chan struct{}, len(filters))
+	for i := range r.kicks {
+		r.kicks[i] = make(chan struct{}, 1)
+	}
+	r.mu.Unlock()
+
+	go r.listen(ctx)
+	var wg sync.WaitGroup
+	for i, f := range filters {
+		wg.Add(1)
+		go func(kick chan struct{}, filter func(*gorm.DB) *gorm.DB) {
+			defer wg.Done()
+			r.runLane(ctx, kick, filter)
+		}(r.kicks[i], f)
+	}
+	wg.Wait()
+}
+
+func (r *Relay) runLane(ctx context.Context, kick chan struct{}, filter func(*gorm.DB) *gorm.DB) {
+	ticker := time.NewTicker(r.poll)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			n, err := r.drain(context.WithoutCancel(ctx), filter)
+			if err != nil {
+				log.Printf("warn: outbox relay: %v", err)
+				break
+			}
+			if n < r.batch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-kick:
+		}
+	}
+}
+
+// drain reclama un lote con lease, lo entrega fuera de la transacción y
+// guarda el resultado de cada mensaje solo si el lease sigue siendo suyo.
+func (r *Relay) drain(ctx context.Context, filter func(*gorm.DB) *gorm.DB) (int, error) {
+	claim, err := newKey()
+	if err != nil {
+		return 0, err
+	}
+	claim = claim[:32]
+	until := time.Now().Add(r.lease)
+
+	var msgs []models.OutboxMessage
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := filter(tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND available_at <= ?", models.OutboxPending, now).
+			Where("locked_until IS NULL OR locked_until < ?", now)).
+			Order("id").Limit(r.batch).Find(&msgs).Error; err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(msgs))
+		for i := range msgs {
+			ids[i] = msgs[i].ID
+		}
+		return tx.Model(&models.OutboxMessage{}).Where("id IN ?", ids).
+			Updates(map[string]any{"locked_until": until, "claim_id": claim}).Error
+	})
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+
+	// No se empieza una entrega en la segunda mitad del lease: así termina
+	// (los destinos tienen su timeout) antes de que otro relay pueda retomarla
+	deadline := until.Add(-r.lease / 2)
+	for i := range msgs {
+		if time.Now().After(deadline) {
+			// Lo que queda se libera para el siguiente lote
+			return len(msgs), r.db.WithContext(ctx).Model(&models.OutboxMessage{}).
+				Where("claim_id = ? AND status = ?", claim, models.OutboxPending).
+				Updates(map[string]any{"locked_until": nil, "claim_id": ""}).Error
+		}
+		m := &msgs[i]
+		r.deliver(ctx, m)
+		res := r.db.WithContext(ctx).Model(&models.OutboxMessage{}).
+			Where("id = ? AND claim_id = ?", m.ID, claim).
+			Updates(map[string]any{
+				"status":       m.Status,
+				"attempts":     m.Attempts,
+				"last_error":   m.LastError,
+				"available_at": m.AvailableAt,
+				"delivered_at": m.DeliveredAt,
+				"locked_until": nil,
+				"claim_id":     "",
+			})
+		if res.Error != nil {
+			return len(msgs), res.Error
+		}
+		if res.RowsAffected == 0 {
+			log.Printf("warn: outbox relay: el lease del mensaje %d venció durante la entrega", m.ID)
+		}
+	}
+	return len(msgs), nil
+}
+
+func (r *Relay) deliver(ctx context.Context, m *models.OutboxMessage) {
+	r.mu.RLock()
+	sinks := r.sinks[m.Kind]
+	retry, ok := r.retries[m.Kind]
+	r.mu.RUnlock()
+	if !ok {
+		retry = r.retry
+	}
+
+	err := fmt.Errorf("sin destino para %q", m.Kind)
+	for _, s := range sinks {
+		if err = s(ctx, *m); err != nil {
+			break
+		}
+	}
+
+	now := time.Now()
+	if err == nil {
+		m.Status = models.OutboxDelivered
+		m.DeliveredAt = &now
+		m.LastError = ""
+		metrics.OutboxDelivered(m.Kind, "ok")
+		return
+	}
+	m.Attempts++
+	m.LastError = err.Error()
+	if m.Attempts >= retry.MaxAttempts {
+		// Queda como DEAD para revisarlo a mano (hace de DLQ)
+		m.Status = models.OutboxDead
+		metrics.OutboxDelivered(m.Kind, "dead")
+		log.Printf("💀 outbox: mensaje %d (%s) descartado tras %d intentos: %v", m.ID, m.Kind, m.Attempts, err)
+		return
+	}
+	m.AvailableAt = now.Add(retry.Backoff(m.Attempts))
+	metrics.OutboxDelivered(m.Kind, "retry")
+}
+
+// listen mantiene una conexión con LISTEN outbox y despierta a Run en cada
+// NOTIFY; si se corta, reintenta y mientras tanto queda el sondeo.
+func (r *Relay) listen(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := r.waitNotifications(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("warn: outbox listen: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (r *Relay) waitNotifications(ctx context.Context) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		sc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("el driver no soporta LISTEN")
+		}
+		pc := sc.Conn()
+		if _, err := pc.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+			return err
+		}
+		for {
+			if _, err := pc.WaitForNotification(ctx); err != nil {
+				return err
+			}
+			r.mu.RLock()
+			for _, kick := range r.kicks {
+				select {
+				case kick <- struct{}{}:
+				default:
+				}
+			}
+			r.mu.RUnlock()
+		}
+	})
+}
+
+/* ===================== Destinos ===================== */
+
+// auditSink inserta en audits; dedupe_key evita el duplicado si se reintenta
+// un mensaje que ya se había insertado.
+func auditSink(d *gorm.DB) Sink {
+	return func(ctx context.Context, m models.OutboxMessage) error {
+		var p async.AuditPayload
+		if err := json.Unmarshal(m.Payload, &p); err != nil {
+			return err
+		}
+		key := m.Key
+		a := models.Audit{
+			Action:    p.Action,
+			Entity:    p.Entity,
+			EntityID:  p.EntityID,
+			Meta:      p.Meta,
+			DedupeKey: &key,
+			CreatedAt: m.CreatedAt,
+		}
+		return d.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "dedupe_key"}},
+			DoNothing: true,
+		}).Create(&a).Error
+	}
+}
+
+// realtimeSink publica el evento (SSE/WebSocket) con la clave del mensaje:
+// si se reintenta uno ya publicado, el replay lo reconoce y no se repite.
+func realtimeSink(ctx context.Context, m models.OutboxMessage) error {
+	var p EventPayload
+	if err := json.Unmarshal(m.Payload, &p); err != nil {
+		return err
+	}
+	realtime.Publish(ctx, m.Key, p.Type, p.ResourceID, p.Data, p.AlchemistID)
+	return nil
+}
+
+// mailSink envía el correo. El servidor de correo no deduplica: una caída
+// entre el envío y marcarlo entregado puede mandarlo dos veces.
+func mailSink(ctx context.Context, m models.OutboxMessage) error {
+	var msg mail.Message
+	if err := json.Unmarshal(m.Payload, &msg); err != nil {
+		return err
+	}
+	return mail.Send(ctx, msg)
+}
@@ -9,24 +9,26 @@ import (
 
 var Client *asynq.Client
 var Server *asynq.Server
+var Inspector *asynq.Inspector
+
+// RedisAddr: dirección de Redis compartida por la cola y otros backends.
+func RedisAddr() string {
+	if v := os.Getenv("REDIS_ADDR"); v != "" {
+		return v
+	}
+	return "localhost:6379"
+}
 
 // Setup inicializa cliente y servidor de tareas Redis.
 func Setup() {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
-	}
-	Client = asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+	Client = asynq.NewClient(asynq.RedisClientOpt{Addr: RedisAddr()})
+	Inspector = asynq.NewInspector(asynq.RedisClientOpt{Addr: RedisAddr()})
 }
 
 // StartServer inicia el worker
 func StartServer(handler *asynq.ServeMux) {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
-	}
 	Server = asynq.NewServer(
-		asynq.RedisClientOpt{Addr: redisAddr},
+		asynq.RedisClientOpt{Addr: RedisAddr()},
 		asynq.Config{
 			Concurrency: 5,
 			Queues: map[string]int{
@@ -44,4 +46,7 @@ func Close() {
 	if Client != nil {
 		_ = Client.Close()
 	}
+	if Inspector != nil {
+		_ = Inspector.Close()
+	}
 }
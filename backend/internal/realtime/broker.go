@@ -5,117 +5,239 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"amestris/backend/internal/db"
 	"amestris/backend/internal/metrics"
 )
 
 type Event struct {
+	ID uint64 `json:"id,omitempty"` // asignado por Replay al publicar; 0 en hello/ping
+	// Clave del mensaje del outbox: la misma en cada reintento, para
+	// deduplicar. En SSE va como id.
+	Key  string      `json:"key,omitempty"`
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
+	// Alquimista dueño del recurso (nil = sin dueño); decide quién lo recibe
+	// sin el permiso "todos" del tema. No se envía al cliente.
+	AlchemistID *uint `json:"-"`
+	// Id del recurso, para suscripciones como "mission:42". No se envía.
+	ResourceID uint `json:"-"`
+}
+
+type client struct {
+	sub     *Subscriber
+	ch      chan Event
+	lagged  chan struct{} // se señala al descartar un evento: el stream se cierra
+	dropped atomic.Int64
 }
 
 type Broker struct {
 	mu       sync.RWMutex
-	clients  map[int]chan Event
+	clients  map[int]*client
 	lastID   int
+	replay   Replay
+	bus      Bus
+	subOnce  sync.Once
+	buffer   int
 	shutdown chan struct{}
+	stopOnce sync.Once
 }
 
-func NewBroker() *Broker {
+// NewBroker: replay numera y guarda los eventos, bus los lleva a los brokers
+// de todos los procesos y buffer es la cola por cliente; al llenarse el
+// cliente se desconecta y, al volver con Last-Event-ID, recibe lo perdido.
+func NewBroker(replay Replay, bus Bus, buffer int) *Broker {
+	if buffer < 1 {
+		buffer = 1
+	}
 	return &Broker{
-		clients:  make(map[int]chan Event),
+		clients:  make(map[int]*client),
+		replay:   replay,
+		bus:      bus,
+		buffer:   buffer,
 		shutdown: make(chan struct{}),
 	}
 }
 
-func (b *Broker) AddClient() (int, chan Event) {
+func (b *Broker) AddClient(sub *Subscriber) (int, *client) {
+	// Solo escucha el bus el proceso que tiene clientes (no el worker)
+	b.subOnce.Do(func() { b.bus.Subscribe(b.dispatch) })
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.lastID++
 	id := b.lastID
-	ch := make(chan Event, 16)
-	b.clients[id] = ch
+	c := &client{sub: sub, ch: make(chan Event, b.buffer), lagged: make(chan struct{}, 1)}
+	b.clients[id] = c
 
 	// Métrica: +1 cliente SSE
 	metrics.SSEClientInc()
 
-	return id, ch
+	return id, c
 }
 
 func (b *Broker) RemoveClient(id int) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if ch, ok := b.clients[id]; ok {
-		close(ch)
+	if c, ok := b.clients[id]; ok {
+		close(c.ch)
 		delete(b.clients, id)
 
 		// Métrica: -1 cliente SSE
 		metrics.SSEClientDec()
+		metrics.SSEClientDropped(int(c.dropped.Load()))
+	}
+}
+
+// Broadcast numera y guarda el evento (replay) y lo publica en el bus. Un
+// evento con una Key ya publicada (reintento del relay) no se repite.
+func (b *Broker) Broadcast(ctx context.Context, ev Event) {
+	dup, err := b.replay.Append(ctx, &ev)
+	if err != nil {
+		// Se entrega igual, sin id: no se podrá reenviar
+		log.Printf("warn: realtime replay: %v", err)
+	}
+	if dup {
+		return
+	}
+	if err := b.bus.Publish(ctx, ev); err != nil {
+		// Al menos llega a los clientes de este proceso
+		log.Printf("warn: realtime bus: %v", err)
+		b.dispatch(ev)
 	}
 }
 
-func (b *Broker) Broadcast(ev Event) {
+// dispatch entrega un evento del bus solo a los clientes locales que pueden
+// y quieren verlo.
+func (b *Broker) dispatch(ev Event) {
 	// Métrica: contamos el evento por tipo
 	metrics.SSEEvent(ev.Type)
 
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	for _, ch := range b.clients {
+	for _, c := range b.clients {
+		if !c.sub.Wants(ev) {
+			continue
+		}
 		select {
-		case ch <- ev:
+		case c.ch <- ev:
 		default:
+			c.dropped.Add(1)
+			metrics.SSEDropped(ev.Type)
+			select {
+			case c.lagged <- struct{}{}:
+			default:
+			}
 		}
 	}
 }
 
+// CloseStreams avisa a los clientes SSE ("close") y WebSocket (1001) para que
+// reconecten, con Last-Event-ID, a otra réplica o al proceso que arranque, y
+// cierra sus streams. El broker sigue publicando en el bus.
+func (b *Broker) CloseStreams() {
+	b.stopOnce.Do(func() { close(b.shutdown) })
+}
+
+// Shutdown cierra los streams y el bus; después de esto no se publica nada.
 func (b *Broker) Shutdown() {
-	close(b.shutdown)
+	b.CloseStreams()
+	_ = b.bus.Close()
 	b.mu.Lock()
-	for id, ch := range b.clients {
-		close(ch)
+	for id, c := range b.clients {
+		close(c.ch)
 		delete(b.clients, id)
 	}
 	b.mu.Unlock()
 }
 
 func writeSSE(w http.ResponseWriter, ev Event) error {
-	w.Write([]byte("event: " + ev.Type + "\n"))
 	payload, _ := json.Marshal(ev.Data)
-	w.Write([]byte("data: " + string(payload) + "\n\n"))
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
+	var frame []byte
+	switch {
+	case ev.Key != "":
+		frame = append(frame, "id: "+ev.Key+"\n"...)
+	case ev.ID != 0:
+		frame = append(frame, "id: "+strconv.FormatUint(ev.ID, 10)+"\n"...)
+	}
+	frame = append(frame, "event: "+ev.Type+"\ndata: "+string(payload)+"\n\n"...)
+	if _, err := w.Write(frame); err != nil {
+		return err
 	}
-	return nil
+	// ResponseController atraviesa los wrappers de los middlewares (Unwrap)
+	return http.NewResponseController(w).Flush()
 }
 
-func (b *Broker) HandlerSSE(w http.ResponseWriter, r *http.Request) {
-	log.Println("⚡ Nueva conexión SSE desde", r.RemoteAddr)
+// HandlerSSE sirve el stream del suscriptor ya autenticado. Con lastEventID
+// reenvía primero lo publicado desde entonces (o "reset" si ya no está en el
+// buffer); lastEventID es un id numérico o la clave que el SSE manda como id.
+// Cada recheck revalida usuario, sesión y permisos con sub.Refresh.
+func (b *Broker) HandlerSSE(w http.ResponseWriter, r *http.Request, sub *Subscriber, recheck time.Duration, lastEventID string) {
+	log.Println("⚡ Nueva conexión SSE desde", r.RemoteAddr, "usuario", sub.UserID)
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Accel-Buffering", "no")
 
-	id, ch := b.AddClient()
+	// El stream no está sujeto al WriteTimeout del servidor
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Alta antes del replay: lo que llegue mientras tanto queda en la cola y
+	// se salta si ya se envió
+	id, c := b.AddClient(sub)
 	defer b.RemoveClient(id)
 
 	ctx := r.Context()
 	ticker := time.NewTicker(25 * time.Second)
 	defer ticker.Stop()
+	rechecker := time.NewTicker(recheck)
+	defer rechecker.Stop()
 
-	_ = writeSSE(w, Event{Type: "hello", Data: map[string]any{"client": id}})
+	_ = writeSSE(w, Event{Type: "hello", Data: map[string]any{
+		"client": id,
+		"types":  sub.Filter(),
+	}})
+
+	replayed, err := b.replayTo(ctx, sub, lastEventID, func(ev Event) error { return writeSSE(w, ev) })
+	if err != nil {
+		return
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-b.shutdown:
+			_ = writeSSE(w, Event{Type: "close", Data: map[string]string{"reason": "servidor detenido"}})
 			return
 		case <-ticker.C:
-			_ = writeSSE(w, Event{Type: "ping", Data: time.Now().Unix()})
-		case ev := <-ch:
+			if err := writeSSE(w, Event{Type: "ping", Data: time.Now().Unix()}); err != nil {
+				return
+			}
+		case <-rechecker.C:
+			if err := sub.refresh(ctx); err != nil {
+				log.Printf("sse: cierre del cliente %d (usuario %d): %v", id, sub.UserID, err)
+				_ = writeSSE(w, Event{Type: "close", Data: map[string]string{"reason": err.Error()}})
+				return
+			}
+		case <-c.lagged:
+			log.Printf("sse: cliente %d (usuario %d) se quedó atrás; se cierra para que reanude", id, sub.UserID)
+			return
+		case ev, ok := <-c.ch:
+			if !ok {
+				return
+			}
+			if replayed[ev.ID] {
+				delete(replayed, ev.ID)
+				continue
+			}
 			if err := writeSSE(w, ev); err != nil {
 				log.Printf("sse write error: %v", err)
 				return
@@ -124,16 +246,102 @@ func (b *Broker) HandlerSSE(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// replayTo envía con send lo publicado después de lastEventID que el
+// suscriptor quiere (o "reset" si ya no está en el buffer) y devuelve los ids
+// reenviados, para no repetirlos si también llegan en vivo.
+func (b *Broker) replayTo(ctx context.Context, sub *Subscriber, lastEventID string, send func(Event) error) (map[uint64]bool, error) {
+	replayed := map[uint64]bool{}
+	if lastEventID == "" {
+		return replayed, nil
+	}
+	after, ok, err := b.resolveID(ctx, lastEventID)
+	var evs []Event
+	if ok && err == nil {
+		evs, ok, err = b.replay.Since(ctx, after)
+	}
+	if err != nil {
+		log.Printf("warn: realtime replay: %v", err)
+	}
+	if !ok || err != nil {
+		// El cliente debe recargar su estado: hay eventos que no se reenvían
+		metrics.SSEReplay("gap")
+		if err := send(Event{Type: "reset", Data: map[string]any{"lastEventId": lastEventID}}); err != nil {
+			return nil, err
+		}
+	} else {
+		metrics.SSEReplay("ok")
+	}
+	for _, ev := range evs {
+		replayed[ev.ID] = true
+		if !sub.Wants(ev) {
+			continue
+		}
+		if err := send(ev); err != nil {
+			return nil, err
+		}
+	}
+	return replayed, nil
+}
+
+// resolveID: id numérico de un Last-Event-ID (número o clave del outbox);
+// ok=false si la clave ya no se recuerda.
+func (b *Broker) resolveID(ctx context.Context, lastEventID string) (uint64, bool, error) {
+	if id, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		return id, true, nil
+	}
+	return b.replay.Lookup(ctx, lastEventID)
+}
+
 var (
 	broker     *Broker
 	brokerOnce sync.Once
+	// brokerStarted: broker ya creado (para detenerlo sin crearlo)
+	brokerStarted atomic.Pointer[Broker]
 )
 
+// GlobalBroker: broker del proceso; se configura en el primer uso con
+// REALTIME_BACKEND=memory (default, un solo proceso) | redis (pub/sub y
+// replay compartidos entre réplicas y el worker), REALTIME_REPLAY_SIZE y
+// REALTIME_CLIENT_BUFFER.
 func GlobalBroker() *Broker {
-	brokerOnce.Do(func() { broker = NewBroker() })
+	brokerOnce.Do(func() {
+		size := db.MustGetInt("REALTIME_REPLAY_SIZE", 1000)
+		buffer := db.MustGetInt("REALTIME_CLIENT_BUFFER", 64)
+		switch strings.ToLower(os.Getenv("REALTIME_BACKEND")) {
+		case "redis":
+			broker = NewBroker(NewRedisReplay(size), NewRedisBus(), buffer)
+			log.Printf("📡 Realtime en Redis pub/sub (replay de %d eventos)", size)
+		default:
+			broker = NewBroker(NewMemoryReplay(size), NewMemoryBus(), buffer)
+			log.Println("📡 Realtime en memoria (solo este proceso)")
+		}
+		brokerStarted.Store(broker)
+	})
 	return broker
 }
 
-func Publish(ctx context.Context, evType string, data interface{}) {
-	GlobalBroker().Broadcast(Event{Type: evType, Data: data})
+// CloseStreams cierra los streams del broker del proceso, si llegó a crearse.
+func CloseStreams() {
+	if b := brokerStarted.Load(); b != nil {
+		b.CloseStreams()
+	}
+}
+
+// Shutdown detiene el broker del proceso, si llegó a crearse.
+func Shutdown() {
+	if b := brokerStarted.Load(); b != nil {
+		b.Shutdown()
+	}
+}
+
+// Publish emite un evento sobre el recurso resourceID; alchemistID es su
+// dueño (nil si no tiene) y key la clave del mensaje del outbox.
+func Publish(ctx context.Context, key, evType string, resourceID uint, data interface{}, alchemistID *uint) {
+	GlobalBroker().Broadcast(ctx, Event{Key: key, Type: evType, Data: data, AlchemistID: alchemistID, ResourceID: resourceID})
+}
+
+// Shared indica si los eventos viajan entre procesos (REALTIME_BACKEND=redis).
+// Si no, solo los ve quien tenga clientes conectados en este proceso.
+func Shared() bool {
+	return strings.EqualFold(os.Getenv("REALTIME_BACKEND"), "redis")
 }
@@ -0,0 +1,103 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	"amestris/backend/internal/queue"
+)
+
+// Bus lleva los eventos ya numerados a los brokers de todos los procesos
+// (réplicas del API y worker). Cada broker entrega a sus propios clientes.
+type Bus interface {
+	Publish(ctx context.Context, ev Event) error
+	// Subscribe registra la entrega local; se llama una sola vez por broker.
+	Subscribe(deliver func(Event))
+	Close() error
+}
+
+/* ===================== Memoria ===================== */
+
+// MemoryBus: un solo proceso; lo publicado por otros procesos no llega.
+type MemoryBus struct {
+	mu      sync.RWMutex
+	deliver func(Event)
+}
+
+func NewMemoryBus() *MemoryBus { return &MemoryBus{} }
+
+func (m *MemoryBus) Publish(_ context.Context, ev Event) error {
+	m.mu.RLock()
+	deliver := m.deliver
+	m.mu.RUnlock()
+	if deliver != nil {
+		deliver(ev)
+	}
+	return nil
+}
+
+func (m *MemoryBus) Subscribe(deliver func(Event)) {
+	m.mu.Lock()
+	m.deliver = deliver
+	m.mu.Unlock()
+}
+
+func (m *MemoryBus) Close() error { return nil }
+
+/* ===================== Redis pub/sub ===================== */
+
+const redisChannel = "realtime:events"
+
+// RedisBus: PUBLISH en un canal compartido; go-redis reconecta la suscripción
+// sola. Lo publicado mientras un proceso está desconectado se recupera con
+// Last-Event-ID desde RedisReplay.
+type RedisBus struct {
+	rdb    *redis.Client
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+}
+
+func NewRedisBus() *RedisBus {
+	return &RedisBus{rdb: redis.NewClient(&redis.Options{Addr: queue.RedisAddr()})}
+}
+
+func (r *RedisBus) Publish(ctx context.Context, ev Event) error {
+	raw, err := toStored(ev)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Publish(ctx, redisChannel, raw).Err()
+}
+
+func (r *RedisBus) Subscribe(deliver func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pubsub != nil {
+		return
+	}
+	r.pubsub = r.rdb.Subscribe(context.Background(), redisChannel)
+	ch := r.pubsub.Channel()
+	go func() {
+		for msg := range ch {
+			var s storedEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &s); err != nil {
+				log.Printf("warn: realtime bus: evento inválido: %v", err)
+				continue
+			}
+			deliver(s.event())
+		}
+	}()
+}
+
+func (r *RedisBus) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pubsub != nil {
+		_ = r.pubsub.Close()
+	}
+	return r.rdb.Close()
+}
@@ -0,0 +1,125 @@
+package realtime
+
+import "amestris/backend/internal/models"
+
+// Tipos de evento (tema.acción).
+const (
+	TransmutationCreated = "transmutation.created"
+	TransmutationUpdated = "transmutation.updated"
+	TransmutationDeleted = "transmutation.deleted"
+
+	MaterialCreated      = "material.created"
+	MaterialUpdated      = "material.updated"
+	MaterialDeleted      = "material.deleted"
+	MaterialStockChanged = "material.stock_changed"
+
+	MissionCreated       = "mission.created"
+	MissionUpdated       = "mission.updated"
+	MissionDeleted       = "mission.deleted"
+	MissionStatusChanged = "mission.status_changed"
+	MissionStale         = "mission.stale"
+	MissionOverdue       = "mission.overdue"
+
+	AlchemistCreated     = "alchemist.created"
+	AlchemistUpdated     = "alchemist.updated"
+	AlchemistDeleted     = "alchemist.deleted"
+	AlchemistRankChanged = "alchemist.rank_changed"
+)
+
+// EventDef: entrada del catálogo. Payload es el esquema de data en
+// docs/openapi.yaml (components/schemas).
+type EventDef struct {
+	Type        string `json:"type"`
+	Payload     string `json:"payload"`
+	Description string `json:"description"`
+}
+
+// Catalog: todos los eventos que se publican, en el orden en que se documentan.
+var Catalog = []EventDef{
+	{TransmutationCreated, "Transmutation", "Transmutación registrada (API o worker)"},
+	{TransmutationUpdated, "Transmutation", "Título, misión o resultado editados"},
+	{TransmutationDeleted, "DeletedEvent", "Transmutación eliminada; su stock vuelve al material"},
+	{MaterialCreated, "Material", "Material creado"},
+	{MaterialUpdated, "Material", "Material editado"},
+	{MaterialDeleted, "DeletedEvent", "Material eliminado"},
+	{MaterialStockChanged, "StockChangedEvent", "Cambió la cantidad de un material (transmutación, borrado o edición)"},
+	{MissionCreated, "Mission", "Misión creada"},
+	{MissionUpdated, "Mission", "Misión editada o autoasignada"},
+	{MissionDeleted, "DeletedEvent", "Misión eliminada"},
+	{MissionStatusChanged, "MissionStatusChangedEvent", "Cambió el estado de una misión"},
+	{MissionStale, "MissionStaleEvent", "Misión estancada escalada"},
+	{MissionOverdue, "MissionOverdueEvent", "Misión con la fecha límite vencida"},
+	{AlchemistCreated, "Alchemist", "Alquimista creado"},
+	{AlchemistUpdated, "Alchemist", "Alquimista editado"},
+	{AlchemistDeleted, "DeletedEvent", "Alquimista eliminado"},
+	{AlchemistRankChanged, "RankChange", "Promoción o degradación de un alquimista"},
+}
+
+// Types: tipos de evento que se publican.
+var Types = func() []string {
+	out := make([]string, len(Catalog))
+	for i, d := range Catalog {
+		out[i] = d.Type
+	}
+	return out
+}()
+
+/* ===================== Payloads ===================== */
+
+// TransmutationPayload: la transmutación tal cual la devuelve la API.
+type TransmutationPayload struct {
+	ID           uint    `json:"id"`
+	Title        string  `json:"title"`
+	MaterialID   uint    `json:"materialId"`
+	MaterialName string  `json:"materialName,omitempty"`
+	MissionID    *uint   `json:"missionId,omitempty"`
+	MissionTitle string  `json:"missionTitle,omitempty"`
+	AlchemistID  *uint   `json:"alchemistId,omitempty"`
+	QuantityUsed float64 `json:"quantityUsed"`
+	Result       *string `json:"result,omitempty"`
+	CreatedAt    string  `json:"createdAt"`
+}
+
+// DeletedPayload: recurso eliminado (*.deleted).
+type DeletedPayload struct {
+	ID          uint  `json:"id"`
+	AlchemistID *uint `json:"alchemistId,omitempty"`
+}
+
+// Motivos de material.stock_changed.
+const (
+	StockTransmutation        = "transmutation"         // consumo de una transmutación
+	StockTransmutationDeleted = "transmutation_deleted" // se devolvió al borrarla
+	StockManual               = "manual"                // edición del material
+)
+
+type StockChangedPayload struct {
+	MaterialID      uint    `json:"materialId"`
+	Name            string  `json:"name"`
+	Unit            string  `json:"unit"`
+	Quantity        float64 `json:"quantity"` // cantidad resultante
+	Delta           float64 `json:"delta"`
+	Reason          string  `json:"reason"`
+	TransmutationID *uint   `json:"transmutationId,omitempty"`
+}
+
+// StockChanged arma el payload a partir del material ya actualizado.
+func StockChanged(m models.Material, delta float64, reason string, transmutationID *uint) StockChangedPayload {
+	return StockChangedPayload{
+		MaterialID:      m.ID,
+		Name:            m.Name,
+		Unit:            m.Unit,
+		Quantity:        m.Quantity,
+		Delta:           delta,
+		Reason:          reason,
+		TransmutationID: transmutationID,
+	}
+}
+
+type MissionStatusChangedPayload struct {
+	MissionID           uint                 `json:"missionId"`
+	Title               string               `json:"title"`
+	From                models.MissionStatus `json:"from"`
+	To                  models.MissionStatus `json:"to"`
+	AssignedAlchemistID *uint                `json:"assignedAlchemistId,omitempty"`
+}
@@ -0,0 +1,211 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"amestris/backend/internal/queue"
+)
+
+// Replay asigna ids crecientes a los eventos y guarda los últimos para que un
+// cliente que reconecta con Last-Event-ID reciba lo que se perdió.
+type Replay interface {
+	// Append asigna ev.ID y lo guarda. Si ev.Key ya se guardó (el relay
+	// reintenta un mensaje ya publicado) devuelve dup=true con el ID de
+	// entonces y no guarda nada.
+	Append(ctx context.Context, ev *Event) (dup bool, err error)
+	// Since devuelve los eventos con id > after en orden; ok=false si el
+	// buffer ya no llega hasta after (hubo eventos que no se pueden reenviar).
+	Since(ctx context.Context, after uint64) (evs []Event, ok bool, err error)
+	// Lookup: id del evento con esa clave; ok=false si ya no se recuerda.
+	Lookup(ctx context.Context, key string) (id uint64, ok bool, err error)
+}
+
+/* ===================== Memoria ===================== */
+
+// MemoryReplay: ring buffer local. Los ids arrancan en la hora actual en µs
+// para que sigan creciendo tras un reinicio; un Last-Event-ID anterior al
+// reinicio cae fuera del buffer y el cliente recibe "reset".
+type MemoryReplay struct {
+	mu   sync.Mutex
+	seq  uint64
+	buf  []Event
+	keys map[string]uint64 // clave → id de los eventos del buffer
+	next int
+	full bool
+}
+
+func NewMemoryReplay(size int) *MemoryReplay {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryReplay{seq: uint64(time.Now().UnixMicro()), buf: make([]Event, size), keys: map[string]uint64{}}
+}
+
+func (m *MemoryReplay) Append(_ context.Context, ev *Event) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, ok := m.keys[ev.Key]; ok && ev.Key != "" {
+		ev.ID = id
+		return true, nil
+	}
+	m.seq++
+	ev.ID = m.seq
+	if old := m.buf[m.next].Key; old != "" {
+		delete(m.keys, old)
+	}
+	m.buf[m.next] = *ev
+	if ev.Key != "" {
+		m.keys[ev.Key] = ev.ID
+	}
+	m.next = (m.next + 1) % len(m.buf)
+	if m.next == 0 {
+		m.full = true
+	}
+	return false, nil
+}
+
+func (m *MemoryReplay) Lookup(_ context.Context, key string) (uint64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.keys[key]
+	return id, ok, nil
+}
+
+func (m *MemoryReplay) Since(_ context.Context, after uint64) ([]Event, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if after >= m.seq {
+		return nil, after == m.seq, nil
+	}
+	var ordered []Event
+	if m.full {
+		ordered = append(append(ordered, m.buf[m.next:]...), m.buf[:m.next]...)
+	} else {
+		ordered = append(ordered, m.buf[:m.next]...)
+	}
+	out := []Event{}
+	for _, ev := range ordered {
+		if ev.ID > after {
+			out = append(out, ev)
+		}
+	}
+	return out, len(out) > 0 && out[0].ID == after+1, nil
+}
+
+/* ===================== Redis ===================== */
+
+const (
+	redisSeqKey    = "realtime:seq"
+	redisEventsKey = "realtime:events"
+	redisKeyPrefix = "realtime:key:" // clave del outbox → id
+	redisKeyTTL    = 24 * time.Hour
+)
+
+// RedisReplay: buffer compartido entre réplicas y persistente entre
+// reinicios (ZSET por id + contador INCR).
+type RedisReplay struct {
+	rdb  *redis.Client
+	size int64
+}
+
+// storedEvent: Event con su dueño, que no viaja al cliente pero sí se
+// necesita para filtrar al reenviar (y en cada proceso que lo recibe del bus).
+type storedEvent struct {
+	ID          uint64          `json:"id"`
+	Key         string          `json:"key,omitempty"`
+	Type        string          `json:"type"`
+	Data        json.RawMessage `json:"data"`
+	AlchemistID *uint           `json:"alchemistId,omitempty"`
+	ResourceID  uint            `json:"resourceId,omitempty"`
+}
+
+func (s storedEvent) event() Event {
+	return Event{ID: s.ID, Key: s.Key, Type: s.Type, Data: s.Data, AlchemistID: s.AlchemistID, ResourceID: s.ResourceID}
+}
+
+func toStored(ev Event) ([]byte, error) {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(storedEvent{ID: ev.ID, Key: ev.Key, Type: ev.Type, Data: data, AlchemistID: ev.AlchemistID, ResourceID: ev.ResourceID})
+}
+
+func NewRedisReplay(size int) *RedisReplay {
+	if size < 1 {
+		size = 1
+	}
+	return &RedisReplay{
+		rdb:  redis.NewClient(&redis.Options{Addr: queue.RedisAddr()}),
+		size: int64(size),
+	}
+}
+
+func (r *RedisReplay) Append(ctx context.Context, ev *Event) (bool, error) {
+	if ev.Key != "" {
+		if id, ok, err := r.Lookup(ctx, ev.Key); err != nil {
+			return false, err
+		} else if ok {
+			ev.ID = id
+			return true, nil
+		}
+	}
+	id, err := r.rdb.Incr(ctx, redisSeqKey).Uint64()
+	if err != nil {
+		return false, err
+	}
+	ev.ID = id
+	raw, err := toStored(*ev)
+	if err != nil {
+		return false, err
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.ZAdd(ctx, redisEventsKey, redis.Z{Score: float64(id), Member: raw})
+	pipe.ZRemRangeByRank(ctx, redisEventsKey, 0, -r.size-1)
+	if ev.Key != "" {
+		pipe.Set(ctx, redisKeyPrefix+ev.Key, id, redisKeyTTL)
+	}
+	_, err = pipe.Exec(ctx)
+	return false, err
+}
+
+func (r *RedisReplay) Lookup(ctx context.Context, key string) (uint64, bool, error) {
+	id, err := r.rdb.Get(ctx, redisKeyPrefix+key).Uint64()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
+
+func (r *RedisReplay) Since(ctx context.Context, after uint64) ([]Event, bool, error) {
+	raws, err := r.rdb.ZRangeByScore(ctx, redisEventsKey, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatUint(after, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	out := make([]Event, 0, len(raws))
+	for _, raw := range raws {
+		var s storedEvent
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			continue
+		}
+		out = append(out, s.event())
+	}
+	if len(out) == 0 {
+		seq, err := r.rdb.Get(ctx, redisSeqKey).Uint64()
+		if err != nil && err != redis.Nil {
+			return nil, false, err
+		}
+		return out, after == seq, nil
+	}
+	return out, out[0].ID == after+1, nil
+}
@@ -0,0 +1,232 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"amestris/backend/internal/authz"
+)
+
+// Policy: permiso para recibir los eventos de un tema y permiso para verlos
+// todos; sin este último solo llegan los del alquimista vinculado al usuario.
+type Policy struct {
+	Read string
+	All  string
+}
+
+// Topics: temas con su política. Un evento cuyo tema no esté aquí no se envía.
+var Topics = map[string]Policy{
+	"transmutation": {Read: authz.TransmutationsRead, All: authz.TransmutationsAny},
+	"mission":       {Read: authz.MissionsRead, All: authz.MissionsWrite},
+	// Materiales y alquimistas no tienen dueño: quien puede leerlos los ve todos
+	"material":  {Read: authz.MaterialsRead, All: authz.MaterialsRead},
+	"alchemist": {Read: authz.AlchemistsRead, All: authz.AlchemistsRead},
+}
+
+// Topic: "transmutation.created" → "transmutation".
+func Topic(evType string) string {
+	t, _, _ := strings.Cut(evType, ".")
+	return t
+}
+
+// ParseTopic valida una suscripción a un tema: "mission" o "mission:*" (todo
+// el tema, se normaliza a "mission") o "mission:42" (un recurso).
+func ParseTopic(s string) (string, error) {
+	name, id, hasID := strings.Cut(strings.TrimSpace(s), ":")
+	if _, ok := Topics[name]; !ok {
+		return "", fmt.Errorf("tema desconocido: %s", s)
+	}
+	if !hasID || id == "*" {
+		return name, nil
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || n == 0 {
+		return "", fmt.Errorf("id de recurso inválido: %s", s)
+	}
+	return name + ":" + strconv.FormatUint(n, 10), nil
+}
+
+// Access: lo que el suscriptor puede ver; se recalcula en cada recheck.
+type Access struct {
+	Perms       authz.Set
+	AlchemistID *uint
+}
+
+type Subscriber struct {
+	UserID uint
+	// Refresh revalida usuario, sesión y permisos; un error cierra el stream
+	Refresh func(context.Context) (Access, error)
+
+	mu     sync.RWMutex
+	access Access
+	// Filtro pedido por el cliente (?types= / ?topics=, o subscribe por
+	// WebSocket); all = sin filtro, recibe todo lo que su rol permite
+	all    bool
+	types  map[string]bool
+	topics map[string]bool // "mission" (todo el tema) o "mission:42"
+}
+
+func NewSubscriber(userID uint, access Access, q url.Values) (*Subscriber, error) {
+	s := &Subscriber{UserID: userID, types: map[string]bool{}, topics: map[string]bool{}, access: access}
+	for _, t := range splitParam(q["types"]) {
+		if !slices.Contains(Types, t) {
+			return nil, fmt.Errorf("tipo de evento desconocido: %s", t)
+		}
+		s.types[t] = true
+	}
+	for _, t := range splitParam(q["topics"]) {
+		key, err := ParseTopic(t)
+		if err != nil {
+			return nil, err
+		}
+		s.topics[key] = true
+	}
+	s.all = len(s.types) == 0 && len(s.topics) == 0
+	return s, nil
+}
+
+// Subscribe añade suscripciones a temas; falla sin cambios si alguna no es
+// válida o el rol no permite leer el tema.
+func (s *Subscriber) Subscribe(topics []string) error {
+	keys, err := s.parseTopics(topics)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		name, _, _ := strings.Cut(k, ":")
+		if !s.access.Perms.Has(Topics[name].Read) {
+			return fmt.Errorf("sin permiso para el tema %s", name)
+		}
+	}
+	for _, k := range keys {
+		s.topics[k] = true
+	}
+	s.all = false
+	return nil
+}
+
+// Unsubscribe quita suscripciones; "mission:*" no quita las de recursos
+// sueltos como "mission:42".
+func (s *Subscriber) Unsubscribe(topics []string) error {
+	keys, err := s.parseTopics(topics)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.topics, k)
+	}
+	return nil
+}
+
+func (s *Subscriber) parseTopics(topics []string) ([]string, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("topics es obligatorio")
+	}
+	keys := make([]string, 0, len(topics))
+	for _, t := range topics {
+		k, err := ParseTopic(t)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Subscriptions: tipos y temas del filtro actual ("mission:*" = todo el tema).
+func (s *Subscriber) Subscriptions() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []string{}
+	for t := range s.types {
+		out = append(out, t)
+	}
+	for k := range s.topics {
+		if !strings.Contains(k, ":") {
+			k += ":*"
+		}
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Wants: el cliente lo pidió y su rol/propiedad le permite verlo.
+func (s *Subscriber) Wants(ev Event) bool {
+	topic := Topic(ev.Type)
+	p, ok := Topics[topic]
+	if !ok {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.all && !s.types[ev.Type] && !s.topics[topic] &&
+		!(ev.ResourceID != 0 && s.topics[topic+":"+strconv.FormatUint(uint64(ev.ResourceID), 10)]) {
+		return false
+	}
+	if !s.access.Perms.Has(p.Read) {
+		return false
+	}
+	if s.access.Perms.Has(p.All) {
+		return true
+	}
+	return ev.AlchemistID != nil && s.access.AlchemistID != nil && *ev.AlchemistID == *s.access.AlchemistID
+}
+
+// Filter: tipos que puede recibir el cliente (según lo pedido, no según
+// permisos); con "mission:42" entran los de mission aunque sean de un recurso.
+func (s *Subscriber) Filter() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	topics := map[string]bool{}
+	for k := range s.topics {
+		name, _, _ := strings.Cut(k, ":")
+		topics[name] = true
+	}
+	out := []string{}
+	for _, t := range Types {
+		if s.all || s.types[t] || topics[Topic(t)] {
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Subscriber) refresh(ctx context.Context) error {
+	if s.Refresh == nil {
+		return nil
+	}
+	a, err := s.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.access = a
+	s.mu.Unlock()
+	return nil
+}
+
+// splitParam acepta ?types=a,b y ?types=a&types=b.
+func splitParam(vals []string) []string {
+	out := []string{}
+	for _, v := range vals {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"amestris/backend/internal/metrics"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 25 * time.Second
+	wsMaxMessage = 4096
+)
+
+// wsCommand: mensaje del cliente. Cada uno recibe "ack" (con las
+// suscripciones resultantes) o "error", con el mismo ref.
+type wsCommand struct {
+	Op     string   `json:"op"`     // subscribe | unsubscribe | ping
+	Topics []string `json:"topics"` // "mission:42", "material:*", "transmutation"
+	Ref    string   `json:"ref,omitempty"`
+}
+
+// ServeWS sirve una conexión WebSocket ya autenticada y abierta, con el mismo
+// sobre que el SSE ({id, type, data}). Sin ?types=/?topics= no llega nada
+// hasta el primer subscribe. Pings de protocolo cada 25 s; si la cola del
+// cliente se llena se cierra con 1013 para que reanude con lastEventId.
+func (b *Broker) ServeWS(ctx context.Context, conn *websocket.Conn, sub *Subscriber, recheck time.Duration, lastEventID string) {
+	defer conn.Close()
+	log.Println("⚡ Nueva conexión WebSocket desde", conn.RemoteAddr(), "usuario", sub.UserID)
+
+	sub.mu.Lock()
+	sub.all = false
+	sub.mu.Unlock()
+
+	id, c := b.AddClient(sub)
+	defer b.RemoveClient(id)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replies := make(chan Event, 8)
+	go readWS(ctx, cancel, conn, sub, replies)
+
+	send := func(ev Event) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(ev)
+	}
+	closeWith := func(code int, reason string) {
+		msg := websocket.FormatCloseMessage(code, reason)
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+	}
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	rechecker := time.NewTicker(recheck)
+	defer rechecker.Stop()
+
+	if err := send(Event{Type: "hello", Data: map[string]any{
+		"client":        id,
+		"subscriptions": sub.Subscriptions(),
+	}}); err != nil {
+		return
+	}
+	replayed, err := b.replayTo(ctx, sub, lastEventID, send)
+	if err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.shutdown:
+			closeWith(websocket.CloseGoingAway, "servidor detenido")
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case <-rechecker.C:
+			if err := sub.refresh(ctx); err != nil {
+				log.Printf("ws: cierre del cliente %d (usuario %d): %v", id, sub.UserID, err)
+				_ = send(Event{Type: "close", Data: map[string]string{"reason": err.Error()}})
+				closeWith(websocket.ClosePolicyViolation, "sesión no válida")
+				return
+			}
+		case <-c.lagged:
+			log.Printf("ws: cliente %d (usuario %d) se quedó atrás; se cierra para que reanude", id, sub.UserID)
+			closeWith(websocket.CloseTryAgainLater, "cola llena: reconecta con lastEventId")
+			return
+		case ev := <-replies:
+			if err := send(ev); err != nil {
+				return
+			}
+		case ev, ok := <-c.ch:
+			if !ok {
+				return
+			}
+			if replayed[ev.ID] {
+				delete(replayed, ev.ID)
+				continue
+			}
+			if err := send(ev); err != nil {
+				log.Printf("ws write error: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// readWS lee los comandos del cliente; al cortarse la conexión (o sin pong en
+// wsPongWait) cancela ctx y termina ServeWS.
+func readWS(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, sub *Subscriber, replies chan<- Event) {
+	defer cancel()
+	conn.SetReadLimit(wsMaxMessage)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var cmd wsCommand
+		var reply Event
+		if err := json.Unmarshal(raw, &cmd); err != nil {
+			reply = wsError(cmd, errors.New("mensaje inválido: se espera JSON {op, topics, ref}"))
+		} else {
+			reply = applyWS(sub, cmd)
+		}
+		select {
+		case replies <- reply:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func applyWS(sub *Subscriber, cmd wsCommand) Event {
+	var err error
+	switch cmd.Op {
+	case "subscribe":
+		err = sub.Subscribe(cmd.Topics)
+	case "unsubscribe":
+		err = sub.Unsubscribe(cmd.Topics)
+	case "ping":
+	default:
+		metrics.WSCommand("unknown", "error")
+		return wsError(cmd, errors.New("op desconocida (subscribe, unsubscribe, ping)"))
+	}
+	if err != nil {
+		metrics.WSCommand(cmd.Op, "error")
+		return wsError(cmd, err)
+	}
+	metrics.WSCommand(cmd.Op, "ok")
+	return Event{Type: "ack", Data: map[string]any{
+		"op":            cmd.Op,
+		"ref":           cmd.Ref,
+		"subscriptions": sub.Subscriptions(),
+	}}
+}
+
+func wsError(cmd wsCommand, err error) Event {
+	return Event{Type: "error", Data: map[string]any{
+		"op":    cmd.Op,
+		"ref":   cmd.Ref,
+		"error": err.Error(),
+	}}
+}
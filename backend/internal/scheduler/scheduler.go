@@ -0,0 +1,273 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/metrics"
+	"amestris/backend/internal/models"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobFunc: trabajo que ejecuta el scheduler.
+type JobFunc func(ctx context.Context) error
+
+type job struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	run      JobFunc
+}
+
+// Scheduler ejecuta jobs con expresiones cron y persiste su estado en
+// scheduled_jobs. Cada réplica dispara según su propio cron (con @every, desde
+// que arrancó), pero solo ejecuta quien reclama el turno planificado
+// (next_run_at vencido) y lo avanza al siguiente en el mismo UPDATE; el lease
+// evita además que dos ejecuciones del mismo job se solapen.
+type Scheduler struct {
+	db     *gorm.DB
+	cron   *cron.Cron
+	parser cron.Parser
+	owner  string
+	lease  time.Duration
+	poll   time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	wg   sync.WaitGroup
+}
+
+// New crea el scheduler; la configuración sale de SCHEDULER_LEASE_SEC y SCHEDULER_POLL_SEC.
+func New(d *gorm.DB) *Scheduler {
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	return &Scheduler{
+		db:     d,
+		cron:   cron.New(cron.WithParser(parser)),
+		parser: parser,
+		owner:  ownerID(),
+		lease:  time.Duration(db.MustGetInt("SCHEDULER_LEASE_SEC", 600)) * time.Second,
+		poll:   time.Duration(db.MustGetInt("SCHEDULER_POLL_SEC", 10)) * time.Second,
+		jobs:   map[string]*job{},
+	}
+}
+
+func ownerID() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// EnvKey devuelve la variable que sobreescribe la expresión de un job,
+// p. ej. "stale_missions" → SCHEDULE_STALE_MISSIONS.
+func EnvKey(name string) string {
+	return "SCHEDULE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Register agrega un job. La expresión cron se toma de SCHEDULE_<NAME> o, si no existe, de defSpec.
+func (s *Scheduler) Register(name, defSpec string, fn JobFunc) error {
+	spec := strings.TrimSpace(os.Getenv(EnvKey(name)))
+	if spec == "" {
+		spec = defSpec
+	}
+	sched, err := s.parser.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("scheduler: expresión inválida para %s (%q): %w", name, spec, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, dup := s.jobs[name]; dup {
+		return fmt.Errorf("scheduler: job duplicado %s", name)
+	}
+	s.jobs[name] = &job{name: name, spec: spec, schedule: sched, run: fn}
+	return nil
+}
+
+// Start sincroniza el registro en BD, arranca cron y el sondeo de disparos manuales.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, j := range s.jobs {
+		next := j.schedule.Next(now)
+		row := models.ScheduledJob{Name: j.name, Schedule: j.spec, Status: models.JobIdle, NextRunAt: &next}
+		// Inserta o actualiza solo la expresión: pausa y estadísticas se
+		// conservan, y el turno planificado también (otra réplica ya arrancada
+		// lo comparte) salvo que cambie la expresión
+		if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "name"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "next_run_at"}, Value: gorm.Expr(
+					"CASE WHEN scheduled_jobs.schedule <> excluded.schedule OR scheduled_jobs.next_run_at IS NULL THEN excluded.next_run_at ELSE scheduled_jobs.next_run_at END")},
+				{Column: clause.Column{Name: "schedule"}, Value: gorm.Expr("excluded.schedule")},
+				{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("excluded.updated_at")},
+			},
+		}).Create(&row).Error; err != nil {
+			return err
+		}
+
+		j := j
+		if _, err := s.cron.AddFunc(j.spec, func() { s.execute(ctx, j, false) }); err != nil {
+			return err
+		}
+		log.Printf("🗓️  scheduler: %s → %q (próxima %s)", j.name, j.spec, next.Format(time.RFC3339))
+	}
+
+	s.cron.Start()
+	s.wg.Add(1)
+	go s.pollTriggers(ctx)
+	return nil
+}
+
+// Stop detiene cron y espera a que terminen los jobs en curso (o a que venza ctx).
+func (s *Scheduler) Stop(ctx context.Context) {
+	done := s.cron.Stop()
+	select {
+	case <-done.Done():
+	case <-ctx.Done():
+		log.Println("scheduler: timeout esperando jobs en curso")
+	}
+	s.wg.Wait()
+}
+
+// pollTriggers ejecuta los jobs marcados con trigger_requested_at desde la API.
+func (s *Scheduler) pollTriggers(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var names []string
+			if err := s.db.WithContext(ctx).Model(&models.ScheduledJob{}).
+				Where("trigger_requested_at IS NOT NULL").Pluck("name", &names).Error; err != nil {
+				log.Printf("scheduler: error consultando disparos manuales: %v", err)
+				continue
+			}
+			for _, name := range names {
+				s.mu.Lock()
+				j := s.jobs[name]
+				s.mu.Unlock()
+				if j != nil {
+					s.execute(ctx, j, true)
+				}
+			}
+		}
+	}
+}
+
+var errNotAcquired = errors.New("lease no adquirido")
+
+// claim toma el lease del job. Un disparo cron reclama el turno planificado:
+// solo si next_run_at ya venció, y lo avanza al siguiente en el mismo UPDATE,
+// así que de las réplicas que disparan para ese turno gana una sola aunque
+// sus relojes de cron vayan desfasados. Un manual consume el trigger.
+func (s *Scheduler) claim(ctx context.Context, j *job, manual bool, now time.Time) error {
+	q := s.db.WithContext(ctx).Model(&models.ScheduledJob{}).
+		Where("name = ?", j.name).
+		Where("locked_until IS NULL OR locked_until < ?", now)
+
+	updates := map[string]any{
+		"locked_by":            s.owner,
+		"locked_until":         now.Add(s.lease),
+		"status":               models.JobRunning,
+		"last_run_at":          now,
+		"trigger_requested_at": nil,
+	}
+	if manual {
+		q = q.Where("trigger_requested_at IS NOT NULL")
+	} else {
+		q = q.Where("paused = ?", false).
+			Where("next_run_at IS NULL OR next_run_at <= ?", now)
+		updates["next_run_at"] = j.schedule.Next(now)
+	}
+
+	res := q.Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errNotAcquired
+	}
+	return nil
+}
+
+func (s *Scheduler) execute(parent context.Context, j *job, manual bool) {
+	if parent.Err() != nil {
+		return
+	}
+	now := time.Now()
+	if err := s.claim(parent, j, manual, now); err != nil {
+		if !errors.Is(err, errNotAcquired) {
+			log.Printf("scheduler: %s: error tomando lease: %v", j.name, err)
+		}
+		s.touchNext(parent, j)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(parent, s.lease)
+	defer cancel()
+
+	runErr := safeRun(ctx, j.run)
+	finished := time.Now()
+
+	updates := map[string]any{
+		"locked_by":        "",
+		"locked_until":     nil,
+		"last_finished_at": finished,
+		"last_duration_ms": finished.Sub(now).Milliseconds(),
+		"run_count":        gorm.Expr("run_count + 1"),
+	}
+	result := "ok"
+	if runErr != nil {
+		result = "error"
+		updates["status"] = models.JobFailed
+		updates["last_error"] = runErr.Error()
+		updates["fail_count"] = gorm.Expr("fail_count + 1")
+		log.Printf("❌ scheduler: %s falló en %v: %v", j.name, finished.Sub(now), runErr)
+	} else {
+		updates["status"] = models.JobOK
+		updates["last_error"] = ""
+		log.Printf("✅ scheduler: %s terminó en %v", j.name, finished.Sub(now))
+	}
+	// Se usa el contexto padre sin timeout para registrar incluso si el job venció
+	if err := s.db.WithContext(context.WithoutCancel(parent)).Model(&models.ScheduledJob{}).
+		Where("name = ? AND locked_by = ?", j.name, s.owner).Updates(updates).Error; err != nil {
+		log.Printf("scheduler: %s: error guardando estado: %v", j.name, err)
+	}
+	metrics.JobProcessed(j.name, result)
+}
+
+// touchNext avanza el turno vencido de un job pausado, para que al reanudarlo
+// no corra en el acto. Si el disparo lo tomó otra réplica, el turno ya lo
+// avanzó ella.
+func (s *Scheduler) touchNext(ctx context.Context, j *job) {
+	now := time.Now()
+	_ = s.db.WithContext(ctx).Model(&models.ScheduledJob{}).
+		Where("name = ? AND paused = ? AND (next_run_at IS NULL OR next_run_at <= ?)", j.name, true, now).
+		UpdateColumn("next_run_at", j.schedule.Next(now)).Error
+}
+
+func safeRun(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return fn(ctx)
+}
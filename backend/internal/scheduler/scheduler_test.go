@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+// Dos réplicas arrancadas con un desfase menor que el intervalo: con @every
+// cada una dispara a su ritmo, pero cada turno se ejecuta una sola vez
+// (TEST_DB_DSN).
+func TestDosReplicasDesfasadasEjecutanCadaTurnoUnaVez(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN no definido")
+	}
+	t.Setenv("DB_DSN", dsn)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	name := fmt.Sprintf("test_offset_%d", time.Now().UnixNano())
+	t.Setenv(EnvKey(name), "@every 2s")
+	t.Cleanup(func() { db.Get().Where("name = ?", name).Delete(&models.ScheduledJob{}) })
+
+	var (
+		mu   sync.Mutex
+		runs []time.Time
+		by   = map[string]int{}
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := func(owner string) *Scheduler {
+		s := New(db.Get())
+		s.owner = owner
+		if err := s.Register(name, "@daily", func(context.Context) error {
+			mu.Lock()
+			runs = append(runs, time.Now())
+			by[owner]++
+			mu.Unlock()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	a := start("replica-a")
+	time.Sleep(1100 * time.Millisecond)
+	b := start("replica-b")
+	time.Sleep(8 * time.Second)
+	cancel()
+	stopCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	a.Stop(stopCtx)
+	b.Stop(stopCtx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(runs) < 3 || len(runs) > 5 {
+		t.Fatalf("ejecuciones = %d (%v), quería una por turno de 2 s", len(runs), by)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Before(runs[j]) })
+	for i := 1; i < len(runs); i++ {
+		if gap := runs[i].Sub(runs[i-1]); gap < 1500*time.Millisecond {
+			t.Fatalf("dos ejecuciones a %v una de otra (%v): el turno se duplicó", gap, by)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/metrics"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+)
+
+// ErrNotReplayable: la entrega aún está pendiente o reintentándose.
+var ErrNotReplayable = errors.New("solo se pueden reenviar entregas DELIVERED o DEAD")
+
+// Register agrega al relay el reparto de eventos a los webhooks suscritos y
+// el envío de cada entrega, con los reintentos de RetryFromEnv. Los envíos
+// van en su propio carril: un receptor lento no retrasa auditorías ni eventos.
+func Register(r *outbox.Relay, d *gorm.DB) {
+	retry := RetryFromEnv()
+	r.Handle(outbox.KindEvent, fanout(d))
+	r.Handle(outbox.KindWebhook, deliver(d, NewSender(), retry))
+	r.SetRetry(outbox.KindWebhook, retry)
+	r.Lane(outbox.KindWebhook)
+}
+
+// fanout registra una entrega por cada webhook activo suscrito al evento. Si
+// el mensaje se reintenta, el índice (webhook_id, event_id) evita duplicarlas.
+func fanout(d *gorm.DB) outbox.Sink {
+	return func(ctx context.Context, m models.OutboxMessage) error {
+		var p outbox.EventPayload
+		if err := json.Unmarshal(m.Payload, &p); err != nil {
+			return err
+		}
+		match, _ := json.Marshal([]string{p.Type})
+		var hooks []models.Webhook
+		if err := d.WithContext(ctx).
+			Where("active AND (events @> ?::jsonb OR events @> '[\"*\"]'::jsonb)", string(match)).
+			Find(&hooks).Error; err != nil {
+			return err
+		}
+		if len(hooks) == 0 {
+			return nil
+		}
+
+		body, err := json.Marshal(Body{ID: m.Key, Type: p.Type, CreatedAt: m.CreatedAt, Data: p.Data})
+		if err != nil {
+			return err
+		}
+		return d.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, h := range hooks {
+				if _, err := enqueue(tx, h.ID, m.Key, p.Type, body); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// enqueue registra la entrega y encola su envío en tx. Devuelve nil si la
+// entrega de ese evento a ese webhook ya existía.
+func enqueue(tx *gorm.DB, hookID uint, eventID, evType string, body []byte) (*models.WebhookDelivery, error) {
+	dl := models.WebhookDelivery{
+		WebhookID: hookID,
+		EventID:   eventID,
+		EventType: evType,
+		Payload:   body,
+		Status:    models.WebhookPending,
+	}
+	res := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "webhook_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).Create(&dl)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	return &dl, outbox.Webhook(tx, dl.ID)
+}
+
+// deliver envía una entrega y deja el resultado en webhook_deliveries. El
+// error hace que el relay la reintente con backoff; en el último intento
+// queda DEAD.
+func deliver(d *gorm.DB, s *Sender, retry async.RetryConfig) outbox.Sink {
+	return func(ctx context.Context, m models.OutboxMessage) error {
+		var p outbox.WebhookPayload
+		if err := json.Unmarshal(m.Payload, &p); err != nil {
+			return err
+		}
+		var dl models.WebhookDelivery
+		if err := d.WithContext(ctx).First(&dl, p.DeliveryID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil // webhook eliminado
+			}
+			return err
+		}
+		var h models.Webhook
+		if err := d.WithContext(ctx).First(&h, dl.WebhookID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if !h.Active {
+			dl.Status = models.WebhookDead
+			dl.LastError = "webhook desactivado"
+			metrics.WebhookDelivered("dead")
+			return d.WithContext(ctx).Save(&dl).Error
+		}
+
+		res := s.Send(ctx, h, dl)
+		dl.Attempts++
+		dl.ResponseStatus = res.Status
+		dl.ResponseBody = res.Body
+		dl.DurationMs = res.Duration.Milliseconds()
+		switch {
+		case res.Err == nil:
+			now := time.Now()
+			dl.Status = models.WebhookDelivered
+			dl.DeliveredAt = &now
+			dl.LastError = ""
+			metrics.WebhookDelivered("ok")
+		case m.Attempts+1 >= retry.MaxAttempts:
+			dl.Status = models.WebhookDead
+			dl.LastError = res.Err.Error()
+			metrics.WebhookDelivered("dead")
+		default:
+			dl.Status = models.WebhookFailed
+			dl.LastError = res.Err.Error()
+			metrics.WebhookDelivered("retry")
+		}
+		if err := d.WithContext(ctx).Save(&dl).Error; err != nil {
+			log.Printf("warn: webhook: no se pudo registrar la entrega %d: %v", dl.ID, err)
+		}
+		return res.Err
+	}
+}
+
+/* ===================== Ping y replay ===================== */
+
+// Ping encola en tx un evento webhook.ping para h.
+func Ping(tx *gorm.DB, h models.Webhook) (*models.WebhookDelivery, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	eventID := hex.EncodeToString(b)
+	data, _ := json.Marshal(map[string]any{"webhookId": h.ID, "name": h.Name})
+	body, err := json.Marshal(Body{ID: eventID, Type: PingEvent, CreatedAt: time.Now(), Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return enqueue(tx, h.ID, eventID, PingEvent, body)
+}
+
+// Replay vuelve a enviar en tx una entrega terminada, con el mismo cuerpo y
+// X-Amestris-Event-Id (el receptor puede deduplicarla).
+func Replay(tx *gorm.DB, dl *models.WebhookDelivery) error {
+	if dl.Status != models.WebhookDelivered && dl.Status != models.WebhookDead {
+		return ErrNotReplayable
+	}
+	dl.Status = models.WebhookPending
+	dl.LastError = ""
+	if err := tx.Model(dl).Updates(map[string]any{"status": dl.Status, "last_error": ""}).Error; err != nil {
+		return err
+	}
+	return outbox.Webhook(tx, dl.ID)
+}
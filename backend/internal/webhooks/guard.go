@@ -0,0 +1,108 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress: el destino es una dirección interna (privada, loopback,
+// link-local —incluidos los metadatos de la nube— o reservada).
+var ErrForbiddenAddress = errors.New("destino no permitido: dirección interna o reservada")
+
+// Rangos que IsPrivate/IsLoopback/IsLinkLocal* no cubren.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "esta red"
+	netip.MustParsePrefix("100.64.0.0/10"), // CGNAT (p. ej. metadatos de Alibaba)
+	netip.MustParsePrefix("192.0.0.0/24"),  // asignaciones IETF
+	netip.MustParsePrefix("198.18.0.0/15"), // pruebas de rendimiento
+	netip.MustParsePrefix("240.0.0.0/4"),   // reservado y broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64: lleva una IPv4 dentro
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"), // 6to4: ídem
+}
+
+// allowPrivate: WEBHOOK_ALLOW_PRIVATE=true desactiva el filtro (solo para
+// receptores en la red local durante el desarrollo).
+func allowPrivate() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("WEBHOOK_ALLOW_PRIVATE")))
+	return v == "true" || v == "1"
+}
+
+// Blocked indica si ip no es un destino público de Internet.
+func Blocked(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return true
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL valida la URL al registrar el webhook: http(s) absoluta y, si el
+// host es una IP literal o localhost, que no sea interna. Los nombres se
+// comprueban al enviar, contra la IP a la que realmente se conecta.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url debe ser http(s) absoluta")
+	}
+	if allowPrivate() {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && Blocked(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// dialControl corre después de resolver el nombre y antes de conectar, así
+// que valida la IP real de cada conexión: un DNS que cambie de respuesta
+// entre el registro y el envío (DNS rebinding) no sirve para llegar dentro.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if Blocked(ip) {
+		return fmt.Errorf("%w (%s)", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
+
+// guardedTransport: transporte del Sender. Sin proxy: con uno, la conexión
+// (y el chequeo) sería contra el proxy y no contra el destino.
+func guardedTransport(timeout time.Duration) *http.Transport {
+	d := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate() {
+		d.Control = dialControl
+	}
+	return &http.Transport{
+		DialContext:           d.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          50,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+}
@@ -0,0 +1,180 @@
+// Package webhooks entrega los eventos de dominio a sistemas externos. Cada
+// evento del outbox genera una entrega (webhook_deliveries) por webhook
+// suscrito, y cada entrega se envía como su propio mensaje del outbox, así que
+// hereda los reintentos con backoff del relay.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+)
+
+// Cabeceras de cada entrega.
+const (
+	HeaderSignature = "X-Amestris-Signature" // t=<unix>,v1=<hex HMAC-SHA256 de "<t>.<cuerpo>">
+	HeaderEvent     = "X-Amestris-Event"
+	HeaderEventID   = "X-Amestris-Event-Id" // igual en reintentos y replays: sirve para deduplicar
+	HeaderDelivery  = "X-Amestris-Delivery"
+)
+
+// PingEvent: evento de prueba de POST /webhooks/{id}/ping.
+const PingEvent = "webhook.ping"
+
+// maxResponseBody: lo que se guarda de la respuesta del receptor; basta para
+// diagnosticar un error y no convierte el registro de entregas en un lector
+// de respuestas ajenas.
+const maxResponseBody = 256
+
+// Body: cuerpo JSON de cada entrega.
+type Body struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewSecret genera el secreto de firma de un webhook.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign devuelve el valor de X-Amestris-Signature para body enviado en ts.
+func Sign(secret string, ts int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", ts, digest(secret, ts, body))
+}
+
+func digest(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify comprueba una firma como lo haría el receptor: HMAC correcto y
+// marca de tiempo a menos de tolerance de now (evita reenvíos de terceros).
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts int64
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return errors.New("firma: t inválido")
+			}
+			ts = n
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	if ts == 0 || len(sigs) == 0 {
+		return errors.New("firma: faltan t o v1")
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return errors.New("firma: fuera de la ventana de tiempo")
+	}
+	want := digest(secret, ts, body)
+	for _, s := range sigs {
+		if hmac.Equal([]byte(s), []byte(want)) {
+			return nil
+		}
+	}
+	return errors.New("firma: no coincide")
+}
+
+// RetryFromEnv: reintentos de las entregas (WEBHOOK_MAX_ATTEMPTS,
+// WEBHOOK_BACKOFF_MS, WEBHOOK_BACKOFF_MAX_MS). Más largos que los del resto
+// del outbox: el receptor puede estar caído un rato.
+func RetryFromEnv() async.RetryConfig {
+	return async.RetryConfig{
+		MaxAttempts: db.MustGetInt("WEBHOOK_MAX_ATTEMPTS", 10),
+		BackoffBase: time.Duration(db.MustGetInt("WEBHOOK_BACKOFF_MS", 5_000)) * time.Millisecond,
+		BackoffMax:  time.Duration(db.MustGetInt("WEBHOOK_BACKOFF_MAX_MS", 600_000)) * time.Millisecond,
+		Factor:      2.0,
+	}
+}
+
+/* ===================== Envío ===================== */
+
+// Result: resultado de un intento de entrega.
+type Result struct {
+	Status   int
+	Body     string
+	Duration time.Duration
+	Err      error // error de red o respuesta fuera de 2xx
+}
+
+// Sender hace el POST firmado; Client se puede sustituir (p. ej. en pruebas
+// contra un httptest.Server, que escucha en loopback).
+type Sender struct {
+	Client *http.Client
+}
+
+// NewSender: timeout por intento WEBHOOK_TIMEOUT_SEC; no sigue redirecciones
+// (un 3xx cuenta como fallo) y solo conecta a direcciones públicas (ver
+// dialControl y WEBHOOK_ALLOW_PRIVATE).
+func NewSender() *Sender {
+	timeout := time.Duration(db.MustGetInt("WEBHOOK_TIMEOUT_SEC", 10)) * time.Second
+	return &Sender{Client: &http.Client{
+		Timeout:   timeout,
+		Transport: guardedTransport(timeout),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// Send envía la entrega d al webhook h.
+func (s *Sender) Send(ctx context.Context, h models.Webhook, d models.WebhookDelivery) Result {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return Result{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Amestris-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderEventID, d.EventID)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set(HeaderSignature, Sign(h.Secret, time.Now().Unix(), d.Payload))
+
+	start := time.Now()
+	resp, err := s.Client.Do(req)
+	res := Result{Duration: time.Since(start)}
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody+1))
+	if len(b) > maxResponseBody {
+		b = append(b[:maxResponseBody], "…"...)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	res.Status = resp.StatusCode
+	res.Body = strings.ToValidUTF8(string(b), "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		res.Err = fmt.Errorf("el receptor respondió %d", resp.StatusCode)
+	}
+	return res
+}
@@ -0,0 +1,302 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"amestris/backend/internal/async"
+	"amestris/backend/internal/db"
+	"amestris/backend/internal/models"
+	"amestris/backend/internal/outbox"
+)
+
+const testSecret = "whsec_test_0123456789abcdef"
+
+// receiver es un receptor httptest que verifica la firma de cada entrega.
+type receiver struct {
+	*httptest.Server
+	status atomic.Int32
+
+	mu       sync.Mutex
+	eventIDs []string
+	errs     []error
+}
+
+func newReceiver(t *testing.T) *receiver {
+	t.Helper()
+	rc := &receiver{}
+	rc.status.Store(http.StatusOK)
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := Verify(testSecret, r.Header.Get(HeaderSignature), body, 5*time.Minute, time.Now())
+		if err == nil && r.Header.Get(HeaderEvent) == "" {
+			err = errors.New("falta " + HeaderEvent)
+		}
+		rc.mu.Lock()
+		rc.eventIDs = append(rc.eventIDs, r.Header.Get(HeaderEventID))
+		rc.errs = append(rc.errs, err)
+		rc.mu.Unlock()
+		w.WriteHeader(int(rc.status.Load()))
+		_, _ = w.Write([]byte("recibido"))
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) calls() ([]string, []error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]string(nil), rc.eventIDs...), append([]error(nil), rc.errs...)
+}
+
+func testDelivery(id uint) models.WebhookDelivery {
+	body, _ := json.Marshal(Body{ID: "evt-1", Type: "mission.updated", CreatedAt: time.Now(), Data: json.RawMessage(`{"id":7}`)})
+	return models.WebhookDelivery{ID: id, EventID: "evt-1", EventType: "mission.updated", Payload: body}
+}
+
+/* ===================== Firma ===================== */
+
+func TestSendFirmaLaEntrega(t *testing.T) {
+	rc := newReceiver(t)
+	s := &Sender{Client: rc.Client()}
+	res := s.Send(context.Background(), models.Webhook{URL: rc.URL, Secret: testSecret}, testDelivery(1))
+	if res.Err != nil || res.Status != http.StatusOK || res.Body != "recibido" {
+		t.Fatalf("resultado inesperado: %+v", res)
+	}
+	ids, errs := rc.calls()
+	if len(ids) != 1 || ids[0] != "evt-1" || errs[0] != nil {
+		t.Fatalf("el receptor vio %v / %v", ids, errs)
+	}
+}
+
+func TestVerifyRechaza(t *testing.T) {
+	body := []byte(`{"id":"evt-1"}`)
+	now := time.Now()
+	good := Sign(testSecret, now.Unix(), body)
+	cases := map[string]func() error{
+		"cuerpo alterado": func() error { return Verify(testSecret, good, []byte(`{"id":"evt-2"}`), time.Minute, now) },
+		"otro secreto":    func() error { return Verify("whsec_otro_secreto_123", good, body, time.Minute, now) },
+		"firma antigua": func() error {
+			return Verify(testSecret, Sign(testSecret, now.Add(-10*time.Minute).Unix(), body), body, 5*time.Minute, now)
+		},
+		"sin v1": func() error { return Verify(testSecret, "t=1", body, time.Minute, now) },
+		"vacía":  func() error { return Verify(testSecret, "", body, time.Minute, now) },
+	}
+	for name, f := range cases {
+		if f() == nil {
+			t.Errorf("%s: Verify aceptó la firma", name)
+		}
+	}
+	if err := Verify(testSecret, good, body, time.Minute, now); err != nil {
+		t.Fatalf("firma válida rechazada: %v", err)
+	}
+}
+
+/* ===================== Respuestas ===================== */
+
+func TestSendFallosDelReceptor(t *testing.T) {
+	var followed atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/500", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(strings.Repeat("x", 4096)))
+	})
+	mux.HandleFunc("/302", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/destino", http.StatusFound)
+	})
+	mux.HandleFunc("/destino", func(http.ResponseWriter, *http.Request) { followed.Store(true) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s := NewSender()
+	s.Client.Transport = srv.Client().Transport // el receptor está en loopback
+	h := models.Webhook{Secret: testSecret}
+
+	h.URL = srv.URL + "/500"
+	res := s.Send(context.Background(), h, testDelivery(1))
+	if res.Err == nil || res.Status != http.StatusInternalServerError {
+		t.Fatalf("un 500 debe contar como fallo: %+v", res)
+	}
+	if n := len(res.Body); n > maxResponseBody+len("…") {
+		t.Fatalf("se guardaron %d bytes de la respuesta", n)
+	}
+
+	h.URL = srv.URL + "/302"
+	if res := s.Send(context.Background(), h, testDelivery(1)); res.Err == nil || res.Status != http.StatusFound {
+		t.Fatalf("un 3xx debe contar como fallo: %+v", res)
+	}
+	if followed.Load() {
+		t.Fatal("el sender siguió la redirección")
+	}
+}
+
+/* ===================== Direcciones internas ===================== */
+
+func TestBlocked(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1":          true,
+		"10.1.2.3":           true,
+		"172.16.0.1":         true,
+		"192.168.1.1":        true,
+		"169.254.169.254":    true, // metadatos AWS/GCP/Azure
+		"100.100.100.200":    true, // metadatos Alibaba
+		"0.0.0.0":            true,
+		"255.255.255.255":    true,
+		"::1":                true,
+		"::ffff:127.0.0.1":   true,
+		"fe80::1":            true,
+		"fd00:ec2::254":      true, // metadatos AWS por IPv6
+		"64:ff9b::a9fe:a9fe": true,
+		"8.8.8.8":            false,
+		"2606:4700::1111":    false,
+	} {
+		if got := Blocked(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Blocked(%s) = %v, quería %v", addr, got, want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "")
+	for raw, ok := range map[string]bool{
+		"https://hooks.example.com/amestris":      true,
+		"http://203.0.113.10:8080/in":             true,
+		"ftp://hooks.example.com":                 false,
+		"/relativa":                               false,
+		"http://localhost:9000/":                  false,
+		"http://api.localhost/":                   false,
+		"http://127.0.0.1/":                       false,
+		"http://169.254.169.254/latest/meta-data": false,
+		"http://[::1]:8080/":                      false,
+		"http://[::ffff:10.0.0.1]/":               false,
+	} {
+		if err := CheckURL(raw); (err == nil) != ok {
+			t.Errorf("CheckURL(%q) = %v, quería ok=%v", raw, err, ok)
+		}
+	}
+}
+
+// El filtro se aplica a la IP a la que se conecta, no al nombre registrado:
+// un nombre que resuelve a loopback (como haría un DNS rebinding) se corta.
+func TestNewSenderNoConectaADireccionesInternas(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "")
+	rc := newReceiver(t)
+	port := rc.URL[strings.LastIndex(rc.URL, ":"):]
+
+	for _, u := range []string{rc.URL, "http://localhost" + port} {
+		res := NewSender().Send(context.Background(), models.Webhook{URL: u, Secret: testSecret}, testDelivery(1))
+		if !errors.Is(res.Err, ErrForbiddenAddress) {
+			t.Fatalf("%s: err = %v, quería ErrForbiddenAddress", u, res.Err)
+		}
+	}
+	if ids, _ := rc.calls(); len(ids) != 0 {
+		t.Fatalf("el receptor interno recibió %d peticiones", len(ids))
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	if res := NewSender().Send(context.Background(), models.Webhook{URL: rc.URL, Secret: testSecret}, testDelivery(1)); res.Err != nil {
+		t.Fatalf("con WEBHOOK_ALLOW_PRIVATE: %v", res.Err)
+	}
+}
+
+/* ===================== Reintentos y replay ===================== */
+
+func TestRetryFromEnv(t *testing.T) {
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "4")
+	t.Setenv("WEBHOOK_BACKOFF_MS", "1000")
+	t.Setenv("WEBHOOK_BACKOFF_MAX_MS", "3000")
+	c := RetryFromEnv()
+	if c.MaxAttempts != 4 {
+		t.Fatalf("MaxAttempts = %d", c.MaxAttempts)
+	}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 3 * time.Second, 9: 3 * time.Second} {
+		if got := c.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, quería %v", attempt, got, want)
+		}
+	}
+}
+
+func TestReplaySoloEntregasTerminadas(t *testing.T) {
+	for _, st := range []models.WebhookDeliveryStatus{models.WebhookPending, models.WebhookFailed} {
+		dl := models.WebhookDelivery{Status: st}
+		if err := Replay(nil, &dl); !errors.Is(err, ErrNotReplayable) {
+			t.Errorf("Replay(%s) = %v, quería ErrNotReplayable", st, err)
+		}
+	}
+}
+
+// Ciclo completo contra la base (TEST_DB_DSN): fallo con reintento, DEAD al
+// agotar los intentos y replay con el mismo X-Amestris-Event-Id.
+func TestDeliverReintentosYReplay(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN no definido")
+	}
+	t.Setenv("DB_DSN", dsn)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	d := db.Get()
+
+	rc := newReceiver(t)
+	h := models.Webhook{Name: "test", URL: rc.URL, Events: []string{"*"}, Secret: testSecret, Active: true, CreatedByID: 1}
+	if err := d.Create(&h).Error; err != nil {
+		t.Fatal(err)
+	}
+	dl := testDelivery(0)
+	dl.WebhookID, dl.Status = h.ID, models.WebhookPending
+	if err := d.Create(&dl).Error; err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(outbox.WebhookPayload{DeliveryID: dl.ID})
+	t.Cleanup(func() {
+		d.Where("kind = ? AND payload = ?", outbox.KindWebhook, string(payload)).Delete(&models.OutboxMessage{})
+		d.Where("webhook_id = ?", h.ID).Delete(&models.WebhookDelivery{})
+		d.Delete(&h)
+	})
+
+	retry := async.RetryConfig{MaxAttempts: 3, BackoffBase: time.Second, Factor: 2}
+	sink := deliver(d, &Sender{Client: rc.Client()}, retry)
+	send := func(attempts int) (models.WebhookDelivery, error) {
+		err := sink(context.Background(), models.OutboxMessage{Kind: outbox.KindWebhook, Payload: payload, Attempts: attempts})
+		var got models.WebhookDelivery
+		d.First(&got, dl.ID)
+		return got, err
+	}
+
+	rc.status.Store(http.StatusServiceUnavailable)
+	if got, err := send(0); err == nil || got.Status != models.WebhookFailed || got.Attempts != 1 {
+		t.Fatalf("primer fallo: %v %+v", err, got)
+	}
+	if got, err := send(2); err == nil || got.Status != models.WebhookDead {
+		t.Fatalf("último intento: %v %+v", err, got)
+	}
+
+	var got models.WebhookDelivery
+	d.First(&got, dl.ID)
+	if err := Replay(d, &got); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	rc.status.Store(http.StatusOK)
+	if got, err := send(0); err != nil || got.Status != models.WebhookDelivered || got.DeliveredAt == nil {
+		t.Fatalf("tras el replay: %v %+v", err, got)
+	}
+
+	ids, errs := rc.calls()
+	for i := range ids {
+		if ids[i] != "evt-1" || errs[i] != nil {
+			t.Fatalf("entrega %d: event id %q, firma %v", i, ids[i], errs[i])
+		}
+	}
+}
@@ -1,23 +1,27 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"amestris/backend/internal/auth/jwtutil"
+	"amestris/backend/internal/auth/revocation"
+	"amestris/backend/internal/authz"
 	"amestris/backend/internal/db"
 	"amestris/backend/internal/handlers"
 	"amestris/backend/internal/metrics"
 	"amestris/backend/internal/middleware"
-
-	"amestris/backend/internal/jobs"
+	"amestris/backend/internal/outbox"
 	"amestris/backend/internal/queue"
+	"amestris/backend/internal/realtime"
+	"amestris/backend/internal/webhooks"
 
 	"github.com/gorilla/mux"
-	"github.com/hibiken/asynq"
 )
 
 func mountPublic(r *mux.Router) {
@@ -28,97 +32,164 @@ func mountPublic(r *mux.Router) {
 	}).Methods(http.MethodGet)
 	r.PathPrefix("/docs").HandlerFunc(handlers.SwaggerUI)
 
+	// Claves públicas JWT (JWKS)
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods(http.MethodGet)
+
 	// AUTH público
 	r.HandleFunc("/api/auth/register", handlers.Register).Methods(http.MethodPost)
 	r.HandleFunc("/api/auth/login", handlers.Login).Methods(http.MethodPost)
+	r.HandleFunc("/api/auth/password/forgot", handlers.PasswordForgot).Methods(http.MethodPost)
+	r.HandleFunc("/api/auth/password/reset", handlers.PasswordReset).Methods(http.MethodPost)
+
+	// MFA: segundo paso del login y alta (access token o desafío "enroll")
+	r.HandleFunc("/api/auth/mfa/verify", handlers.MFAVerify).Methods(http.MethodPost)
+	r.HandleFunc("/api/auth/mfa/setup", handlers.MFASetup).Methods(http.MethodPost)
+	r.HandleFunc("/api/auth/mfa/activate", handlers.MFAActivate).Methods(http.MethodPost)
 
-	// Auditorías públicas
-	r.HandleFunc("/api/audits", handlers.AuditsList).Methods(http.MethodGet)
+	// SSO OpenID Connect (authorization code + PKCE)
+	r.HandleFunc("/api/auth/oidc/start", handlers.OIDCStart).Methods(http.MethodGet)
+	r.HandleFunc("/api/auth/oidc/callback", handlers.OIDCCallback).Methods(http.MethodPost)
 
 	// Verificación de token
 	r.HandleFunc("/api/auth/me", handlers.Me).Methods(http.MethodGet)
+
+	// Feed iCalendar (autenticado por token en la URL)
+	r.HandleFunc("/api/calendar/alchemists/{id:[0-9]+}.ics", handlers.AlchemistCalendarICS).Methods(http.MethodGet)
 }
 
 func mountProtected(api *mux.Router) {
 	// JWT requerido y auditoría aplicada
 	api.Use(middleware.AuthJWT)
 	api.Use(middleware.Audit())
+	// POST con Idempotency-Key: una sola ejecución por usuario y clave
+	api.Use(middleware.Idempotency)
+
+	// can: subrouter que exige los permisos indicados (roles en BD, ver /roles)
+	can := func(perms ...string) *mux.Router {
+		s := api.PathPrefix("").Subrouter()
+		s.Use(middleware.RequirePermission(perms...))
+		return s
+	}
 
-	// ====== Rutas para AMBOS ROLES ======
+	// ====== Cuenta propia (cualquier usuario autenticado, no con API key) ======
+	account := api.PathPrefix("").Subrouter()
+	account.Use(middleware.RequireSession)
+	account.HandleFunc("/auth/password/change", handlers.PasswordChange).Methods(http.MethodPost)
+	account.HandleFunc("/auth/logout-all", handlers.LogoutAll).Methods(http.MethodPost)
+	account.HandleFunc("/auth/sessions", handlers.AuthSessionsList).Methods(http.MethodGet)
+	account.HandleFunc("/auth/sessions/{id}", handlers.AuthSessionsRevoke).Methods(http.MethodDelete)
+	account.HandleFunc("/auth/mfa", handlers.MFAStatus).Methods(http.MethodGet)
+	account.HandleFunc("/auth/mfa/disable", handlers.MFADisable).Methods(http.MethodPost)
+	account.HandleFunc("/auth/mfa/recovery-codes", handlers.MFARegenerateRecoveryCodes).Methods(http.MethodPost)
+	account.HandleFunc("/auth/api-keys", handlers.MyAPIKeysList).Methods(http.MethodGet)
+	account.HandleFunc("/auth/api-keys", handlers.MyAPIKeysCreate).Methods(http.MethodPost)
+	account.HandleFunc("/auth/api-keys/{id}", handlers.MyAPIKeysRevoke).Methods(http.MethodDelete)
+	// Token del feed .ics propio (alquimista vinculado al usuario)
+	account.HandleFunc("/auth/calendar-token", handlers.MyCalendarToken).Methods(http.MethodPost)
+
+	// Ticket de un solo uso para abrir el SSE con EventSource
+	api.HandleFunc("/realtime/ticket", handlers.RealtimeTicket).Methods(http.MethodPost)
 
 	// Materials
-	api.HandleFunc("/materials", handlers.MaterialsList).Methods(http.MethodGet)
-
-	// Missions
-	api.HandleFunc("/missions", handlers.ListMissions).Methods(http.MethodGet)
-	api.HandleFunc("/missions/{id}", handlers.GetMission).Methods(http.MethodGet)
-
-	// Transmutations
-	api.HandleFunc("/transmutations", handlers.TransmutationsList).Methods(http.MethodGet)
-	api.HandleFunc("/transmutations", handlers.TransmutationsCreate).Methods(http.MethodPost)
-	api.HandleFunc("/transmutations/{id}", handlers.TransmutationsUpdate).Methods(http.MethodPut) // <—
-	api.HandleFunc("/transmutations/{id}", handlers.TransmutationsDelete).Methods(http.MethodDelete)
-
-	// Encolar una transmutación
-	api.HandleFunc("/transmutations/queue", func(w http.ResponseWriter, r *http.Request) {
-		type inPayload struct {
-			Title      string  `json:"title"`
-			MaterialID uint    `json:"materialId"`
-			Quantity   float64 `json:"quantity"`
-			Result     string  `json:"result"`
-		}
-		var in inPayload
-		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || strings.TrimSpace(in.Title) == "" {
-			in = inPayload{Title: "Cola demo", MaterialID: 1, Quantity: 2, Result: "Lingote"}
-		}
-		var res *string
-		if s := strings.TrimSpace(in.Result); s != "" {
-			res = &s
-		}
-
-		p := jobs.PayloadTransmutation{
-			Title:      in.Title,
-			MaterialID: in.MaterialID,
-			Quantity:   in.Quantity,
-			Result:     res,
-		}
-		raw, _ := json.Marshal(p)
-		task := asynq.NewTask(jobs.TaskTransmutation, raw, asynq.MaxRetry(3), asynq.Timeout(30*time.Second))
-
-		info, err := queue.Client.Enqueue(task)
-		if err != nil {
-			http.Error(w, "no se pudo encolar tarea: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"taskId":          info.ID,
-			"queue":           info.Queue,
-			"state":           info.State.String(),
-			"next_process_at": info.NextProcessAt,
-		})
-	}).Methods(http.MethodPost)
-
-	// ====== SOLO SUPERVISOR ======
-	super := api.PathPrefix("").Subrouter()
-	super.Use(middleware.RequireRoleMW("SUPERVISOR"))
+	can(authz.MaterialsRead).HandleFunc("/materials", handlers.MaterialsList).Methods(http.MethodGet)
+	materialsW := can(authz.MaterialsWrite)
+	materialsW.HandleFunc("/materials", handlers.MaterialsCreate).Methods(http.MethodPost)
+	materialsW.HandleFunc("/materials/{id}", handlers.MaterialsUpdate).Methods(http.MethodPut)
+	materialsW.HandleFunc("/materials/{id}", handlers.MaterialsDelete).Methods(http.MethodDelete)
+
+	// Missions (pasar a APPROVED/REJECTED exige además missions:approve)
+	missionsR := can(authz.MissionsRead)
+	missionsR.HandleFunc("/missions", handlers.ListMissions).Methods(http.MethodGet)
+	missionsR.HandleFunc("/missions/stale", handlers.ListStaleMissions).Methods(http.MethodGet)
+	missionsR.HandleFunc("/missions/calendar", handlers.MissionsCalendar).Methods(http.MethodGet)
+	missionsR.HandleFunc("/missions/{id}", handlers.GetMission).Methods(http.MethodGet)
+	missionsW := can(authz.MissionsWrite)
+	missionsW.HandleFunc("/missions", handlers.CreateMission).Methods(http.MethodPost)
+	missionsW.HandleFunc("/missions/{id}", handlers.UpdateMission).Methods(http.MethodPut)
+	missionsW.HandleFunc("/missions/{id}", handlers.DeleteMission).Methods(http.MethodDelete)
+	missionsW.HandleFunc("/missions/{id}/auto-assign", handlers.AutoAssignMission).Methods(http.MethodPost)
+
+	// Transmutations (transmutations:any para actuar como otro alquimista)
+	can(authz.TransmutationsRead).HandleFunc("/transmutations", handlers.TransmutationsList).Methods(http.MethodGet)
+	transW := can(authz.TransmutationsWrite)
+	transW.HandleFunc("/transmutations", handlers.TransmutationsCreate).Methods(http.MethodPost)
+	transW.HandleFunc("/transmutations/queue", handlers.TransmutationsEnqueue).Methods(http.MethodPost)
+	transW.HandleFunc("/transmutations/{id}", handlers.TransmutationsUpdate).Methods(http.MethodPut)
+	transW.HandleFunc("/transmutations/{id}", handlers.TransmutationsDelete).Methods(http.MethodDelete)
 
 	// Alchemists
-	super.HandleFunc("/alchemists", handlers.ListAlchemists).Methods(http.MethodGet)
-	super.HandleFunc("/alchemists", handlers.CreateAlchemist).Methods(http.MethodPost)
-	super.HandleFunc("/alchemists/{id}", handlers.GetAlchemist).Methods(http.MethodGet)
-	super.HandleFunc("/alchemists/{id}", handlers.UpdateAlchemist).Methods(http.MethodPut)
-	super.HandleFunc("/alchemists/{id}", handlers.DeleteAlchemist).Methods(http.MethodDelete)
-
-	// Materials
-	super.HandleFunc("/materials", handlers.MaterialsCreate).Methods(http.MethodPost)
-	super.HandleFunc("/materials/{id}", handlers.MaterialsUpdate).Methods(http.MethodPut)
-	super.HandleFunc("/materials/{id}", handlers.MaterialsDelete).Methods(http.MethodDelete)
-
-	// Missions
-	super.HandleFunc("/missions", handlers.CreateMission).Methods(http.MethodPost)
-	super.HandleFunc("/missions/{id}", handlers.UpdateMission).Methods(http.MethodPut)
-	super.HandleFunc("/missions/{id}", handlers.DeleteMission).Methods(http.MethodDelete)
+	alchemistsR := can(authz.AlchemistsRead)
+	alchemistsR.HandleFunc("/alchemists", handlers.ListAlchemists).Methods(http.MethodGet)
+	alchemistsR.HandleFunc("/alchemists/{id}", handlers.GetAlchemist).Methods(http.MethodGet)
+	alchemistsR.HandleFunc("/alchemists/{id}/workload", handlers.AlchemistWorkload).Methods(http.MethodGet)
+	alchemistsR.HandleFunc("/alchemists/{id}/rank-history", handlers.AlchemistRankHistory).Methods(http.MethodGet)
+	alchemistsW := can(authz.AlchemistsWrite)
+	alchemistsW.HandleFunc("/alchemists", handlers.CreateAlchemist).Methods(http.MethodPost)
+	alchemistsW.HandleFunc("/alchemists/{id}", handlers.UpdateAlchemist).Methods(http.MethodPut)
+	alchemistsW.HandleFunc("/alchemists/{id}", handlers.DeleteAlchemist).Methods(http.MethodDelete)
+	alchemistsW.HandleFunc("/alchemists/{id}/calendar-token", handlers.AlchemistCalendarToken).Methods(http.MethodPost)
+	can(authz.AlchemistsRank).HandleFunc("/alchemists/{id}/rank", handlers.ChangeAlchemistRank).Methods(http.MethodPost)
+
+	// Auditoría
+	can(authz.AuditsRead).HandleFunc("/audits", handlers.AuditsList).Methods(http.MethodGet)
+
+	// Usuarios
+	usersR := can(authz.UsersRead)
+	usersR.HandleFunc("/users", handlers.UsersList).Methods(http.MethodGet)
+	usersR.HandleFunc("/users/{id}", handlers.UsersGet).Methods(http.MethodGet)
+	usersW := can(authz.UsersWrite)
+	usersW.HandleFunc("/users/{id}", handlers.UsersDelete).Methods(http.MethodDelete)
+	usersW.HandleFunc("/users/{id}/role", handlers.UsersUpdateRole).Methods(http.MethodPut)
+	usersW.HandleFunc("/users/{id}/disable", handlers.UsersDisable).Methods(http.MethodPost)
+	usersW.HandleFunc("/users/{id}/enable", handlers.UsersEnable).Methods(http.MethodPost)
+
+	// Seguridad: bloqueos de login y MFA
+	security := can(authz.Security)
+	security.HandleFunc("/users/{id}/unlock", handlers.UsersUnlock).Methods(http.MethodPost)
+	security.HandleFunc("/users/{id}/mfa/reset", handlers.UsersResetMFA).Methods(http.MethodPost)
+	security.HandleFunc("/security/lockouts", handlers.LockoutsList).Methods(http.MethodGet)
+	security.HandleFunc("/security/lockouts/{key}", handlers.LockoutsDelete).Methods(http.MethodDelete)
+
+	// Invitaciones
+	invitations := can(authz.Invitations)
+	invitations.HandleFunc("/invitations", handlers.InvitationsList).Methods(http.MethodGet)
+	invitations.HandleFunc("/invitations", handlers.InvitationsCreate).Methods(http.MethodPost)
+	invitations.HandleFunc("/invitations/{id}", handlers.InvitationsRevoke).Methods(http.MethodDelete)
+
+	// Roles y permisos
+	roles := can(authz.RolesManage)
+	roles.HandleFunc("/permissions", handlers.PermissionsList).Methods(http.MethodGet)
+	roles.HandleFunc("/roles", handlers.RolesList).Methods(http.MethodGet)
+	roles.HandleFunc("/roles", handlers.RolesCreate).Methods(http.MethodPost)
+	roles.HandleFunc("/roles/{name}", handlers.RolesGet).Methods(http.MethodGet)
+	roles.HandleFunc("/roles/{name}", handlers.RolesUpdate).Methods(http.MethodPut)
+	roles.HandleFunc("/roles/{name}", handlers.RolesDelete).Methods(http.MethodDelete)
+
+	// API keys de servicio y de cualquier usuario
+	apiKeys := can(authz.APIKeys)
+	apiKeys.Use(middleware.RequireSession)
+	apiKeys.HandleFunc("/api-keys", handlers.APIKeysList).Methods(http.MethodGet)
+	apiKeys.HandleFunc("/api-keys", handlers.APIKeysCreate).Methods(http.MethodPost)
+	apiKeys.HandleFunc("/api-keys/{id}", handlers.APIKeysRevoke).Methods(http.MethodDelete)
+
+	// Scheduler del worker
+	scheduler := can(authz.Scheduler)
+	scheduler.HandleFunc("/scheduler/jobs", handlers.SchedulerJobsList).Methods(http.MethodGet)
+	scheduler.HandleFunc("/scheduler/jobs/{name}/trigger", handlers.SchedulerJobTrigger).Methods(http.MethodPost)
+	scheduler.HandleFunc("/scheduler/jobs/{name}/pause", handlers.SchedulerJobPause).Methods(http.MethodPost)
+	scheduler.HandleFunc("/scheduler/jobs/{name}/resume", handlers.SchedulerJobResume).Methods(http.MethodPost)
+
+	// Webhooks salientes y su registro de entregas
+	hooks := can(authz.Webhooks)
+	hooks.HandleFunc("/webhooks", handlers.WebhooksList).Methods(http.MethodGet)
+	hooks.HandleFunc("/webhooks", handlers.WebhooksCreate).Methods(http.MethodPost)
+	hooks.HandleFunc("/webhooks/{id}", handlers.WebhooksGet).Methods(http.MethodGet)
+	hooks.HandleFunc("/webhooks/{id}", handlers.WebhooksUpdate).Methods(http.MethodPut)
+	hooks.HandleFunc("/webhooks/{id}", handlers.WebhooksDelete).Methods(http.MethodDelete)
+	hooks.HandleFunc("/webhooks/{id}/rotate-secret", handlers.WebhooksRotateSecret).Methods(http.MethodPost)
+	hooks.HandleFunc("/webhooks/{id}/ping", handlers.WebhooksPing).Methods(http.MethodPost)
+	hooks.HandleFunc("/webhooks/{id}/deliveries", handlers.WebhookDeliveriesList).Methods(http.MethodGet)
+	hooks.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}/replay", handlers.WebhookDeliveryReplay).Methods(http.MethodPost)
 }
 
 func main() {
@@ -127,9 +198,36 @@ func main() {
 		log.Fatalf("❌ Error conectando a la DB: %v", err)
 	}
 
+	// Claves de firma JWT (fuera de APP_ENV=dev es obligatorio tenerlas)
+	if err := jwtutil.Init(); err != nil {
+		log.Fatalf("❌ JWT: %v", err)
+	}
+
+	// Catálogo de permisos y roles de sistema
+	if err := authz.Seed(context.Background()); err != nil {
+		log.Fatalf("❌ Error sembrando roles: %v", err)
+	}
+
+	// Lista de revocación de access tokens
+	revocation.Setup()
+
 	// Cola
 	queue.Setup()
-	defer queue.Close()
+
+	// Relay del outbox también aquí: con REALTIME_BACKEND=memory es la única
+	// forma de que los eventos lleguen a los clientes de este proceso
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	if os.Getenv("OUTBOX_RELAY") != "false" {
+		relay := outbox.NewRelay(db.Get(), outbox.RetryFromEnv())
+		webhooks.Register(relay, db.Get())
+		go func() {
+			defer close(relayDone)
+			relay.Run(relayCtx)
+		}()
+	} else {
+		close(relayDone)
+	}
 
 	// Router raíz + CORS
 	r := mux.NewRouter()
@@ -154,9 +252,17 @@ func main() {
 	api := r.PathPrefix("/api").Subrouter()
 	mountProtected(api)
 
-	// SSE
-	r.HandleFunc("/realtime/sse", handlers.RealtimeSSE).Methods(http.MethodGet)
-	r.HandleFunc("/api/realtime/sse", handlers.RealtimeSSE).Methods(http.MethodGet)
+	// SSE: Bearer / API key o ?ticket= (POST /api/realtime/ticket)
+	sse := middleware.AuthStream(http.HandlerFunc(handlers.RealtimeSSE))
+	r.Handle("/realtime/sse", sse).Methods(http.MethodGet)
+	r.Handle("/api/realtime/sse", sse).Methods(http.MethodGet)
+	r.Handle("/api/v1/realtime/sse", sse).Methods(http.MethodGet)
+
+	// WebSocket: mismo auth; suscripciones en caliente por mensaje
+	ws := middleware.AuthStream(http.HandlerFunc(handlers.RealtimeWS))
+	r.Handle("/realtime/ws", ws).Methods(http.MethodGet)
+	r.Handle("/api/realtime/ws", ws).Methods(http.MethodGet)
+	r.Handle("/api/v1/realtime/ws", ws).Methods(http.MethodGet)
 
 	// Auth extra
 	r.HandleFunc("/auth/refresh", handlers.Refresh).Methods(http.MethodPost)
@@ -171,8 +277,16 @@ func main() {
 	r.PathPrefix("/api/v1/docs").HandlerFunc(handlers.SwaggerUI)
 	r.HandleFunc("/api/v1/auth/register", handlers.Register).Methods(http.MethodPost)
 	r.HandleFunc("/api/v1/auth/login", handlers.Login).Methods(http.MethodPost)
-	r.HandleFunc("/api/v1/audits", handlers.AuditsList).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/auth/password/forgot", handlers.PasswordForgot).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/auth/password/reset", handlers.PasswordReset).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/auth/mfa/verify", handlers.MFAVerify).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/auth/mfa/setup", handlers.MFASetup).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/auth/mfa/activate", handlers.MFAActivate).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/auth/oidc/start", handlers.OIDCStart).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/auth/oidc/callback", handlers.OIDCCallback).Methods(http.MethodPost)
+	r.Handle("/api/v1/audits", middleware.AuthJWT(middleware.RequirePermission(authz.AuditsRead)(http.HandlerFunc(handlers.AuditsList)))).Methods(http.MethodGet)
 	r.HandleFunc("/api/v1/auth/me", handlers.Me).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/calendar/alchemists/{id:[0-9]+}.ics", handlers.AlchemistCalendarICS).Methods(http.MethodGet)
 
 	apiV1 := r.PathPrefix("/api/v1").Subrouter()
 	mountProtected(apiV1)
@@ -192,7 +306,70 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("❌ Servidor: %v", err)
+	// SSE y WebSocket no terminan solos: al empezar el Shutdown se les pide a
+	// los clientes que reconecten y se cierran
+	srv.RegisterOnShutdown(realtime.CloseStreams)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	exitCode := 0
+	var shutdownCtx context.Context
+	var cancelShutdown context.CancelFunc
+	select {
+	case err := <-serveErr:
+		log.Printf("❌ Servidor: %v", err)
+		exitCode = 1
+		shutdownCtx, cancelShutdown = context.WithTimeout(context.Background(), shutdownTimeout())
+	case <-ctx.Done():
+		// Una segunda señal corta sin esperar
+		stop()
+		// Un único plazo para toda la parada: tiene que caber en el
+		// stop_grace_period del orquestador o el proceso muere con SIGKILL
+		shutdownCtx, cancelShutdown = context.WithTimeout(context.Background(), shutdownTimeout())
+		drainHTTP(shutdownCtx, srv)
+	}
+	defer cancelShutdown()
+
+	// Subsistemas en orden: el relay termina su lote (auditorías, eventos y
+	// webhooks), después la cola y por último el broker de tiempo real
+	stopRelay()
+	select {
+	case <-relayDone:
+	case <-shutdownCtx.Done():
+		log.Println("warn: el relay del outbox no terminó a tiempo")
+	}
+	queue.Close()
+	realtime.Shutdown()
+	db.Close()
+	log.Println("👋 Backend detenido")
+	os.Exit(exitCode)
+}
+
+// shutdownTimeout: plazo total de la parada desde la señal, con el retraso de
+// /readyz, el drenaje HTTP y el relay (SHUTDOWN_TIMEOUT_SEC). Debe quedar por
+// debajo del stop_grace_period.
+func shutdownTimeout() time.Duration {
+	return time.Duration(db.MustGetInt("SHUTDOWN_TIMEOUT_SEC", 20)) * time.Second
+}
+
+// drainHTTP deja de recibir tráfico sin cortar lo que está en curso: /readyz
+// pasa a 503 durante SHUTDOWN_DELAY_SEC para que el balanceador lo saque, y
+// después Shutdown espera (hasta el plazo de ctx) a que terminen las
+// peticiones, con sus transacciones y auditorías.
+func drainHTTP(ctx context.Context, srv *http.Server) {
+	handlers.SetDraining()
+	delay := time.Duration(db.MustGetInt("SHUTDOWN_DELAY_SEC", 2)) * time.Second
+	log.Printf("🛑 Señal recibida: /readyz en 503, se deja de aceptar tráfico en %v", delay)
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("warn: no todas las peticiones terminaron a tiempo: %v", err)
+		_ = srv.Close()
 	}
 }
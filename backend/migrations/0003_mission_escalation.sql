@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE missions ADD COLUMN IF NOT EXISTS stale_since       TIMESTAMPTZ;
+ALTER TABLE missions ADD COLUMN IF NOT EXISTS escalation_level  INT NOT NULL DEFAULT 0;
+ALTER TABLE missions ADD COLUMN IF NOT EXISTS last_escalated_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_missions_stale_since ON missions(stale_since);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_missions_stale_since;
+ALTER TABLE missions DROP COLUMN IF EXISTS last_escalated_at;
+ALTER TABLE missions DROP COLUMN IF EXISTS escalation_level;
+ALTER TABLE missions DROP COLUMN IF EXISTS stale_since;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+  name                  VARCHAR(80) PRIMARY KEY,
+  schedule              TEXT NOT NULL,
+  status                TEXT NOT NULL DEFAULT 'IDLE',
+  paused                BOOLEAN NOT NULL DEFAULT false,
+  last_run_at           TIMESTAMPTZ,
+  last_finished_at      TIMESTAMPTZ,
+  last_duration_ms      BIGINT NOT NULL DEFAULT 0,
+  last_error            TEXT,
+  next_run_at           TIMESTAMPTZ,
+  run_count             BIGINT NOT NULL DEFAULT 0,
+  fail_count            BIGINT NOT NULL DEFAULT 0,
+  trigger_requested_at  TIMESTAMPTZ,
+  triggered_by_id       BIGINT,
+  locked_by             VARCHAR(120),
+  locked_until          TIMESTAMPTZ,
+  created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS scheduled_jobs;
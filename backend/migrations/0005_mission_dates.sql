@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE missions ADD COLUMN IF NOT EXISTS scheduled_at        TIMESTAMPTZ;
+ALTER TABLE missions ADD COLUMN IF NOT EXISTS due_at              TIMESTAMPTZ;
+ALTER TABLE missions ADD COLUMN IF NOT EXISTS overdue_notified_at TIMESTAMPTZ;
+ALTER TABLE alchemists ADD COLUMN IF NOT EXISTS calendar_token_hash VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_missions_scheduled_at ON missions(scheduled_at);
+CREATE INDEX IF NOT EXISTS idx_missions_due_at ON missions(due_at);
+CREATE INDEX IF NOT EXISTS idx_alchemists_calendar_token_hash ON alchemists(calendar_token_hash);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_alchemists_calendar_token_hash;
+DROP INDEX IF EXISTS idx_missions_due_at;
+DROP INDEX IF EXISTS idx_missions_scheduled_at;
+ALTER TABLE alchemists DROP COLUMN IF EXISTS calendar_token_hash;
+ALTER TABLE missions DROP COLUMN IF EXISTS overdue_notified_at;
+ALTER TABLE missions DROP COLUMN IF EXISTS due_at;
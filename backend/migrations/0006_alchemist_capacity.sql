@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE alchemists ADD COLUMN IF NOT EXISTS capacity INT NOT NULL DEFAULT 3;
+ALTER TABLE missions ADD COLUMN IF NOT EXISTS required_specialty TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_missions_alchemist_status ON missions(assigned_alchemist_id, status);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_missions_alchemist_status;
+ALTER TABLE missions DROP COLUMN IF EXISTS required_specialty;
+ALTER TABLE alchemists DROP COLUMN IF EXISTS capacity;
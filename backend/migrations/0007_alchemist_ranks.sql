@@ -0,0 +1,37 @@
+-- +goose Up
+-- Normaliza los rangos libres al enum (desconocidos → Apprentice)
+UPDATE alchemists SET rank = CASE
+  WHEN rank ILIKE 'journeyman' THEN 'Journeyman'
+  WHEN rank ILIKE 'expert' THEN 'Expert'
+  WHEN rank ILIKE 'state' OR rank ILIKE 'state alchemist' THEN 'State'
+  WHEN rank ILIKE 'master' THEN 'Master'
+  ELSE 'Apprentice'
+END;
+ALTER TABLE alchemists ALTER COLUMN rank SET DEFAULT 'Apprentice';
+ALTER TABLE alchemists ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users(id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alchemists_user_id ON alchemists(user_id);
+
+UPDATE materials SET rarity = UPPER(TRIM(rarity)) WHERE rarity IS NOT NULL;
+
+ALTER TABLE transmutations ADD COLUMN IF NOT EXISTS alchemist_id BIGINT REFERENCES alchemists(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_transmutations_alchemist_id ON transmutations(alchemist_id);
+
+CREATE TABLE IF NOT EXISTS rank_changes (
+  id BIGSERIAL PRIMARY KEY,
+  alchemist_id BIGINT NOT NULL REFERENCES alchemists(id) ON DELETE CASCADE,
+  from_rank TEXT NOT NULL,
+  to_rank TEXT NOT NULL,
+  direction TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  changed_by_id BIGINT NOT NULL REFERENCES users(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_rank_changes_alchemist_id ON rank_changes(alchemist_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS rank_changes;
+DROP INDEX IF EXISTS idx_transmutations_alchemist_id;
+ALTER TABLE transmutations DROP COLUMN IF EXISTS alchemist_id;
+DROP INDEX IF EXISTS idx_alchemists_user_id;
+ALTER TABLE alchemists DROP COLUMN IF EXISTS user_id;
+ALTER TABLE alchemists ALTER COLUMN rank DROP DEFAULT;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_users_disabled_at ON users(disabled_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_disabled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
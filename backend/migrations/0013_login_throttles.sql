@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS login_throttles (
+  key VARCHAR(320) PRIMARY KEY,
+  failures INT NOT NULL DEFAULT 0,
+  first_failed_at TIMESTAMPTZ,
+  last_failed_at TIMESTAMPTZ,
+  next_attempt_at TIMESTAMPTZ,
+  locked_until TIMESTAMPTZ,
+  lockouts INT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_login_throttles_last_failed_at ON login_throttles(last_failed_at);
+CREATE INDEX IF NOT EXISTS idx_login_throttles_locked_until ON login_throttles(locked_until);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_throttles;
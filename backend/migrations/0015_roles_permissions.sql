@@ -0,0 +1,27 @@
+-- +goose Up
+-- El catálogo de permisos y los roles de sistema (SUPERVISOR, ALCHEMIST) los
+-- siembra la API al arrancar (authz.Seed); aquí solo se crean las tablas.
+CREATE TABLE IF NOT EXISTS roles (
+  name VARCHAR(64) PRIMARY KEY,
+  description TEXT,
+  builtin BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+  key VARCHAR(64) PRIMARY KEY,
+  description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role_name VARCHAR(64) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  permission_key VARCHAR(64) NOT NULL REFERENCES permissions(key) ON DELETE CASCADE,
+  PRIMARY KEY (role_name, permission_key)
+);
+CREATE INDEX IF NOT EXISTS idx_role_permissions_permission_key ON role_permissions(permission_key);
+
+-- +goose Down
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS api_keys (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  prefix VARCHAR(16) NOT NULL UNIQUE,
+  secret_hash VARCHAR(64) NOT NULL,
+  scopes JSONB NOT NULL DEFAULT '[]',
+  created_by_id BIGINT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  last_used_ip TEXT,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_expires_at ON api_keys(expires_at);
+
+-- Los roles de sistema reciben apikeys:manage al arrancar (authz.Seed)
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS outbox_messages (
+  id BIGSERIAL PRIMARY KEY,
+  kind VARCHAR(20) NOT NULL,
+  key VARCHAR(64) NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'PENDING',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT,
+  available_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  delivered_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_messages_key ON outbox_messages(key);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox_messages(status, available_at);
+
+ALTER TABLE audits ADD COLUMN IF NOT EXISTS dedupe_key VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audits_dedupe_key ON audits(dedupe_key);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_audits_dedupe_key;
+ALTER TABLE audits DROP COLUMN IF EXISTS dedupe_key;
+DROP TABLE IF EXISTS outbox_messages;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS claim_id VARCHAR(32);
+
+-- +goose Down
+ALTER TABLE outbox_messages DROP COLUMN IF EXISTS claim_id;
+ALTER TABLE outbox_messages DROP COLUMN IF EXISTS locked_until;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE login_throttles ADD COLUMN IF NOT EXISTS pending INT NOT NULL DEFAULT 0;
+ALTER TABLE login_throttles ADD COLUMN IF NOT EXISTS reserved_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE login_throttles DROP COLUMN IF EXISTS reserved_at;
+ALTER TABLE login_throttles DROP COLUMN IF EXISTS pending;
@@ -0,0 +1,40 @@
+"use client";
+
+import { useState } from "react";
+import { AuthAPI } from "@/lib/api";
+
+export default function ForgotPasswordPage() {
+  const [email, setEmail] = useState("");
+  const [sent, setSent] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+  const [loading, setLoading] = useState(false);
+
+  const onSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+    setLoading(true);
+    try {
+      await AuthAPI.forgotPassword(email.trim());
+      setSent(true);
+    } catch (err: any) {
+      setError(err.message || "No se pudo enviar la solicitud");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <main style={{ maxWidth: 420, margin: "48px auto" }}>
+      <h1>Recuperar contraseña</h1>
+      {sent ? (
+        <p>Si el correo está registrado, recibirás un enlace para restablecer la contraseña.</p>
+      ) : (
+        <form onSubmit={onSubmit} style={{ display: "grid", gap: 12 }}>
+          <input value={email} onChange={(e) => setEmail(e.target.value)} type="email" placeholder="Email" required />
+          <button disabled={loading}>{loading ? "Enviando..." : "Enviar enlace"}</button>
+          {error && <p style={{ color: "crimson" }}>✖ {error}</p>}
+        </form>
+      )}
+    </main>
+  );
+}
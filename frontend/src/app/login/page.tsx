@@ -1,8 +1,10 @@
 "use client";
 
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useRouter } from "next/navigation";
-import { AuthAPI, Token } from "@/lib/api";
+import { AuthAPI, MFAChallenge, PendingMFA, Token } from "@/lib/api";
+
+type Step = "password" | "code" | "enroll" | "recovery";
 
 export default function LoginPage() {
   const router = useRouter();
@@ -11,14 +13,27 @@ export default function LoginPage() {
   const [error, setError] = useState<string | null>(null);
   const [loading, setLoading] = useState(false);
 
-  const onSubmit = async (e: React.FormEvent) => {
-    e.preventDefault();
+  // Segundo factor
+  const [step, setStep] = useState<Step>("password");
+  const [mfaToken, setMfaToken] = useState("");
+  const [code, setCode] = useState("");
+  const [useRecovery, setUseRecovery] = useState(false);
+  const [setup, setSetup] = useState<{ secret: string; otpauthUrl: string } | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+
+  const finish = (tokens: { access?: string; refresh?: string; jti?: string; token?: string }) => {
+    if (tokens.access && tokens.refresh && tokens.jti) {
+      Token.setAll({ access: tokens.access, refresh: tokens.refresh, jti: tokens.jti });
+    } else if (tokens.token) {
+      Token.set(tokens.token);
+    }
+  };
+
+  const run = async (fn: () => Promise<void>) => {
     setError(null);
     setLoading(true);
     try {
-      const { token } = await AuthAPI.login(email, password);
-      Token.set(token);                // Guarda token 
-      router.replace("/");             
+      await fn();
     } catch (err: any) {
       setError(err.message || "Error al iniciar sesión");
     } finally {
@@ -26,15 +41,124 @@ export default function LoginPage() {
     }
   };
 
+  const challenge = async (ch: Pick<MFAChallenge, "enrollmentRequired" | "mfaToken">) => {
+    setMfaToken(ch.mfaToken);
+    setCode("");
+    if (ch.enrollmentRequired) {
+      setSetup(await AuthAPI.mfaSetup(ch.mfaToken));
+      setStep("enroll");
+    } else {
+      setStep("code");
+    }
+  };
+
+  // Desafío que dejó otra página (vuelta del SSO)
+  useEffect(() => {
+    const ch = PendingMFA.take();
+    if (ch) run(() => challenge(ch));
+  }, []);
+
+  const onPassword = (e: React.FormEvent) => {
+    e.preventDefault();
+    run(async () => {
+      const res = await AuthAPI.login(email, password);
+      if (res.mfaRequired && res.mfaToken) {
+        await challenge({ enrollmentRequired: !!res.enrollmentRequired, mfaToken: res.mfaToken });
+        return;
+      }
+      finish(res);
+      router.replace("/");
+    });
+  };
+
+  const onCode = (e: React.FormEvent) => {
+    e.preventDefault();
+    run(async () => {
+      const res = await AuthAPI.mfaVerify(mfaToken, useRecovery ? { recoveryCode: code } : { code });
+      finish(res);
+      router.replace("/");
+    });
+  };
+
+  const onEnroll = (e: React.FormEvent) => {
+    e.preventDefault();
+    run(async () => {
+      const res = await AuthAPI.mfaActivate(code, mfaToken);
+      finish(res);
+      setRecoveryCodes(res.recoveryCodes || []);
+      setStep("recovery");
+    });
+  };
+
+  const onSSO = () => {
+    run(async () => {
+      const { authorizationUrl } = await AuthAPI.oidcStart();
+      window.location.assign(authorizationUrl);
+    });
+  };
+
   return (
     <main style={{ maxWidth: 420, margin: "48px auto" }}>
       <h1>Iniciar sesión</h1>
-      <form onSubmit={onSubmit} style={{ display: "grid", gap: 12 }}>
-        <input value={email} onChange={(e) => setEmail(e.target.value)} placeholder="Email" />
-        <input value={password} onChange={(e) => setPassword(e.target.value)} type="password" placeholder="Contraseña" />
-        <button disabled={loading}>{loading ? "Ingresando..." : "Entrar"}</button>
-        {error && <p style={{ color: "crimson" }}>✖ {error}</p>}
-      </form>
+
+      {step === "password" && (
+        <form onSubmit={onPassword} style={{ display: "grid", gap: 12 }}>
+          <input value={email} onChange={(e) => setEmail(e.target.value)} placeholder="Email" />
+          <input value={password} onChange={(e) => setPassword(e.target.value)} type="password" placeholder="Contraseña" />
+          <button disabled={loading}>{loading ? "Ingresando..." : "Entrar"}</button>
+          {error && <p style={{ color: "crimson" }}>✖ {error}</p>}
+        </form>
+      )}
+
+      {step === "code" && (
+        <form onSubmit={onCode} style={{ display: "grid", gap: 12 }}>
+          <p>{useRecovery ? "Introduce uno de tus códigos de recuperación." : "Introduce el código de tu app autenticadora."}</p>
+          <input
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            placeholder={useRecovery ? "xxxx-xxxx" : "123456"}
+            inputMode={useRecovery ? "text" : "numeric"}
+            autoComplete="one-time-code"
+            autoFocus
+          />
+          <button disabled={loading}>{loading ? "Verificando..." : "Verificar"}</button>
+          <button type="button" onClick={() => { setUseRecovery(!useRecovery); setCode(""); }}>
+            {useRecovery ? "Usar código de la app" : "Usar un código de recuperación"}
+          </button>
+          {error && <p style={{ color: "crimson" }}>✖ {error}</p>}
+        </form>
+      )}
+
+      {step === "enroll" && setup && (
+        <form onSubmit={onEnroll} style={{ display: "grid", gap: 12 }}>
+          <p>Tu rol requiere verificación en dos pasos. Añade esta cuenta a tu app autenticadora:</p>
+          <code style={{ wordBreak: "break-all" }}>{setup.secret}</code>
+          <a href={setup.otpauthUrl}>Abrir en la app autenticadora</a>
+          <input value={code} onChange={(e) => setCode(e.target.value)} placeholder="Código de 6 dígitos" inputMode="numeric" autoFocus />
+          <button disabled={loading}>{loading ? "Activando..." : "Activar y entrar"}</button>
+          {error && <p style={{ color: "crimson" }}>✖ {error}</p>}
+        </form>
+      )}
+
+      {step === "recovery" && (
+        <div style={{ display: "grid", gap: 12 }}>
+          <p>Guarda estos códigos de recuperación; cada uno sirve una sola vez y no se volverán a mostrar:</p>
+          <pre>{recoveryCodes.join("\n")}</pre>
+          <button onClick={() => router.replace("/")}>Continuar</button>
+        </div>
+      )}
+
+      {step === "password" && (
+        <button type="button" onClick={onSSO} disabled={loading} style={{ marginTop: 12, width: "100%" }}>
+          Entrar con SSO
+        </button>
+      )}
+
+      {step === "password" && (
+        <p style={{ marginTop: 12 }}>
+          <a href="/forgot-password">¿Olvidaste tu contraseña?</a>
+        </p>
+      )}
     </main>
   );
 }
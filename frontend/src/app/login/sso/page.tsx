@@ -0,0 +1,61 @@
+"use client";
+
+import { useEffect, useRef, useState } from "react";
+import { useRouter } from "next/navigation";
+import { AuthAPI, PendingMFA, Token } from "@/lib/api";
+
+// Vuelta del proveedor SSO: /login/sso?code=…&state=… (o ?error=…)
+export default function SSOCallbackPage() {
+  const router = useRouter();
+  const [error, setError] = useState<string | null>(null);
+  const done = useRef(false);
+
+  useEffect(() => {
+    // El code es de un solo uso: evita el doble efecto de React en dev
+    if (done.current) return;
+    done.current = true;
+
+    const q = new URLSearchParams(window.location.search);
+    const code = q.get("code");
+    const state = q.get("state");
+    if (q.get("error")) {
+      setError(q.get("error_description") || q.get("error"));
+      return;
+    }
+    if (!code || !state) {
+      setError("Respuesta del proveedor incompleta");
+      return;
+    }
+    AuthAPI.oidcCallback(code, state)
+      .then((res) => {
+        // TOTP activo o rol con MFA obligatorio: el segundo factor se pide en /login
+        if (res.mfaRequired && res.mfaToken && res.mfaTokenExp) {
+          PendingMFA.save({
+            mfaRequired: true,
+            enrollmentRequired: !!res.enrollmentRequired,
+            mfaToken: res.mfaToken,
+            mfaTokenExp: res.mfaTokenExp,
+          });
+          router.replace("/login");
+          return;
+        }
+        Token.setAll({ access: res.access!, refresh: res.refresh!, jti: res.jti! });
+        router.replace("/");
+      })
+      .catch((err: any) => setError(err.message || "No se pudo iniciar sesión con SSO"));
+  }, [router]);
+
+  return (
+    <main style={{ maxWidth: 420, margin: "48px auto" }}>
+      <h1>Inicio de sesión SSO</h1>
+      {error ? (
+        <>
+          <p style={{ color: "crimson" }}>✖ {error}</p>
+          <a href="/login">Volver al login</a>
+        </>
+      ) : (
+        <p>Completando el inicio de sesión…</p>
+      )}
+    </main>
+  );
+}
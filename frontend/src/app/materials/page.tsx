@@ -1,7 +1,8 @@
 "use client";
 
-import { useEffect, useState } from "react";
+import { useEffect, useRef, useState } from "react";
 import { apiFetch } from "@/lib/api";
+import { openRealtimeSocket } from "@/lib/realtimeSocket";
 import { useAuth } from "@/context/AuthProvider";
 import AuthGate from "@/components/AuthGate";
 
@@ -103,6 +104,22 @@ export default function MaterialsPage() {
     if (token) load();
   }, [token]);
 
+  // Cambios de otros usuarios en vivo (WebSocket, tema material:*)
+  const loadRef = useRef(load);
+  loadRef.current = load;
+  useEffect(() => {
+    if (!token) return;
+    const sock = openRealtimeSocket(
+      (msg) => {
+        if (msg.type.startsWith("material.") || msg.type === "reset") {
+          loadRef.current();
+        }
+      },
+      { topics: ["material:*"] }
+    );
+    return () => sock.close();
+  }, [token]);
+
   async function onCreate(e: React.FormEvent) {
     e.preventDefault();
     try {
@@ -139,14 +139,14 @@ function statusBadgeStyle(status: string) {
 /* =================== PÁGINA PRINCIPAL =================== */
 
 export default function Home() {
-  const { user, login, register, logout } = useAuth();
+  const { user, login, register, logout, can } = useAuth();
 
   // --- estado login / registro ---
   const [email, setEmail] = useState("roy@amestris.gov");
   const [password, setPassword] = useState("fuego123");
   const [name, setName] = useState("Roy Mustang");
   const [mode, setMode] = useState<"login" | "register">("login");
-  const [role, setRole] = useState("SUPERVISOR");
+  const [inviteCode, setInviteCode] = useState("");
   const [msg, setMsg] = useState<string>("");
 
   // --- estado dashboard ---
@@ -158,6 +158,7 @@ export default function Home() {
   const [errorDash, setErrorDash] = useState<string | null>(null);
 
   const isSupervisor = user?.role === "SUPERVISOR";
+  const canAudits = can("audits:read");
 
   async function handleSubmit(e: React.FormEvent) {
     e.preventDefault();
@@ -167,7 +168,7 @@ export default function Home() {
         await login(email, password);
         setMsg("✅ Sesión iniciada correctamente.");
       } else {
-        await register(name, email, password, role);
+        await register(name, email, password, inviteCode.trim() || undefined);
         setMsg("✅ Registro exitoso. Usuario autenticado.");
       }
     } catch (err: any) {
@@ -189,7 +190,7 @@ export default function Home() {
         const [matsRes, transRes, auditsRes, missionsRes] = await Promise.all([
           apiGet<any>("/api/materials"),
           apiGet<TransListResponse>("/api/transmutations?pageSize=50"),
-          apiGet<any>("/api/audits"),
+          canAudits ? apiGet<any>("/api/audits") : Promise.resolve([]),
           apiGet<any>("/api/missions"),
         ]);
 
@@ -205,7 +206,7 @@ export default function Home() {
         setLoadingDash(false);
       }
     })();
-  }, [user]);
+  }, [user, canAudits]);
 
   // ===== Datos agregados para las gráficas =====
   const materialsChart = useMemo<BarDatum[]>(() => {
@@ -266,14 +267,12 @@ export default function Home() {
                   required
                   style={inputStyle}
                 />
-                <select
-                  value={role}
-                  onChange={(e) => setRole(e.target.value)}
+                <input
+                  placeholder="Código de invitación (si aplica)"
+                  value={inviteCode}
+                  onChange={(e) => setInviteCode(e.target.value)}
                   style={inputStyle}
-                >
-                  <option value="ALCHEMIST">ALCHEMIST</option>
-                  <option value="SUPERVISOR">SUPERVISOR</option>
-                </select>
+                />
               </>
             )}
 
@@ -385,7 +384,7 @@ export default function Home() {
         <Link href="/transmutations" style={{ marginRight: 12 }}>
           Ir a Transmutations
         </Link>
-        {isSupervisor && (
+        {canAudits && (
           <Link href="/audits" style={{ marginRight: 12 }}>
             Ver auditorías
           </Link>
@@ -416,7 +415,7 @@ export default function Home() {
               <p className="big-number">{openMissions.length}</p>
               <p className="muted">con estado distinto de DONE</p>
             </div>
-            {isSupervisor && (
+            {canAudits && (
               <div className="card">
                 <h3>Auditorías</h3>
                 <p className="big-number">{audits.length}</p>
@@ -431,7 +430,7 @@ export default function Home() {
               title="Materiales usados en transmutaciones (qty)"
               data={transByMaterial}
             />
-            {isSupervisor && (
+            {canAudits && (
               <BarChart title="Auditorías por acción" data={auditsByAction} />
             )}
           </div>
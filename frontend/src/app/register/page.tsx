@@ -1,8 +1,8 @@
 "use client";
 
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useRouter } from "next/navigation";
-import { AuthAPI } from "@/lib/api";
+import { AuthAPI, PendingMFA } from "@/lib/api";
 import { useToast } from "@/context/ToastProvider";
 import { useAuth } from "@/context/AuthProvider";
 
@@ -14,7 +14,17 @@ export default function RegisterPage() {
   const [name, setName] = useState("");
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
-  const [role, setRole] = useState<"SUPERVISOR" | "ALCHEMIST">("ALCHEMIST");
+  const [inviteCode, setInviteCode] = useState("");
+  const [invitationToken, setInvitationToken] = useState("");
+
+  // Enlace de invitación: /register?invitation=<token>&email=<email>
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.search);
+    const inv = params.get("invitation");
+    if (inv) setInvitationToken(inv);
+    const mail = params.get("email");
+    if (mail) setEmail(mail);
+  }, []);
   const [loading, setLoading] = useState(false);
 
   async function handleSubmit(e: React.FormEvent) {
@@ -26,7 +36,26 @@ export default function RegisterPage() {
 
     setLoading(true);
     try {
-      await AuthAPI.register(name.trim(), email.trim(), password, role);
+      const res = await AuthAPI.register(
+        name.trim(),
+        email.trim(),
+        password,
+        inviteCode.trim() || undefined,
+        invitationToken || undefined
+      );
+
+      // El rol de la invitación exige MFA: se configura en /login
+      if (res.mfaRequired && res.mfaToken && res.mfaTokenExp) {
+        PendingMFA.save({
+          mfaRequired: true,
+          enrollmentRequired: !!res.enrollmentRequired,
+          mfaToken: res.mfaToken,
+          mfaTokenExp: res.mfaTokenExp,
+        });
+        success("Usuario registrado. Configura la verificación en dos pasos…");
+        router.replace("/login");
+        return;
+      }
       success("Usuario registrado. Iniciando sesión…");
 
       // Tras registrar, se inicia sesión con las mismas credenciales
@@ -59,6 +88,7 @@ export default function RegisterPage() {
             type="email"
             value={email}
             onChange={(e) => setEmail(e.target.value)}
+            readOnly={!!invitationToken}
             required
           />
         </label>
@@ -73,16 +103,18 @@ export default function RegisterPage() {
           />
         </label>
 
-        <label>
-          Rol
-          <select
-            value={role}
-            onChange={(e) => setRole(e.target.value as any)}
-          >
-            <option value="ALCHEMIST">Alchemist</option>
-            <option value="SUPERVISOR">Supervisor</option>
-          </select>
-        </label>
+        {invitationToken ? (
+          <p>Registro por invitación: el rol lo define la invitación.</p>
+        ) : (
+          <label>
+            Código de invitación (si aplica)
+            <input
+              type="text"
+              value={inviteCode}
+              onChange={(e) => setInviteCode(e.target.value)}
+            />
+          </label>
+        )}
 
         <button type="submit" disabled={loading}>
           {loading ? "Registrando..." : "Registrarse"}
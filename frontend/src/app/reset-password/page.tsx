@@ -0,0 +1,53 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { useRouter } from "next/navigation";
+import { AuthAPI } from "@/lib/api";
+
+export default function ResetPasswordPage() {
+  const router = useRouter();
+  const [token, setToken] = useState("");
+  const [password, setPassword] = useState("");
+  const [confirm, setConfirm] = useState("");
+  const [error, setError] = useState<string | null>(null);
+  const [loading, setLoading] = useState(false);
+
+  // Enlace del correo: /reset-password?token=<token>
+  useEffect(() => {
+    setToken(new URLSearchParams(window.location.search).get("token") || "");
+  }, []);
+
+  const onSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+    if (password !== confirm) {
+      setError("Las contraseñas no coinciden");
+      return;
+    }
+    setLoading(true);
+    try {
+      await AuthAPI.resetPassword(token, password);
+      router.replace("/login");
+    } catch (err: any) {
+      setError(err.message || "No se pudo restablecer la contraseña");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <main style={{ maxWidth: 420, margin: "48px auto" }}>
+      <h1>Nueva contraseña</h1>
+      {!token ? (
+        <p>Enlace inválido. Solicita uno nuevo desde “Recuperar contraseña”.</p>
+      ) : (
+        <form onSubmit={onSubmit} style={{ display: "grid", gap: 12 }}>
+          <input value={password} onChange={(e) => setPassword(e.target.value)} type="password" placeholder="Nueva contraseña" minLength={6} required />
+          <input value={confirm} onChange={(e) => setConfirm(e.target.value)} type="password" placeholder="Repetir contraseña" minLength={6} required />
+          <button disabled={loading}>{loading ? "Guardando..." : "Guardar"}</button>
+          {error && <p style={{ color: "crimson" }}>✖ {error}</p>}
+        </form>
+      )}
+    </main>
+  );
+}
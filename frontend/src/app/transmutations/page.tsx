@@ -1,10 +1,10 @@
 "use client";
 
-import { useEffect, useMemo, useState, useCallback } from "react";
+import { useEffect, useMemo, useState, useCallback, useRef } from "react";
 import AuthGate from "@/components/AuthGate";
 import { useAuth } from "@/context/AuthProvider";
 import { useToast } from "@/context/ToastProvider";
-import { apiGet, apiFetch, Token } from "@/lib/api";
+import { apiGet, apiFetch, newIdempotencyKey, Token } from "@/lib/api";
 import RealtimeBridge from "@/components/RealtimeBridge";
 
 type Transmutation = {
@@ -67,6 +67,14 @@ export default function TransmutationsPage() {
     [title, materialId, quantityUsed]
   );
 
+  // Una Idempotency-Key por transmutación: los reintentos del mismo formulario
+  // la repiten y el backend no descuenta el stock dos veces; al cambiar algún
+  // campo se trata de otra transmutación.
+  const idempotencyKeyRef = useRef<string | null>(null);
+  useEffect(() => {
+    idempotencyKeyRef.current = null;
+  }, [title, materialId, missionId, quantityUsed, result]);
+
   function handleAuthError(e: any) {
     const msg = String(e?.message || "").toLowerCase();
     if (
@@ -129,10 +137,13 @@ export default function TransmutationsPage() {
     e.preventDefault();
     if (!canCreate) return;
 
+    if (!idempotencyKeyRef.current) idempotencyKeyRef.current = newIdempotencyKey();
+
     setSubmitting(true);
     try {
       const created = await apiFetch<Transmutation>("/api/transmutations", {
         method: "POST",
+        headers: { "Idempotency-Key": idempotencyKeyRef.current },
         body: JSON.stringify({
           title: title.trim(),
           materialId: materialId as number,
@@ -153,6 +164,7 @@ export default function TransmutationsPage() {
       setMissionId("");
       setQuantityUsed(1);
       setResult("");
+      idempotencyKeyRef.current = null;
       success("Transmutación creada");
     } catch (e: any) {
       if (handleAuthError(e)) return;
@@ -205,12 +217,20 @@ export default function TransmutationsPage() {
     [info, user?.role]
   );
 
+  // El SSE perdió eventos al reconectar ("reset"): se recarga la lista
+  const loadRef = useRef(load);
+  loadRef.current = load;
+  const onReset = useCallback(() => {
+    loadRef.current();
+  }, []);
+
   return (
     <AuthGate>
       <RealtimeBridge
         verbose
         onTransmutationCreated={onTransmutationCreated}
         onTransmutationDeleted={onTransmutationDeleted}
+        onReset={onReset}
       />
 
       <main className="max-w-4xl mx-auto p-6">
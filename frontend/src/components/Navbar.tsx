@@ -4,7 +4,7 @@ import Link from "next/link";
 import { useAuth } from "@/context/AuthProvider";
 
 export default function Navbar() {
-  const { user, logout } = useAuth();
+  const { user, logout, can } = useAuth();
   const isSupervisor = user?.role === "SUPERVISOR";
 
   return (
@@ -27,8 +27,8 @@ export default function Navbar() {
             Transmutations
           </Link>
 
-          {/* Audits solo visible para SUPERVISOR */}
-          {isSupervisor && (
+          {/* Audits solo visible con audits:read */}
+          {can("audits:read") && (
             <Link href="/audits" className="hover:underline">
               Audits
             </Link>
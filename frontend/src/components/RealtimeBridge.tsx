@@ -7,12 +7,14 @@ import { useToast } from "@/context/ToastProvider";
 type Props = {
   onTransmutationCreated?: (payload: any) => void;
   onTransmutationDeleted?: (payload: any) => void;
+  onReset?: () => void;
   verbose?: boolean;
 };
 
 export default function RealtimeBridge({
   onTransmutationCreated,
   onTransmutationDeleted,
+  onReset,
   verbose,
 }: Props) {
   const { success, info, error } = useToast();
@@ -39,6 +41,24 @@ export default function RealtimeBridge({
             info(`✨ Transmutación actualizada: ${data?.title || ""}`);
             onTransmutationCreated?.(data);
           }
+
+          // Se perdieron eventos durante la desconexión: recargar listados
+          if (type === "reset") {
+            info("🔄 Reconectado: actualizando datos");
+            onReset?.();
+          }
+
+          if (type === "mission.overdue") {
+            info(`⏰ Misión vencida: ${data?.title || `#${data?.missionId ?? "?"}`}`);
+          }
+
+          if (type === "mission.status_changed") {
+            info(`📜 Misión ${data?.title || `#${data?.missionId ?? "?"}`}: ${data?.from} → ${data?.to}`);
+          }
+
+          if (type === "mission.stale") {
+            info(`⚠️ Misión estancada: ${data?.title || `#${data?.missionId ?? "?"}`}`);
+          }
         } catch (e) {
           if (verbose) console.warn("[SSE] handler error", e);
           error?.("Ocurrió un problema mostrando el evento.");
@@ -57,7 +77,7 @@ export default function RealtimeBridge({
     );
 
     return () => disconnect();
-  }, [onTransmutationCreated, onTransmutationDeleted, verbose, success, info, error]);
+  }, [onTransmutationCreated, onTransmutationDeleted, onReset, verbose, success, info, error]);
 
   return null;
 }
@@ -3,15 +3,17 @@
 import { createContext, useContext, useEffect, useState } from "react";
 import { apiFetch } from "@/lib/api";
 
-type User = { id: number; name: string; email: string; role: string };
+// permissions llega de /api/auth/me (permisos efectivos del rol)
+type User = { id: number; name: string; email: string; role: string; permissions?: string[] };
 
 type AuthCtx = {
   user: User | null;
   token: string | null; // access
   ready: boolean;
   login: (email: string, password: string) => Promise<void>;
-  register: (name: string, email: string, password: string, role: string) => Promise<void>;
+  register: (name: string, email: string, password: string, inviteCode?: string) => Promise<void>;
   logout: () => void;
+  can: (perm: string) => boolean;
 };
 
 const AuthContext = createContext<AuthCtx | null>(null);
@@ -55,14 +57,23 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
 
   // Login
   async function login(email: string, password: string) {
-    const res = await apiFetch<{ token: string; user: User; access?: string; refresh?: string; jti?: string }>(
-      "/api/auth/login",
-      {
-        method: "POST",
-        body: JSON.stringify({ email, password }),
-        headers: { "Content-Type": "application/json" },
-      }
-    );
+    const res = await apiFetch<{
+      token: string;
+      user: User;
+      access?: string;
+      refresh?: string;
+      jti?: string;
+      mfaRequired?: boolean;
+    }>("/api/auth/login", {
+      method: "POST",
+      body: JSON.stringify({ email, password }),
+      headers: { "Content-Type": "application/json" },
+    });
+
+    // El segundo factor se completa en /login
+    if (res.mfaRequired) {
+      throw new Error("Se requiere verificación en dos pasos: inicia sesión desde /login");
+    }
 
     if (res.access && res.refresh && res.jti) {
       localStorage.setItem("auth", JSON.stringify({ access: res.access, refresh: res.refresh, jti: res.jti }));
@@ -76,12 +87,12 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
   }
 
   // Registro
-  async function register(name: string, email: string, password: string, role: string) {
+  async function register(name: string, email: string, password: string, inviteCode?: string) {
     const res = await apiFetch<{ token: string; user: User; access?: string; refresh?: string; jti?: string }>(
       "/api/auth/register",
       {
         method: "POST",
-        body: JSON.stringify({ name, email, password, role }),
+        body: JSON.stringify({ name, email, password, inviteCode }),
         headers: { "Content-Type": "application/json" },
       }
     );
@@ -119,8 +130,15 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     setUser(null);
   }
 
+  // Sin lista de permisos (respuesta de login) se asume lo de siempre: SUPERVISOR puede todo
+  function can(perm: string) {
+    if (!user) return false;
+    if (user.permissions) return user.permissions.includes(perm);
+    return user.role === "SUPERVISOR";
+  }
+
   return (
-    <AuthContext.Provider value={{ user, token, ready, login, register, logout }}>
+    <AuthContext.Provider value={{ user, token, ready, login, register, logout, can }}>
       {children}
     </AuthContext.Provider>
   );
@@ -102,6 +102,17 @@ async function tryRefreshOnce(): Promise<boolean> {
   return true;
 }
 
+/* ===================== Idempotencia ===================== */
+
+// Clave para Idempotency-Key: se genera una por operación y se repite en sus
+// reintentos para que el backend no la ejecute dos veces.
+export function newIdempotencyKey(): string {
+  if (typeof crypto !== "undefined" && typeof crypto.randomUUID === "function") {
+    return crypto.randomUUID();
+  }
+  return `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}${Math.random().toString(36).slice(2)}`;
+}
+
 /* ===================== Core fetch con auto-refresh ===================== */
 
 export async function apiFetch<T = any>(path: string, opts: ApiOptions = {}) {
@@ -180,20 +191,76 @@ export const apiDelete = <T = any>(path: string, opts: ApiOptions = {}) =>
 
 /* ===================== Módulos API ===================== */
 
+export type AuthTokens = { token: string; access: string; refresh: string; jti: string; exp: number; user: any };
+export type MFAChallenge = { mfaRequired: true; enrollmentRequired: boolean; mfaToken: string; mfaTokenExp: number };
+
+// Desafío MFA pendiente de otra página (p. ej. la vuelta del SSO) que /login retoma
+export const PendingMFA = {
+  save(ch: MFAChallenge) {
+    if (typeof window === "undefined") return;
+    sessionStorage.setItem("mfaChallenge", JSON.stringify(ch));
+  },
+
+  /** Lo devuelve una sola vez y solo si no ha expirado */
+  take(): MFAChallenge | null {
+    if (typeof window === "undefined") return null;
+    const raw = sessionStorage.getItem("mfaChallenge");
+    sessionStorage.removeItem("mfaChallenge");
+    if (!raw) return null;
+    try {
+      const ch = JSON.parse(raw) as MFAChallenge;
+      return ch.mfaTokenExp * 1000 > Date.now() ? ch : null;
+    } catch {
+      return null;
+    }
+  },
+};
+
 export const AuthAPI = {
   // Trae { token, user } (compat); si backend ya envía {access,refresh,jti}, también se reciben
+  // Con MFA responde { mfaRequired, enrollmentRequired, mfaToken } en lugar de tokens
   login: (email: string, password: string) =>
-    apiPost<{ token: string; access?: string; refresh?: string; jti?: string; user: any }>(
+    apiPost<Partial<AuthTokens> & Partial<MFAChallenge>>(
       "/api/auth/login",
       { email, password },
       { timeoutMs: 15000 }
     ),
-  register: (name: string, email: string, password: string, role: string) =>
-    apiPost<{ token: string; access?: string; refresh?: string; jti?: string; user: any }>(
+  mfaVerify: (mfaToken: string, code: { code?: string; recoveryCode?: string }) =>
+    apiPost<AuthTokens>("/api/auth/mfa/verify", { mfaToken, ...code }, { timeoutMs: 15000 }),
+  // Sin mfaToken usa el access token actual (alta desde la cuenta)
+  mfaSetup: (mfaToken?: string) =>
+    apiPost<{ secret: string; otpauthUrl: string }>("/api/auth/mfa/setup", mfaToken ? { mfaToken } : {}),
+  mfaActivate: (code: string, mfaToken?: string) =>
+    apiPost<{ status: string; recoveryCodes: string[] } & Partial<AuthTokens>>("/api/auth/mfa/activate", {
+      code,
+      mfaToken,
+    }),
+  // SSO: URL del proveedor y, a la vuelta en /login/sso, canje de code+state por tokens
+  // El state va también en una cookie HttpOnly: ambas llamadas necesitan credenciales
+  oidcStart: () =>
+    apiGet<{ authorizationUrl: string; state: string }>("/api/auth/oidc/start", { credentials: "include" }),
+  oidcCallback: (code: string, state: string) =>
+    apiPost<Partial<AuthTokens> & Partial<MFAChallenge>>(
+      "/api/auth/oidc/callback",
+      { code, state },
+      { timeoutMs: 20000, credentials: "include" }
+    ),
+  register: (name: string, email: string, password: string, inviteCode?: string, invitationToken?: string) =>
+    apiPost<Partial<AuthTokens> & Partial<MFAChallenge>>(
       "/api/auth/register",
-      { name, email, password, role },
+      { name, email, password, inviteCode, invitationToken },
       { timeoutMs: 15000 }
     ),
+  forgotPassword: (email: string) =>
+    apiPost<{ status: string }>("/api/auth/password/forgot", { email }, { timeoutMs: 15000 }),
+  resetPassword: (token: string, password: string) =>
+    apiPost<{ status: string }>("/api/auth/password/reset", { token, password }, { timeoutMs: 15000 }),
+  changePassword: (currentPassword: string, newPassword: string, jti?: string) =>
+    apiPost<{ status: string; revokedSessions: number }>("/api/auth/password/change", {
+      currentPassword,
+      newPassword,
+      jti,
+    }),
 };
 
 export const MaterialsAPI = {
@@ -225,10 +292,18 @@ export const TransmutationsAPI = {
     missionId?: number | null;
     quantityUsed: number;
     result?: string | null;
-  }) => apiPost<any>("/api/transmutations", payload),
+  }, idempotencyKey?: string) =>
+    apiPost<any>("/api/transmutations", payload, {
+      headers: idempotencyKey ? { "Idempotency-Key": idempotencyKey } : undefined,
+    }),
   del: (id: number) => apiDelete<void>(`/api/transmutations/${id}`),
 };
 
+export const RealtimeAPI = {
+  // Ticket de un solo uso para abrir el SSE (EventSource no envía Authorization)
+  ticket: () => apiPost<{ ticket: string; expiresAt: string }>("/api/realtime/ticket"),
+};
+
 export const AuditsAPI = {
   list: () => apiGet<any[]>("/api/audits"),
 };
@@ -1,91 +1,135 @@
+import { RealtimeAPI } from "@/lib/api";
+
 type RealtimeHandlers = {
   onEvent: (type: string, data: any) => void;
   onOpen?: () => void;
   onError?: (e: any) => void;
   onClose?: () => void;
+  // Filtro opcional (?types=); el backend además filtra por rol y alquimista
+  types?: string[];
 };
 
-function buildSSEUrl(): string {
+const EVENT_TYPES = [
+  "hello",
+  "ping",
+  "close",
+  "reset",
+  "transmutation.created",
+  "transmutation.updated",
+  "transmutation.deleted",
+  "material.created",
+  "material.updated",
+  "material.deleted",
+  "material.stock_changed",
+  "mission.created",
+  "mission.updated",
+  "mission.deleted",
+  "mission.status_changed",
+  "mission.stale",
+  "mission.overdue",
+  "alchemist.created",
+  "alchemist.updated",
+  "alchemist.deleted",
+  "alchemist.rank_changed",
+];
+
+const RETRY_MIN_MS = 1000;
+const RETRY_MAX_MS = 30000;
+
+// Cada conexión usa un ticket nuevo (un solo uso, ~30 s); lastEventId reanuda
+// desde el último evento recibido (el backend reenvía lo perdido o manda "reset")
+async function buildSSEUrl(types?: string[], lastEventId?: string): Promise<string> {
   const base =
     (process.env.NEXT_PUBLIC_API_URL || "http://localhost:8080").replace(/\/+$/, "");
-  const token =
-    typeof window !== "undefined"
-      ? localStorage.getItem("token") || sessionStorage.getItem("token")
-      : null;
-
-  const url = `${base}/api/realtime/sse`;
-  return token ? `${url}?token=${encodeURIComponent(token)}` : url;
+  const { ticket } = await RealtimeAPI.ticket();
+  const q = new URLSearchParams({ ticket });
+  if (types?.length) q.set("types", types.join(","));
+  if (lastEventId) q.set("lastEventId", lastEventId);
+  return `${base}/api/realtime/sse?${q.toString()}`;
 }
 
-export function connectRealtime(
-  onEvent: RealtimeHandlers["onEvent"],
-  { onOpen, onError, onClose }: Omit<RealtimeHandlers, "onEvent"> = {}
-): () => void {
-  const url = buildSSEUrl();
-
+const debug = (...args: any[]) => {
   if (typeof window !== "undefined" && process.env.NODE_ENV !== "production") {
-    console.log("[SSE] connecting to", url);
+    console.log("[SSE]", ...args);
   }
+};
 
-  const es = new EventSource(url);
+export function connectRealtime(
+  onEvent: RealtimeHandlers["onEvent"],
+  { onOpen, onError, onClose, types }: Omit<RealtimeHandlers, "onEvent"> = {}
+): () => void {
+  let es: EventSource | null = null;
+  let closed = false;
+  let retryMs = RETRY_MIN_MS;
+  let retryTimer: ReturnType<typeof setTimeout> | null = null;
+  let lastEventId = "";
 
-  es.onopen = () => {
-    if (typeof window !== "undefined" && process.env.NODE_ENV !== "production") {
-      console.log("[SSE] onopen");
+  const parse = (ev: MessageEvent) => {
+    try {
+      return ev.data ? JSON.parse(ev.data) : null;
+    } catch {
+      return ev.data ?? null;
     }
-    onOpen?.();
   };
 
-  es.onerror = (e) => {
-    if (typeof window !== "undefined" && process.env.NODE_ENV !== "production") {
-      console.warn("[SSE] onerror", e);
-    }
-    onError?.(e);
-    // EventSource intenta automáticamente
+  // El ticket ya se consumió: no dejamos que EventSource reintente solo
+  const reconnect = () => {
+    es?.close();
+    es = null;
+    if (closed) return;
+    retryTimer = setTimeout(open, retryMs);
+    retryMs = Math.min(retryMs * 2, RETRY_MAX_MS);
   };
 
-  es.onmessage = (ev) => {
-    let data: any = null;
+  const open = async () => {
+    retryTimer = null;
+    let url: string;
     try {
-      data = ev.data ? JSON.parse(ev.data) : null;
-    } catch {
-      data = ev.data ?? null;
+      url = await buildSSEUrl(types, lastEventId);
+    } catch (e) {
+      // Sin sesión (o backend caído): reintenta con backoff
+      onError?.(e);
+      reconnect();
+      return;
     }
-    onEvent("message", data);
-  };
+    if (closed) return;
 
-  const makeNamedHandler = (eventName: string) => (ev: MessageEvent) => {
-    let data: any = null;
-    try {
-      data = ev.data ? JSON.parse(ev.data) : null;
-    } catch {
-      data = ev.data ?? null;
-    }
-    onEvent(eventName, data);
-  };
+    debug("connecting");
+    es = new EventSource(url);
 
-  const helloHandler = makeNamedHandler("hello");
-  const pingHandler = makeNamedHandler("ping");
-  const createdHandler = makeNamedHandler("transmutation.created");
-  const deletedHandler = makeNamedHandler("transmutation.deleted");
+    es.onopen = () => {
+      debug("onopen");
+      retryMs = RETRY_MIN_MS;
+      onOpen?.();
+    };
 
-  (es as any).addEventListener("hello", helloHandler);
-  (es as any).addEventListener("ping", pingHandler);
-  (es as any).addEventListener("transmutation.created", createdHandler);
-  (es as any).addEventListener("transmutation.deleted", deletedHandler);
+    es.onerror = (e) => {
+      debug("onerror", e);
+      onError?.(e);
+      reconnect();
+    };
 
-  const disconnect = () => {
-    try {
-      (es as any).removeEventListener("hello", helloHandler);
-      (es as any).removeEventListener("ping", pingHandler);
-      (es as any).removeEventListener("transmutation.created", createdHandler);
-      (es as any).removeEventListener("transmutation.deleted", deletedHandler);
-    } catch {
-      
+    es.onmessage = (ev) => onEvent("message", parse(ev));
+
+    for (const name of EVENT_TYPES) {
+      es.addEventListener(name, (ev) => {
+        const msg = ev as MessageEvent;
+        if (msg.lastEventId) lastEventId = msg.lastEventId;
+        const data = parse(msg);
+        onEvent(name, data);
+        // El servidor cerró el stream (sesión revocada, usuario deshabilitado…)
+        if (name === "close") reconnect();
+      });
     }
-    es.close();
-    onClose?.();
   };
 
-  return disconnect;
+  open();
+
+  return () => {
+    closed = true;
+    if (retryTimer) clearTimeout(retryTimer);
+    es?.close();
+    es = null;
+    onClose?.();
+  };
 }
@@ -0,0 +1,114 @@
+import { RealtimeAPI } from "@/lib/api";
+
+// Mismo sobre que el SSE: { id?, key?, type, data }. Además "ack" y "error" como
+// respuesta a subscribe/unsubscribe (data.ref identifica el comando).
+export type RealtimeMessage = { id?: number; key?: string; type: string; data: any };
+
+type SocketOptions = {
+  // Suscripciones iniciales: "mission:42", "material:*", "transmutation"…
+  topics?: string[];
+  onOpen?: () => void;
+  onError?: (e: any) => void;
+};
+
+export type RealtimeSocket = {
+  subscribe: (topics: string[], ref?: string) => void;
+  unsubscribe: (topics: string[], ref?: string) => void;
+  close: () => void;
+};
+
+const RETRY_MIN_MS = 1000;
+const RETRY_MAX_MS = 30000;
+
+async function buildWSUrl(topics: string[], lastEventId?: number): Promise<string> {
+  const base = (process.env.NEXT_PUBLIC_API_URL || "http://localhost:8080")
+    .replace(/\/+$/, "")
+    .replace(/^http/, "ws");
+  const { ticket } = await RealtimeAPI.ticket();
+  const q = new URLSearchParams({ ticket });
+  if (topics.length) q.set("topics", topics.join(","));
+  if (lastEventId) q.set("lastEventId", String(lastEventId));
+  return `${base}/api/realtime/ws?${q.toString()}`;
+}
+
+// Conexión WebSocket con suscripciones en caliente. Al reconectar vuelve a
+// pedir sus temas y reanuda desde el último id recibido.
+export function openRealtimeSocket(
+  onEvent: (msg: RealtimeMessage) => void,
+  { topics = [], onOpen, onError }: SocketOptions = {}
+): RealtimeSocket {
+  const subscribed = new Set(topics);
+  let ws: WebSocket | null = null;
+  let closed = false;
+  let retryMs = RETRY_MIN_MS;
+  let retryTimer: ReturnType<typeof setTimeout> | null = null;
+  let lastEventId = 0;
+
+  const reconnect = () => {
+    ws = null;
+    if (closed) return;
+    retryTimer = setTimeout(open, retryMs);
+    retryMs = Math.min(retryMs * 2, RETRY_MAX_MS);
+  };
+
+  const open = async () => {
+    retryTimer = null;
+    let url: string;
+    try {
+      url = await buildWSUrl([...subscribed], lastEventId);
+    } catch (e) {
+      onError?.(e);
+      reconnect();
+      return;
+    }
+    if (closed) return;
+
+    const sock = new WebSocket(url);
+    ws = sock;
+    sock.onopen = () => {
+      retryMs = RETRY_MIN_MS;
+      onOpen?.();
+    };
+    sock.onerror = (e) => onError?.(e);
+    // 1013 = cola llena, 1008 = sesión no válida: en ambos casos se reintenta
+    sock.onclose = () => {
+      if (ws === sock) reconnect();
+    };
+    sock.onmessage = (ev) => {
+      let msg: RealtimeMessage;
+      try {
+        msg = JSON.parse(ev.data);
+      } catch {
+        return;
+      }
+      if (msg.id) lastEventId = msg.id;
+      onEvent(msg);
+    };
+  };
+
+  const send = (op: string, list: string[], ref?: string) => {
+    if (ws?.readyState === WebSocket.OPEN) {
+      ws.send(JSON.stringify({ op, topics: list, ref }));
+    }
+  };
+
+  open();
+
+  return {
+    subscribe: (list, ref) => {
+      list.forEach((t) => subscribed.add(t));
+      send("subscribe", list, ref);
+    },
+    unsubscribe: (list, ref) => {
+      list.forEach((t) => subscribed.delete(t));
+      send("unsubscribe", list, ref);
+    },
+    close: () => {
+      closed = true;
+      if (retryTimer) clearTimeout(retryTimer);
+      const sock = ws;
+      ws = null;
+      sock?.close();
+    },
+  };
+}